@@ -0,0 +1,93 @@
+package restful
+
+import (
+	"net/http"
+
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/cabin/tailormade/resp"
+	"github.com/quanxiang-cloud/fileserver/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scrub Scrub.
+func (f *FileServer) Scrub(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	resp.Format(f.fileserver.Scrub(ctx, &service.ScrubReq{})).Context(c)
+}
+
+// ListScrubReports ListScrubReports.
+func (f *FileServer) ListScrubReports(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.ListScrubReportsReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("list scrub reports").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	resp.Format(f.fileserver.ListScrubReports(ctx, req)).Context(c)
+}
+
+// SetQuota SetQuota.
+func (f *FileServer) SetQuota(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.SetQuotaReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("set quota").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	resp.Format(f.fileserver.SetQuota(ctx, req)).Context(c)
+}
+
+// RecountQuota RecountQuota.
+func (f *FileServer) RecountQuota(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	resp.Format(f.fileserver.RecountQuota(ctx, &service.RecountQuotaReq{})).Context(c)
+}
+
+// ListAudits ListAudits.
+func (f *FileServer) ListAudits(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.ListAuditsReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("list audits").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	resp.Format(f.fileserver.ListAudits(ctx, req)).Context(c)
+}
+
+// JobStats JobStats.
+func (f *FileServer) JobStats(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	resp.Format(f.fileserver.JobStats(ctx, &service.JobStatsReq{})).Context(c)
+}
+
+// Regenerate Regenerate.
+func (f *FileServer) Regenerate(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.RegenerateReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("regenerate").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	resp.Format(f.fileserver.Regenerate(ctx, req)).Context(c)
+}
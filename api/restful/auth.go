@@ -0,0 +1,216 @@
+package restful
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/cabin/tailormade/resp"
+	"github.com/quanxiang-cloud/fileserver/pkg/auth"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auth modes.
+const (
+	authJWT    = "jwt"
+	authHeader = "header"
+)
+
+const (
+	principalKey  = "fileserver.principal"
+	authorization = "Authorization"
+	bearer        = "Bearer "
+)
+
+var errNoIdentity = errors.New("no identity")
+
+// authenticate identifies the caller of the routes except the public ones.
+// The identity headers of the request are replaced by the authenticated principal.
+func authenticate(c *config.Config) (gin.HandlerFunc, error) {
+	a := &authenticator{
+		conf:   c.Auth,
+		public: make(map[string]struct{}, len(c.Auth.Public)),
+	}
+	for _, route := range c.Auth.Public {
+		a.public[route] = struct{}{}
+	}
+
+	switch c.Auth.Mode {
+	case authJWT:
+		jwt := c.Auth.JWT
+		verifier, err := auth.NewVerifier(jwt.JWKS, jwt.Issuer, jwt.Audience, jwt.Leeway, jwt.OptionalExp)
+		if err != nil {
+			return nil, err
+		}
+		a.verifier = verifier
+	case authHeader:
+	default:
+		return nil, errors.New("unknown auth mode " + c.Auth.Mode)
+	}
+
+	return a.handle, nil
+}
+
+type authenticator struct {
+	conf     config.Auth
+	verifier *auth.Verifier
+	public   map[string]struct{}
+}
+
+func (a *authenticator) handle(c *gin.Context) {
+	if _, ok := a.public[c.FullPath()]; ok {
+		c.Next()
+
+		return
+	}
+
+	var (
+		principal *auth.Principal
+		err       error
+	)
+	if a.verifier != nil {
+		principal, err = a.fromToken(c)
+	} else {
+		principal, err = a.fromHeader(c)
+	}
+	if err != nil {
+		ctx := header.MutateContext(c)
+		logger.Logger.WithName("authenticate").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		c.Abort()
+		resp.Format(nil, error2.New(code.ErrUnauthorized)).Context(c, http.StatusUnauthorized)
+
+		return
+	}
+
+	h := c.Request.Header
+	h.Set(operator.UserID, principal.UserID)
+	h.Set(operator.UserName, principal.UserName)
+	h.Set(operator.TenantID, principal.TenantID)
+	h.Set(operator.AppID, principal.AppID)
+	c.Set(principalKey, principal)
+
+	c.Next()
+}
+
+func (a *authenticator) fromToken(c *gin.Context) (*auth.Principal, error) {
+	token := c.GetHeader(authorization)
+	if !strings.HasPrefix(token, bearer) {
+		return nil, errNoIdentity
+	}
+
+	claims, err := a.verifier.Verify(strings.TrimPrefix(token, bearer))
+	if err != nil {
+		return nil, err
+	}
+
+	names := a.conf.JWT.Claims
+	if names.User == "" {
+		names.User = "sub"
+	}
+	principal := &auth.Principal{
+		UserID:   claims.String(names.User),
+		UserName: claims.String(names.UserName),
+		TenantID: claims.String(names.Tenant),
+		AppID:    claims.String(names.App),
+		Roles:    claims.Strings(names.Roles),
+	}
+	if principal.UserID == "" {
+		return nil, errNoIdentity
+	}
+
+	return principal, nil
+}
+
+// fromHeader trusts the identity headers set by the gateway.
+func (a *authenticator) fromHeader(c *gin.Context) (*auth.Principal, error) {
+	op := operator.FromRequest(c)
+	if op.UserID == "" {
+		return nil, errNoIdentity
+	}
+
+	principal := &auth.Principal{
+		UserID:   op.UserID,
+		UserName: op.UserName,
+		TenantID: op.TenantID,
+		AppID:    op.AppID,
+	}
+	if a.conf.RolesHeader != "" {
+		for _, role := range strings.Split(c.GetHeader(a.conf.RolesHeader), ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				principal.Roles = append(principal.Roles, role)
+			}
+		}
+	}
+
+	return principal, nil
+}
+
+// authorize reports whether the caller may perform action on the path of bucket/key of the apis,
+// the request is rejected with 403 otherwise. The policies match the resource the path resolves to,
+// which is the bucket type followed by the key stored, prefixed with the tenant if keys are namespaced.
+func (f *FileServer) authorize(c *gin.Context, action, p string) bool {
+	if f.policy == nil {
+		return true
+	}
+
+	resource := path.Clean(strings.TrimPrefix(p, "/"))
+	if strings.HasSuffix(p, "/") {
+		resource += "/"
+	}
+
+	// the unknown buckets match no resource
+	bucket, key := utils.Split(resource, "/")
+	resource = f.bucketTypes[bucket] + "/"
+	if f.tenantNamespace {
+		// the requests without tenant are rejected as the service does
+		resource += c.GetHeader(operator.TenantID) + "/"
+	}
+
+	return f.authorizeResource(c, action, resource+key)
+}
+
+// authorizeResource reports whether the caller may perform action on resource, which is matched by the policies as is,
+// the request is rejected with 403 otherwise.
+func (f *FileServer) authorizeResource(c *gin.Context, action, resource string) bool {
+	if f.policy == nil {
+		return true
+	}
+
+	// only the public routes are served without principal
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return true
+	}
+
+	principal, _ := value.(*auth.Principal)
+	if principal != nil && f.policy.Allowed(principal, action, resource) {
+		return true
+	}
+
+	ctx := header.MutateContext(c)
+	logger.Logger.WithName("authorize").Infow("forbidden",
+		append(header.GetRequestIDKV(ctx).Fuzzy(), "action", action, "resource", resource)...)
+	resp.Format(nil, error2.New(code.ErrForbidden)).Context(c, http.StatusForbidden)
+
+	return false
+}
+
+// authorizeAdmin allows the callers with the admin action on all resources.
+func (f *FileServer) authorizeAdmin(c *gin.Context) {
+	if !f.authorizeResource(c, auth.Admin, "*") {
+		c.Abort()
+
+		return
+	}
+
+	c.Next()
+}
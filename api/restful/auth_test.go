@@ -0,0 +1,69 @@
+package restful
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quanxiang-cloud/fileserver/pkg/auth"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	policy := auth.NewPolicy([]config.Policy{
+		{
+			Effect:     auth.Allow,
+			Principals: []string{"*"},
+			Actions:    []string{auth.Read, auth.Write, auth.Delete},
+			Resources:  []string{"private/{tenant}/*", "readable/{tenant}/*"},
+		},
+	})
+	bucketTypes := map[string]string{
+		"files-private":  "private",
+		"files-readable": "readable",
+	}
+	alice := &auth.Principal{UserID: "alice", TenantID: "t1"}
+
+	tests := []struct {
+		name      string
+		namespace bool
+		tenant    string
+		path      string
+		allowed   bool
+	}{
+		{"bucket name", false, "t1", "files-private/t1/a.png", true},
+		{"other tenant", false, "t1", "files-private/t2/a.png", false},
+		{"bucket type is not a bucket name", false, "t1", "private/t1/a.png", false},
+		{"dot dot", false, "t1", "files-private/t1/../t2/a.png", false},
+		{"namespaced", true, "t1", "files-readable/a.png", true},
+		{"namespaced path of other tenant", true, "t1", "files-private/t2/a.png", true},
+		{"namespaced without tenant", true, "", "files-private/t1/a.png", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &FileServer{
+				policy:          policy,
+				bucketTypes:     bucketTypes,
+				tenantNamespace: tt.namespace,
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.Header.Set(operator.TenantID, tt.tenant)
+			c.Set(principalKey, alice)
+
+			if got := f.authorize(c, auth.Read, tt.path); got != tt.allowed {
+				t.Errorf("authorize(%q) = %v, want %v", tt.path, got, tt.allowed)
+			}
+			if !tt.allowed && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -2,18 +2,21 @@ package restful
 
 import (
 	"net/http"
+	"path"
 
 	"github.com/quanxiang-cloud/cabin/logger"
 	"github.com/quanxiang-cloud/cabin/tailormade/header"
 	"github.com/quanxiang-cloud/cabin/tailormade/resp"
 	"github.com/quanxiang-cloud/fileserver/internal/service"
+	"github.com/quanxiang-cloud/fileserver/pkg/auth"
+	"github.com/quanxiang-cloud/fileserver/pkg/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Compress Compress.
 func (f *FileServer) Compress(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -23,15 +26,21 @@ func (f *FileServer) Compress(c *gin.Context) {
 		return
 	}
 
+	appID := c.PostForm("appID")
+	// the assets of custom page are stored under the app, without the tenant namespace
+	if !f.authorizeResource(c, auth.Write, storage.Private+"/"+appID+"/") {
+		return
+	}
+
 	resp.Format(f.fileserver.CompressFile(ctx, &service.CompressReq{
 		FileHeader: file,
-		AppID:      c.PostForm("appID"),
+		AppID:      appID,
 	})).Context(c, http.StatusOK)
 }
 
 // Blob Blob.
 func (f *FileServer) Blob(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.BoCompressFileReq{}
 	if err := c.ShouldBindUri(req); err != nil {
@@ -41,6 +50,10 @@ func (f *FileServer) Blob(c *gin.Context) {
 		return
 	}
 
+	if !f.authorizeResource(c, auth.Read, storage.Private+"/"+path.Join(req.AppID, req.Digest, req.FileName)) {
+		return
+	}
+
 	res, err := f.fileserver.BoCompressFile(ctx, req)
 	if err != nil {
 		resp.Format(nil, err).Context(c, http.StatusNotFound)
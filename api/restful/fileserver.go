@@ -2,12 +2,18 @@ package restful
 
 import (
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/quanxiang-cloud/cabin/logger"
 	"github.com/quanxiang-cloud/cabin/tailormade/header"
 	"github.com/quanxiang-cloud/cabin/tailormade/resp"
 	"github.com/quanxiang-cloud/fileserver/internal/service"
+	"github.com/quanxiang-cloud/fileserver/pkg/auth"
+	"github.com/quanxiang-cloud/fileserver/pkg/mime"
 	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +21,14 @@ import (
 // FileServer file service.
 type FileServer struct {
 	fileserver service.FileServer
+	// policy is nil if the authorization is disabled.
+	policy *auth.Policy
+	// buckets the names of the configured buckets.
+	buckets []string
+	// bucketTypes the types of the configured buckets by name, which the policies match.
+	bucketTypes map[string]string
+	// tenantNamespace the keys are prefixed with the tenant of the caller.
+	tenantNamespace bool
 }
 
 // NewFileServer new a fileserver.
@@ -24,14 +38,28 @@ func NewFileServer(conf *config.Config) (*FileServer, error) {
 		return nil, err
 	}
 
-	return &FileServer{
-		fileserver: fileserver,
-	}, nil
+	f := &FileServer{
+		fileserver:      fileserver,
+		bucketTypes:     make(map[string]string, len(conf.Buckets)),
+		tenantNamespace: conf.Namespace.Tenant,
+	}
+	for typ, bucket := range conf.Buckets {
+		if bucket != "" {
+			f.buckets = append(f.buckets, bucket)
+			f.bucketTypes[bucket] = typ
+		}
+	}
+	sort.Strings(f.buckets)
+	if conf.Auth.Enable {
+		f.policy = auth.NewPolicy(conf.Auth.Policies)
+	}
+
+	return f, nil
 }
 
 // DelFile delete file.
 func (f *FileServer) DelFile(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.DelUploadFileReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -41,12 +69,16 @@ func (f *FileServer) DelFile(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Delete, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.DelUploadFile(ctx, req)).Context(c)
 }
 
 // Thumbnail Thumbnail.
 func (f *FileServer) Thumbnail(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.ThumbnailReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -56,12 +88,25 @@ func (f *FileServer) Thumbnail(c *gin.Context) {
 		return
 	}
 
-	resp.Format(f.fileserver.Thumbnail(ctx, req)).Context(c)
+	// the thumbnail is written next to the image
+	if !f.authorize(c, auth.Read, req.Path) || !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
+	res, err := f.fileserver.Thumbnail(ctx, req)
+	if err == nil && res.JobID != "" {
+		// the thumbnail of a large image is generated in background
+		resp.Format(res, nil).Context(c, http.StatusAccepted)
+
+		return
+	}
+
+	resp.Format(res, err).Context(c)
 }
 
 // Domain Domain.
 func (f *FileServer) Domain(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.DomainReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -73,3 +118,142 @@ func (f *FileServer) Domain(c *gin.Context) {
 
 	resp.Format(f.fileserver.Domain(ctx, req)).Context(c)
 }
+
+// Image Image.
+func (f *FileServer) Image(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.ImageReq{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		logger.Logger.WithName("image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+	req.Path = strings.TrimPrefix(c.Param("path"), "/")
+	req.IfNoneMatch = c.GetHeader("If-None-Match")
+
+	if !f.authorize(c, auth.Read, req.Path) {
+		return
+	}
+
+	res, err := f.fileserver.Image(ctx, req)
+	if err != nil {
+		resp.Format(nil, err).Context(c)
+
+		return
+	}
+
+	c.Header("ETag", res.ETag)
+	c.Header("Cache-Control", res.CacheControl)
+	if res.NotModified {
+		c.Status(http.StatusNotModified)
+
+		return
+	}
+	defer res.Body.Close()
+
+	// the derivatives are served from the origin of the api, svg is downloaded in a sandbox
+	// in case a browser runs what the sanitizing misses
+	c.Header("X-Content-Type-Options", "nosniff")
+	if res.ContentType == mime.DetectFileExt(utils.FormatSVG) {
+		c.Header("Content-Security-Policy", "sandbox")
+		c.Header("Content-Disposition", "attachment")
+	}
+
+	c.DataFromReader(http.StatusOK, res.ContentLength, res.ContentType, res.Body, nil)
+}
+
+// GetJob GetJob.
+func (f *FileServer) GetJob(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.GetJobReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("get job").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	// the job is visible to the callers who may read its file
+	job, err := f.fileserver.GetJob(ctx, req)
+	if err == nil && !f.authorize(c, auth.Read, job.Path) {
+		return
+	}
+
+	resp.Format(job, err).Context(c)
+}
+
+// Stat Stat.
+func (f *FileServer) Stat(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.StatReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("stat").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	if !f.authorize(c, auth.Read, req.Path) {
+		return
+	}
+
+	resp.Format(f.fileserver.Stat(ctx, req)).Context(c)
+}
+
+// Search Search.
+func (f *FileServer) Search(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.SearchReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("search").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	// the files of the tenant of the caller are searched,
+	// which must be readable in the searched buckets, only admins may search without tenant
+	tenantID := c.GetHeader(operator.TenantID)
+	if tenantID == "" {
+		if !f.authorizeResource(c, auth.Admin, "*") {
+			return
+		}
+	} else {
+		buckets := f.buckets
+		if req.Bucket != "" {
+			buckets = []string{req.Bucket}
+		}
+		for _, bucket := range buckets {
+			if !f.authorizeResource(c, auth.Read, f.bucketTypes[bucket]+"/"+tenantID+"/") {
+				return
+			}
+		}
+	}
+
+	resp.Format(f.fileserver.Search(ctx, req)).Context(c)
+}
+
+// Usage Usage.
+func (f *FileServer) Usage(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.UsageReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("usage").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	// the usage of the app and the tenant of the caller, only admins may query other apps
+	if req.AppID != "" && req.AppID != c.GetHeader(operator.AppID) && !f.authorizeResource(c, auth.Admin, "*") {
+		return
+	}
+
+	resp.Format(f.fileserver.Usage(ctx, req)).Context(c)
+}
@@ -1,6 +1,7 @@
 package restful
 
 import (
+	"context"
 	"net/http"
 
 	error2 "github.com/quanxiang-cloud/cabin/error"
@@ -8,10 +9,18 @@ import (
 	"github.com/quanxiang-cloud/cabin/tailormade/header"
 	"github.com/quanxiang-cloud/cabin/tailormade/resp"
 	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
 
 	"github.com/gin-gonic/gin"
 )
 
+// mutateContext carries the request id, timezone, tenant and operator of the request.
+func mutateContext(c *gin.Context) context.Context {
+	ctx := header.MutateContext(c)
+
+	return operator.WithContext(ctx, operator.FromRequest(c))
+}
+
 // checkSize check upload file stream size.
 func checkSize(maxSize int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,118 @@
+package restful
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	redis2 "github.com/quanxiang-cloud/cabin/tailormade/db/redis"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/cabin/tailormade/resp"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/internal/models/redis"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rate limit keys.
+const (
+	rateLimitTenant = "tenant"
+	rateLimitApp    = "app"
+	rateLimitUser   = "user"
+)
+
+// rateLimit limits the requests of a caller to a route by token buckets in redis.
+// The requests are let through if redis is unavailable.
+func rateLimit(c *config.Config) (gin.HandlerFunc, error) {
+	redisClient, err := redis2.NewClient(c.Redis)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := &rateLimiter{
+		conf: c.RateLimit,
+		repo: redis.NewRateLimitRepo(redisClient),
+	}
+
+	return limiter.handle, nil
+}
+
+type rateLimiter struct {
+	conf config.RateLimit
+	repo models.RateLimitRepo
+}
+
+func (r *rateLimiter) handle(c *gin.Context) {
+	route := c.FullPath()
+	rate, ok := r.conf.Routes[route]
+	if !ok {
+		rate = r.conf.Default
+	}
+	if route == "" || rate.Rate <= 0 {
+		c.Next()
+
+		return
+	}
+
+	burst := rate.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	ctx := header.MutateContext(c)
+	allowed, wait, err := r.repo.Take(ctx, route+":"+r.caller(c), rate.Rate, burst)
+	if err != nil {
+		logger.Logger.WithName("rate limit").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		c.Next()
+
+		return
+	}
+
+	if !allowed {
+		logger.Logger.WithName("rate limit").Infow("too many requests",
+			append(header.GetRequestIDKV(ctx).Fuzzy(), "route", route)...)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.Abort()
+		resp.Format(nil, error2.New(code.ErrTooManyRequests)).Context(c, http.StatusTooManyRequests)
+
+		return
+	}
+
+	c.Next()
+}
+
+// caller identifies the caller by the configured headers.
+func (r *rateLimiter) caller(c *gin.Context) string {
+	op := operator.FromRequest(c)
+
+	ids := make([]string, 0, len(r.conf.Keys))
+	identified := false
+	for _, key := range r.conf.Keys {
+		var id string
+		switch key {
+		case rateLimitTenant:
+			id = op.TenantID
+		case rateLimitApp:
+			id = op.AppID
+		case rateLimitUser:
+			id = op.UserID
+		default:
+			continue
+		}
+
+		identified = identified || id != ""
+		ids = append(ids, id)
+	}
+
+	if !identified {
+		return "ip:" + op.IP
+	}
+
+	return strings.Join(ids, ":")
+}
@@ -41,9 +41,14 @@ func NewRouter(c *config.Config) (*Router, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	middlewares, err := newMiddlewares(c)
+	if err != nil {
+		return nil, err
+	}
 	routerGroup := map[string]*gin.RouterGroup{
-		basePath: e.Group("/api/v1"),
-		signPath: e.Group("/api/v1/fileserver"),
+		basePath: e.Group("/api/v1", middlewares...),
+		signPath: e.Group("/api/v1/fileserver", middlewares...),
 	}
 
 	for _, f := range routers {
@@ -76,6 +81,29 @@ func newRouter(c *config.Config) (*gin.Engine, error) {
 	return engine, nil
 }
 
+// newMiddlewares returns the middlewares of the api routes,
+// the callers are authenticated before they are rate limited.
+func newMiddlewares(c *config.Config) ([]gin.HandlerFunc, error) {
+	middlewares := make([]gin.HandlerFunc, 0, 2)
+	if c.Auth.Enable {
+		authenticate, err := authenticate(c)
+		if err != nil {
+			return nil, err
+		}
+		middlewares = append(middlewares, authenticate)
+	}
+
+	if c.RateLimit.Enable {
+		limit, err := rateLimit(c)
+		if err != nil {
+			return nil, err
+		}
+		middlewares = append(middlewares, limit)
+	}
+
+	return middlewares, nil
+}
+
 func fileserverRouter(c *config.Config, r map[string]*gin.RouterGroup) error {
 	fileserver, err := NewFileServer(c)
 	if err != nil {
@@ -86,11 +114,16 @@ func fileserverRouter(c *config.Config, r map[string]*gin.RouterGroup) error {
 	{
 		// custom page
 		base.POST("/compress", checkSize(c.MaxSize), fileserver.Compress)
-		base.POST("/blob/:appID/:md5/*fileName", fileserver.Blob)
+		base.POST("/blob/:appID/:digest/*fileName", fileserver.Blob)
 
 		base.POST("/del", fileserver.DelFile)
 		base.POST("/thumbnail", fileserver.Thumbnail)
+		base.GET("/image/*path", fileserver.Image)
+		base.POST("/job/get", fileserver.GetJob)
 		base.POST("/domain", fileserver.Domain)
+		base.POST("/stat", fileserver.Stat)
+		base.POST("/search", fileserver.Search)
+		base.POST("/quota/usage", fileserver.Usage)
 	}
 
 	sign := r[signPath].Group("/sign")
@@ -98,11 +131,24 @@ func fileserverRouter(c *config.Config, r map[string]*gin.RouterGroup) error {
 		sign.POST("/upload", fileserver.PresignedUpload)
 		sign.POST("/download", fileserver.PresignedDownload)
 		sign.POST("/uploadMultipart", fileserver.PresignedMultipart)
+		sign.POST("/uploadMultipartBatch", fileserver.PresignedMultipartBatch)
 		sign.POST("/initMultipart", fileserver.InitMultipartUpload)
 		sign.POST("/listMultipart", fileserver.ListMultiParts)
 		sign.POST("/completeMultipart", fileserver.CompleteMultiParts)
 		sign.POST("/abortMultipart", fileserver.AbortMultipartUpload)
 		sign.POST("/finish", fileserver.Finish)
+		sign.POST("/precheck", fileserver.Precheck)
+	}
+
+	admin := r[basePath].Group("/fileserver/admin", fileserver.authorizeAdmin)
+	{
+		admin.POST("/scrub", fileserver.Scrub)
+		admin.POST("/scrub/list", fileserver.ListScrubReports)
+		admin.POST("/quota/set", fileserver.SetQuota)
+		admin.POST("/quota/recount", fileserver.RecountQuota)
+		admin.POST("/audit/list", fileserver.ListAudits)
+		admin.POST("/job/stats", fileserver.JobStats)
+		admin.POST("/derivative/regenerate", fileserver.Regenerate)
 	}
 
 	return nil
@@ -7,13 +7,14 @@ import (
 	"github.com/quanxiang-cloud/cabin/tailormade/header"
 	"github.com/quanxiang-cloud/cabin/tailormade/resp"
 	"github.com/quanxiang-cloud/fileserver/internal/service"
+	"github.com/quanxiang-cloud/fileserver/pkg/auth"
 
 	"github.com/gin-gonic/gin"
 )
 
 // PresignedUpload PresignedUpload.
 func (f *FileServer) PresignedUpload(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.PresignedUploadReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -23,12 +24,16 @@ func (f *FileServer) PresignedUpload(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.PresignedUpload(ctx, req)).Context(c)
 }
 
 // PresignedDownload PresignedDownload.
 func (f *FileServer) PresignedDownload(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.PresignedDownloadReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -38,12 +43,16 @@ func (f *FileServer) PresignedDownload(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Read, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.PresignedDownload(ctx, req)).Context(c)
 }
 
 // InitMultipartUpload InitMultipartUpload.
 func (f *FileServer) InitMultipartUpload(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.InitMultipartUploadReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -53,12 +62,16 @@ func (f *FileServer) InitMultipartUpload(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.InitMultipartUpload(ctx, req)).Context(c)
 }
 
 // PresignedMultipart PresignedMultipart.
 func (f *FileServer) PresignedMultipart(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.PresignedMultipartReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -68,12 +81,35 @@ func (f *FileServer) PresignedMultipart(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.PresignedMultipart(ctx, req)).Context(c)
 }
 
+// PresignedMultipartBatch PresignedMultipartBatch.
+func (f *FileServer) PresignedMultipartBatch(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.PresignedMultipartBatchReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("presigned multipart batch").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
+	resp.Format(f.fileserver.PresignedMultipartBatch(ctx, req)).Context(c)
+}
+
 // ListMultiParts ListMultiParts.
 func (f *FileServer) ListMultiParts(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.ListMultiPartsReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -83,12 +119,16 @@ func (f *FileServer) ListMultiParts(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.ListMultiParts(ctx, req)).Context(c)
 }
 
 // CompleteMultiParts CompleteMultiParts.
 func (f *FileServer) CompleteMultiParts(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.CompleteMultiPartsReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -98,12 +138,16 @@ func (f *FileServer) CompleteMultiParts(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.CompleteMultiParts(ctx, req)).Context(c)
 }
 
 // AbortMultipartUpload AbortMultipartUpload.
 func (f *FileServer) AbortMultipartUpload(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.AbortMultipartUploadReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -113,12 +157,16 @@ func (f *FileServer) AbortMultipartUpload(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.AbortMultipartUpload(ctx, req)).Context(c)
 }
 
 // Finish Finish.
 func (f *FileServer) Finish(c *gin.Context) {
-	ctx := header.MutateContext(c)
+	ctx := mutateContext(c)
 
 	req := &service.FinishReq{}
 	if err := c.ShouldBind(req); err != nil {
@@ -128,5 +176,28 @@ func (f *FileServer) Finish(c *gin.Context) {
 		return
 	}
 
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
 	resp.Format(f.fileserver.Finish(ctx, req)).Context(c)
 }
+
+// Precheck Precheck.
+func (f *FileServer) Precheck(c *gin.Context) {
+	ctx := mutateContext(c)
+
+	req := &service.PrecheckReq{}
+	if err := c.ShouldBind(req); err != nil {
+		logger.Logger.WithName("precheck").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		resp.Format(nil, err).Context(c, http.StatusBadRequest)
+
+		return
+	}
+
+	if !f.authorize(c, auth.Write, req.Path) {
+		return
+	}
+
+	resp.Format(f.fileserver.Precheck(ctx, req)).Context(c)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"os"
 	"os/signal"
@@ -9,27 +11,36 @@ import (
 
 	"github.com/quanxiang-cloud/cabin/logger"
 	"github.com/quanxiang-cloud/fileserver/api/restful"
+	"github.com/quanxiang-cloud/fileserver/internal/service"
 	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
 )
 
 var (
 	configPath      string
+	storeName       string
 	accessKeyID     string
 	secretAccessKey string
 	endpoint        string
 	region          string
 	urlExpire       time.Duration
 	partExpire      time.Duration
+	reconcile       bool
+	repair          bool
+	backfill        bool
 )
 
 func main() {
 	flag.StringVar(&configPath, "config", "../configs/config.yml", "config file path")
+	flag.StringVar(&storeName, "storeName", "default", "name of storage profile")
 	flag.StringVar(&accessKeyID, "accesskey", "", "access key id")
 	flag.StringVar(&secretAccessKey, "secretkey", "", "secret access key")
 	flag.StringVar(&endpoint, "endpoint", "", "endpoint")
 	flag.StringVar(&region, "region", "", "region")
 	flag.DurationVar(&urlExpire, "urlExpire", 10*time.Minute, "url expire")
 	flag.DurationVar(&partExpire, "partExpire", 24*time.Hour, "part expire")
+	flag.BoolVar(&reconcile, "reconcile", false, "reconcile the fileserver table with storage once and exit")
+	flag.BoolVar(&repair, "repair", false, "delete the orphans found by reconcile")
+	flag.BoolVar(&backfill, "backfill", false, "fill the metadata of the files uploaded before metadata once and exit")
 	flag.Parse()
 	conf, err := config.NewConfig(configPath)
 	if err != nil {
@@ -37,6 +48,7 @@ func main() {
 	}
 
 	conf.Storage = config.Storage{
+		Name:            storeName,
 		AccessKeyID:     accessKeyID,
 		SecretAccessKey: secretAccessKey,
 		Endpoint:        endpoint,
@@ -50,6 +62,16 @@ func main() {
 		panic(err)
 	}
 
+	if reconcile {
+		runReconcile(conf)
+		return
+	}
+
+	if backfill {
+		runBackfill(conf)
+		return
+	}
+
 	// start restful
 	router, err := restful.NewRouter(conf)
 	if err != nil {
@@ -71,3 +93,41 @@ func main() {
 		}
 	}
 }
+
+func runReconcile(conf *config.Config) {
+	fileserver, err := service.NewFileServer(conf)
+	if err != nil {
+		panic(err)
+	}
+
+	resp, err := fileserver.Reconcile(context.Background(), &service.ReconcileReq{
+		Repair: repair,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func runBackfill(conf *config.Config) {
+	fileserver, err := service.NewFileServer(conf)
+	if err != nil {
+		panic(err)
+	}
+
+	resp, err := fileserver.Backfill(context.Background(), &service.BackfillReq{})
+	if err != nil {
+		panic(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(resp); err != nil {
+		panic(err)
+	}
+}
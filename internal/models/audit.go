@@ -0,0 +1,65 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// audited operations
+const (
+	AuditSignUpload        = "sign_upload"
+	AuditSignDownload      = "sign_download"
+	AuditInitMultipart     = "init_multipart"
+	AuditSignPart          = "sign_part"
+	AuditCompleteMultipart = "complete_multipart"
+	AuditAbortMultipart    = "abort_multipart"
+	AuditFinish            = "finish"
+	AuditPrecheck          = "precheck"
+	AuditThumbnail         = "thumbnail"
+	AuditImage             = "image"
+	AuditDelete            = "delete"
+	AuditPublish           = "publish"
+)
+
+// audit results
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// Audit a file operation, audits are never updated or deleted.
+type Audit struct {
+	ID        string `gorm:"column:id"`
+	Operation string `gorm:"column:operation"`
+	// Path the path requested, which is bucket/key.
+	Path      string `gorm:"column:path"`
+	UserID    string `gorm:"column:user_id"`
+	UserName  string `gorm:"column:user_name"`
+	TenantID  string `gorm:"column:tenant_id"`
+	AppID     string `gorm:"column:app_id"`
+	IP        string `gorm:"column:ip"`
+	RequestID string `gorm:"column:request_id"`
+	Result    string `gorm:"column:result"`
+	// Error the error of the failed operation.
+	Error    string `gorm:"column:error"`
+	CreateAt int64  `gorm:"column:create_at"`
+}
+
+// AuditQuery conditions of querying audits, zero values are ignored.
+type AuditQuery struct {
+	Operation string
+	// Path prefix of the path.
+	Path      string
+	UserID    string
+	TenantID  string
+	AppID     string
+	RequestID string
+	// From and To unix timestamps, To is exclusive.
+	From int64
+	To   int64
+}
+
+// AuditRepo audit logical interface
+type AuditRepo interface {
+	Create(db *gorm.DB, audit *Audit) error
+	List(db *gorm.DB, query *AuditQuery, page, limit int) ([]*Audit, int64, error)
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Blob content addressed object, shared by the files with the same digest.
+type Blob struct {
+	ID     string `gorm:"column:id"`
+	Digest string `gorm:"column:digest"`
+	Bucket string `gorm:"column:bucket"`
+	// Path the key of object in storage.
+	Path string `gorm:"column:path"`
+	Size int64  `gorm:"column:size"`
+	// Number the number of files referencing the blob.
+	Number   int   `gorm:"column:number"`
+	CreateAt int64 `gorm:"column:create_at"`
+	UpdateAt int64 `gorm:"column:update_at"`
+}
+
+// BlobRepo blob logical interface
+type BlobRepo interface {
+	Get(db *gorm.DB, id string) (*Blob, error)
+	GetByDigest(db *gorm.DB, bucket, digest string) (*Blob, error)
+	// Lock gets the blob of digest and locks it until the transaction of db ends.
+	Lock(db *gorm.DB, bucket, digest string) (*Blob, error)
+	// List lists blobs ordered by id after the given id.
+	List(db *gorm.DB, afterID string, limit int) ([]*Blob, error)
+	Create(db *gorm.DB, blob *Blob) error
+	// Upsert creates the blob, or references the existing blob of the same digest instead.
+	Upsert(db *gorm.DB, blob *Blob) error
+	Delete(db *gorm.DB, id string) error
+	// DeleteReleased deletes the blob if it is no longer referenced, and reports whether it is deleted.
+	DeleteReleased(db *gorm.DB, id string) (bool, error)
+	UpdateNumber(db *gorm.DB, id string, number int) error
+}
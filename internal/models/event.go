@@ -0,0 +1,47 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// event types
+const (
+	EventFileUploaded       = "file.uploaded"
+	EventFileDeleted        = "file.deleted"
+	EventMultipartCompleted = "multipart.completed"
+	EventThumbnailCreated   = "thumbnail.created"
+	EventPagePublished      = "page.published"
+)
+
+// event status, the delivered events are deleted.
+const (
+	EventPending = 0
+	EventFailed  = 1
+)
+
+// Event an event to be delivered to a sink, such as a webhook.
+// An event emitted to several sinks has a row per sink sharing the event id.
+type Event struct {
+	ID      string `gorm:"column:id"`
+	EventID string `gorm:"column:event_id"`
+	Sink    string `gorm:"column:sink"`
+	Type    string `gorm:"column:type"`
+	// Payload the json encoded event.
+	Payload  string `gorm:"column:payload"`
+	Status   int    `gorm:"column:status"`
+	Attempts int    `gorm:"column:attempts"`
+	// NextAt the unix timestamp of the next attempt.
+	NextAt   int64  `gorm:"column:next_at"`
+	Error    string `gorm:"column:error"`
+	CreateAt int64  `gorm:"column:create_at"`
+	UpdateAt int64  `gorm:"column:update_at"`
+}
+
+// EventRepo event outbox logical interface
+type EventRepo interface {
+	Create(db *gorm.DB, events []*Event) error
+	// ListPending lists the pending events due before now in the order of creation.
+	ListPending(db *gorm.DB, now int64, limit int) ([]*Event, error)
+	Update(db *gorm.DB, event *Event) error
+	Delete(db *gorm.DB, id string) error
+}
@@ -10,17 +10,78 @@ const (
 	IncrementNumber = 1
 )
 
+// file status
+const (
+	// FileStatusUnknown the file is recorded before metadata, see Backfill.
+	FileStatusUnknown = 0
+	FileStatusNormal  = 1
+	// FileStatusBlocked the file is infected, its object is moved to the quarantine bucket.
+	FileStatusBlocked = 2
+)
+
 // FileServer corresponding structure of fileserver file service
 type FileServer struct {
-	ID       string `gorm:"column:id"`
-	Path     string `gorm:"column:path"`
-	CreateAt int64  `gorm:"column:create_at"`
-	UpdateAt int64  `gorm:"column:update_at"`
+	ID     string `gorm:"column:id"`
+	Bucket string `gorm:"column:bucket"`
+	Path   string `gorm:"column:path"`
+	// ParentID the file the derivative is generated from, empty if it is not a derivative.
+	ParentID string `gorm:"column:parent_id"`
+	// Variant the spec of the derivative, such as the preset or WxH of a thumbnail.
+	Variant string `gorm:"column:variant"`
+	Digest  string `gorm:"column:digest"`
+	// BlobID the shared object of the file, empty if the object is stored at path.
+	BlobID      string `gorm:"column:blob_id"`
+	Size        int64  `gorm:"column:size"`
+	ContentType string `gorm:"column:content_type"`
+	// FileName the original file name.
+	FileName   string `gorm:"column:file_name"`
+	UploaderID string `gorm:"column:uploader_id"`
+	TenantID   string `gorm:"column:tenant_id"`
+	AppID      string `gorm:"column:app_id"`
+	// StoreName the storage profile holding the object.
+	StoreName string `gorm:"column:store_name"`
+	Status    int    `gorm:"column:status"`
+	CreateAt  int64  `gorm:"column:create_at"`
+	UpdateAt  int64  `gorm:"column:update_at"`
+}
+
+// FileQuery conditions of searching files, zero values are ignored.
+type FileQuery struct {
+	TenantID   string
+	AppID      string
+	UploaderID string
+	Bucket     string
+	// ContentType prefix of the content type, such as "video/".
+	ContentType string
+	// FileName substring of the original file name.
+	FileName string
+	MinSize  int64
+	MaxSize  int64
+	// CreateFrom and CreateTo unix timestamps, CreateTo is exclusive.
+	CreateFrom int64
+	CreateTo   int64
+	// Sort the column to sort by, one of create_at, update_at, size and file_name.
+	Sort string
+	Desc bool
 }
 
 // FileServerRepo file service logical interface
 type FileServerRepo interface {
 	GetByPath(db *gorm.DB, path string) (*FileServer, error)
+	// GetByDigest returns the files of digest in the tenant,
+	// or those uploaded by the uploader if tenantID is empty.
+	GetByDigest(db *gorm.DB, digest, tenantID, uploaderID string) ([]*FileServer, error)
+	// ListByParent lists the derivatives of the file.
+	ListByParent(db *gorm.DB, parentID string) ([]*FileServer, error)
+	// ListByPrefix lists the files that are not derivatives under the key prefix of bucket,
+	// ordered by id after the given id.
+	ListByPrefix(db *gorm.DB, bucket, prefix, afterID string, limit int) ([]*FileServer, error)
+	// List lists files ordered by id after the given id.
+	List(db *gorm.DB, afterID string, limit int) ([]*FileServer, error)
+	Search(db *gorm.DB, query *FileQuery, page, limit int) ([]*FileServer, int64, error)
+	// Usage sums the files by owners of scope, see QuotaTenant and QuotaApp, blocked files are excluded.
+	Usage(db *gorm.DB, scope string) ([]*Usage, error)
 	Create(db *gorm.DB, fileserver *FileServer) error
+	Update(db *gorm.DB, fileserver *FileServer) error
 	Delete(db *gorm.DB, id string) error
 }
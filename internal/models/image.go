@@ -0,0 +1,28 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// ImageMeta metadata of an image file.
+type ImageMeta struct {
+	FileID string `gorm:"column:file_id"`
+	Width  int    `gorm:"column:width"`
+	Height int    `gorm:"column:height"`
+	// Format the decoded format, such as jpeg or png.
+	Format string `gorm:"column:format"`
+	// ColorModel the color model, such as ycbcr or rgba.
+	ColorModel string `gorm:"column:color_model"`
+	// Exif the json object of the exif tags by names.
+	Exif     string `gorm:"column:exif"`
+	CreateAt int64  `gorm:"column:create_at"`
+	UpdateAt int64  `gorm:"column:update_at"`
+}
+
+// ImageMetaRepo image metadata logical interface
+type ImageMetaRepo interface {
+	Get(db *gorm.DB, fileID string) (*ImageMeta, error)
+	// Save creates the metadata of the file, or replaces the existing one.
+	Save(db *gorm.DB, meta *ImageMeta) error
+	Delete(db *gorm.DB, fileID string) error
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// job types
+const (
+	JobThumbnail = "thumbnail"
+)
+
+// job status
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job a background job on a file, run by the worker pool.
+type Job struct {
+	ID   string
+	Type string
+	// Bucket and Key the file the job runs on.
+	Bucket string
+	Key    string
+	// Params the json encoded parameters of the job.
+	Params string
+	// the operator who requested the job
+	UserID   string
+	UserName string
+	TenantID string
+	AppID    string
+	Status   string
+	Attempts int
+	// Result the key of the file produced by the job.
+	Result   string
+	Error    string
+	CreateAt int64
+	UpdateAt int64
+}
+
+// JobRepo job queue shared by instances, the jobs expire after ttl.
+type JobRepo interface {
+	// Push saves the job and appends it to the queue.
+	Push(ctx context.Context, job *Job, ttl time.Duration) error
+	// Pop moves the first job in the queue to the processing list,
+	// it waits up to timeout and returns nil if there is none. The job is acknowledged by Ack once it ends.
+	Pop(ctx context.Context, timeout time.Duration) (*Job, error)
+	// Ack removes the job from the processing list.
+	Ack(ctx context.Context, id string) error
+	// Requeue moves the jobs in the processing list not updated since before back to the queue,
+	// which are left by the workers stopped while running them, and returns the number of them.
+	Requeue(ctx context.Context, before int64, ttl time.Duration) (int, error)
+	Get(ctx context.Context, id string) (*Job, error)
+	Save(ctx context.Context, job *Job, ttl time.Duration) error
+	// Len returns the number of jobs in the queue.
+	Len(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// LockRepo distributed lock, used to run background jobs on one instance.
+type LockRepo interface {
+	// Lock acquires the lock and returns the token of the holder, which is empty if it is held by another.
+	Lock(ctx context.Context, name string, expiration time.Duration) (string, error)
+	// Unlock releases the lock if it is still held by token,
+	// a lock expired and acquired by another is left to its new holder.
+	Unlock(ctx context.Context, name, token string) error
+}
@@ -0,0 +1,71 @@
+package mysql
+
+import (
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type audit struct{}
+
+// NewAuditRepo new AuditRepo
+func NewAuditRepo() models.AuditRepo {
+	return &audit{}
+}
+
+func (a *audit) TableName() string {
+	return "audit_log"
+}
+
+func (a *audit) Create(db *gorm.DB, audit *models.Audit) error {
+	return db.Table(a.TableName()).
+		Create(audit).
+		Error
+}
+
+func (a *audit) List(db *gorm.DB, query *models.AuditQuery, page, limit int) ([]*models.Audit, int64, error) {
+	ql := db.Table(a.TableName())
+	if query.Operation != "" {
+		ql = ql.Where("operation = ?", query.Operation)
+	}
+	if query.Path != "" {
+		ql = ql.Where("path LIKE ?", likeEscaper.Replace(query.Path)+"%")
+	}
+	if query.UserID != "" {
+		ql = ql.Where("user_id = ?", query.UserID)
+	}
+	if query.TenantID != "" {
+		ql = ql.Where("tenant_id = ?", query.TenantID)
+	}
+	if query.AppID != "" {
+		ql = ql.Where("app_id = ?", query.AppID)
+	}
+	if query.RequestID != "" {
+		ql = ql.Where("request_id = ?", query.RequestID)
+	}
+	if query.From > 0 {
+		ql = ql.Where("create_at >= ?", query.From)
+	}
+	if query.To > 0 {
+		ql = ql.Where("create_at < ?", query.To)
+	}
+
+	var total int64
+	err := ql.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	list := make([]*models.Audit, 0, limit)
+	err = ql.Order("create_at DESC").
+		Order("id").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&list).
+		Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return list, total, nil
+}
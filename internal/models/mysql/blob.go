@@ -0,0 +1,131 @@
+package mysql
+
+import (
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type blob struct{}
+
+// NewBlobRepo new BlobRepo
+func NewBlobRepo() models.BlobRepo {
+	return &blob{}
+}
+
+func (b *blob) TableName() string {
+	return "blob"
+}
+
+func (b *blob) Get(db *gorm.DB, id string) (*models.Blob, error) {
+	blob := new(models.Blob)
+
+	err := db.Table(b.TableName()).
+		Where("id = ?", id).
+		Find(blob).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if blob.ID == "" {
+		return nil, nil
+	}
+
+	return blob, nil
+}
+
+func (b *blob) GetByDigest(db *gorm.DB, bucket, digest string) (*models.Blob, error) {
+	blob := new(models.Blob)
+
+	err := db.Table(b.TableName()).
+		Where("bucket = ? AND digest = ?", bucket, digest).
+		Find(blob).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if blob.ID == "" {
+		return nil, nil
+	}
+
+	return blob, nil
+}
+
+func (b *blob) Lock(db *gorm.DB, bucket, digest string) (*models.Blob, error) {
+	blob := new(models.Blob)
+
+	err := db.Table(b.TableName()).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("bucket = ? AND digest = ?", bucket, digest).
+		Find(blob).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if blob.ID == "" {
+		return nil, nil
+	}
+
+	return blob, nil
+}
+
+func (b *blob) List(db *gorm.DB, afterID string, limit int) ([]*models.Blob, error) {
+	list := make([]*models.Blob, 0, limit)
+
+	err := db.Table(b.TableName()).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&list).
+		Error
+
+	return list, err
+}
+
+func (b *blob) Create(db *gorm.DB, blob *models.Blob) error {
+	return db.Table(b.TableName()).
+		Create(blob).
+		Error
+}
+
+func (b *blob) Upsert(db *gorm.DB, blob *models.Blob) error {
+	return db.Table(b.TableName()).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"number":    gorm.Expr("number + ?", models.IncrementNumber),
+				"update_at": blob.UpdateAt,
+			}),
+		}).
+		Create(blob).
+		Error
+}
+
+func (b *blob) Delete(db *gorm.DB, id string) error {
+	return db.Table(b.TableName()).
+		Where("id = ?", id).
+		Delete(&models.Blob{}).
+		Error
+}
+
+func (b *blob) DeleteReleased(db *gorm.DB, id string) (bool, error) {
+	result := db.Table(b.TableName()).
+		Where("id = ? AND number <= 0", id).
+		Delete(&models.Blob{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (b *blob) UpdateNumber(db *gorm.DB, id string, number int) error {
+	return db.Table(b.TableName()).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"number":    gorm.Expr("number + ?", number),
+			"update_at": time2.NowUnix(),
+		}).
+		Error
+}
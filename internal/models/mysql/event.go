@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type event struct{}
+
+// NewEventRepo new EventRepo
+func NewEventRepo() models.EventRepo {
+	return &event{}
+}
+
+func (e *event) TableName() string {
+	return "event_outbox"
+}
+
+func (e *event) Create(db *gorm.DB, events []*models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	return db.Table(e.TableName()).
+		Create(events).
+		Error
+}
+
+func (e *event) ListPending(db *gorm.DB, now int64, limit int) ([]*models.Event, error) {
+	list := make([]*models.Event, 0, limit)
+
+	err := db.Table(e.TableName()).
+		Where("status = ? AND next_at <= ?", models.EventPending, now).
+		Order("create_at").
+		Order("id").
+		Limit(limit).
+		Find(&list).
+		Error
+
+	return list, err
+}
+
+func (e *event) Update(db *gorm.DB, event *models.Event) error {
+	return db.Table(e.TableName()).
+		Where("id = ?", event.ID).
+		Updates(map[string]interface{}{
+			"status":    event.Status,
+			"attempts":  event.Attempts,
+			"next_at":   event.NextAt,
+			"error":     event.Error,
+			"update_at": event.UpdateAt,
+		}).
+		Error
+}
+
+func (e *event) Delete(db *gorm.DB, id string) error {
+	return db.Table(e.TableName()).
+		Where("id = ?", id).
+		Delete(&models.Event{}).
+		Error
+}
@@ -1,11 +1,32 @@
 package mysql
 
 import (
+	"strings"
+
 	"github.com/quanxiang-cloud/fileserver/internal/models"
 
 	"gorm.io/gorm"
 )
 
+// maxDigestFiles the maximum number of files returned by digest.
+const maxDigestFiles = 20
+
+// sortColumns the columns files can be sorted by.
+var sortColumns = map[string]struct{}{
+	"create_at": {},
+	"update_at": {},
+	"size":      {},
+	"file_name": {},
+}
+
+// ownerColumns the columns of quota owners.
+var ownerColumns = map[string]string{
+	models.QuotaTenant: "tenant_id",
+	models.QuotaApp:    "app_id",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type fileserver struct{}
 
 // NewFileServerRepo new FileServerRepo
@@ -35,22 +56,159 @@ func (f *fileserver) GetByPath(db *gorm.DB, path string) (*models.FileServer, er
 	return fileInfo, nil
 }
 
+func (f *fileserver) GetByDigest(db *gorm.DB, digest, tenantID, uploaderID string) ([]*models.FileServer, error) {
+	list := make([]*models.FileServer, 0)
+
+	db = db.Table(f.TableName()).
+		Where("digest = ?", digest)
+	if tenantID != "" {
+		db = db.Where("tenant_id = ?", tenantID)
+	} else {
+		db = db.Where("uploader_id = ?", uploaderID)
+	}
+
+	err := db.Limit(maxDigestFiles).
+		Find(&list).
+		Error
+
+	return list, err
+}
+
+func (f *fileserver) ListByParent(db *gorm.DB, parentID string) ([]*models.FileServer, error) {
+	list := make([]*models.FileServer, 0)
+
+	err := db.Table(f.TableName()).
+		Where("parent_id = ?", parentID).
+		Find(&list).
+		Error
+
+	return list, err
+}
+
+func (f *fileserver) ListByPrefix(db *gorm.DB, bucket, prefix, afterID string, limit int) ([]*models.FileServer, error) {
+	list := make([]*models.FileServer, 0, limit)
+
+	err := db.Table(f.TableName()).
+		Where("bucket = ? AND parent_id = '' AND id > ?", bucket, afterID).
+		Where("path LIKE ?", likeEscaper.Replace(prefix)+"%").
+		Order("id").
+		Limit(limit).
+		Find(&list).
+		Error
+
+	return list, err
+}
+
+func (f *fileserver) List(db *gorm.DB, afterID string, limit int) ([]*models.FileServer, error) {
+	list := make([]*models.FileServer, 0, limit)
+
+	err := db.Table(f.TableName()).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&list).
+		Error
+
+	return list, err
+}
+
+func (f *fileserver) Search(db *gorm.DB, query *models.FileQuery, page, limit int) ([]*models.FileServer, int64, error) {
+	ql := db.Table(f.TableName())
+	if query.TenantID != "" {
+		ql = ql.Where("tenant_id = ?", query.TenantID)
+	}
+	if query.AppID != "" {
+		ql = ql.Where("app_id = ?", query.AppID)
+	}
+	if query.UploaderID != "" {
+		ql = ql.Where("uploader_id = ?", query.UploaderID)
+	}
+	if query.Bucket != "" {
+		ql = ql.Where("bucket = ?", query.Bucket)
+	}
+	if query.ContentType != "" {
+		ql = ql.Where("content_type LIKE ?", likeEscaper.Replace(query.ContentType)+"%")
+	}
+	if query.FileName != "" {
+		ql = ql.Where("file_name LIKE ?", "%"+likeEscaper.Replace(query.FileName)+"%")
+	}
+	if query.MinSize > 0 {
+		ql = ql.Where("size >= ?", query.MinSize)
+	}
+	if query.MaxSize > 0 {
+		ql = ql.Where("size <= ?", query.MaxSize)
+	}
+	if query.CreateFrom > 0 {
+		ql = ql.Where("create_at >= ?", query.CreateFrom)
+	}
+	if query.CreateTo > 0 {
+		ql = ql.Where("create_at < ?", query.CreateTo)
+	}
+
+	var total int64
+	err := ql.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort := "create_at"
+	if _, ok := sortColumns[query.Sort]; ok {
+		sort = query.Sort
+	}
+	if query.Desc {
+		sort += " DESC"
+	}
+
+	list := make([]*models.FileServer, 0, limit)
+	err = ql.Order(sort).
+		Order("id").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&list).
+		Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return list, total, nil
+}
+
+func (f *fileserver) Usage(db *gorm.DB, scope string) ([]*models.Usage, error) {
+	list := make([]*models.Usage, 0)
+
+	column, ok := ownerColumns[scope]
+	if !ok {
+		return list, nil
+	}
+
+	err := db.Table(f.TableName()).
+		Select(column+" AS owner_id, SUM(size) AS bytes, COUNT(*) AS files").
+		Where(column+" <> '' AND status <> ?", models.FileStatusBlocked).
+		Group(column).
+		Find(&list).
+		Error
+
+	return list, err
+}
+
 func (f *fileserver) Create(db *gorm.DB, fileserver *models.FileServer) error {
 	return db.Table(f.TableName()).
 		Create(fileserver).
 		Error
 }
 
-func (f *fileserver) Delete(db *gorm.DB, id string) error {
+func (f *fileserver) Update(db *gorm.DB, fileserver *models.FileServer) error {
 	return db.Table(f.TableName()).
-		Where("id = ?", id).
-		Delete(&models.FileServer{}).
+		Where("id = ?", fileserver.ID).
+		Select("*").
+		Omit("id", "create_at").
+		Updates(fileserver).
 		Error
 }
 
-func (f *fileserver) UpdateNumber(db *gorm.DB, id string, number int) error {
+func (f *fileserver) Delete(db *gorm.DB, id string) error {
 	return db.Table(f.TableName()).
 		Where("id = ?", id).
-		Update("number", gorm.Expr("number+ ?", 1)).
+		Delete(&models.FileServer{}).
 		Error
 }
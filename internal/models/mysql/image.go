@@ -0,0 +1,55 @@
+package mysql
+
+import (
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type imageMeta struct{}
+
+// NewImageMetaRepo new ImageMetaRepo
+func NewImageMetaRepo() models.ImageMetaRepo {
+	return &imageMeta{}
+}
+
+func (i *imageMeta) TableName() string {
+	return "image_meta"
+}
+
+func (i *imageMeta) Get(db *gorm.DB, fileID string) (*models.ImageMeta, error) {
+	meta := new(models.ImageMeta)
+
+	err := db.Table(i.TableName()).
+		Where("file_id = ?", fileID).
+		Find(meta).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.FileID == "" {
+		return nil, nil
+	}
+
+	return meta, nil
+}
+
+func (i *imageMeta) Save(db *gorm.DB, meta *models.ImageMeta) error {
+	return db.Table(i.TableName()).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{
+				"width", "height", "format", "color_model", "exif", "update_at",
+			}),
+		}).
+		Create(meta).
+		Error
+}
+
+func (i *imageMeta) Delete(db *gorm.DB, fileID string) error {
+	return db.Table(i.TableName()).
+		Where("file_id = ?", fileID).
+		Delete(&models.ImageMeta{}).
+		Error
+}
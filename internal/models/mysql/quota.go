@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	id2 "github.com/quanxiang-cloud/cabin/id"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type quota struct{}
+
+// NewQuotaRepo new QuotaRepo
+func NewQuotaRepo() models.QuotaRepo {
+	return &quota{}
+}
+
+func (q *quota) TableName() string {
+	return "quota"
+}
+
+func (q *quota) Get(db *gorm.DB, scope, ownerID string) (*models.Quota, error) {
+	quota := new(models.Quota)
+
+	err := db.Table(q.TableName()).
+		Where("scope = ? AND owner_id = ?", scope, ownerID).
+		Find(quota).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if quota.ID == "" {
+		return nil, nil
+	}
+
+	return quota, nil
+}
+
+func (q *quota) AddUsage(db *gorm.DB, scope, ownerID string, bytes, files int64) error {
+	now := time2.NowUnix()
+
+	return db.Table(q.TableName()).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"used_bytes": gorm.Expr("used_bytes + ?", bytes),
+				"used_files": gorm.Expr("used_files + ?", files),
+				"update_at":  now,
+			}),
+		}).
+		Create(&models.Quota{
+			ID:        id2.StringUUID(),
+			Scope:     scope,
+			OwnerID:   ownerID,
+			UsedBytes: bytes,
+			UsedFiles: files,
+			CreateAt:  now,
+			UpdateAt:  now,
+		}).
+		Error
+}
+
+func (q *quota) AddUsageWithin(db *gorm.DB, scope, ownerID string, bytes, files, hardBytes, hardFiles int64) (bool, error) {
+	// the quota is created first, so that the conditional update always finds it
+	err := q.AddUsage(db, scope, ownerID, 0, 0)
+	if err != nil {
+		return false, err
+	}
+
+	const (
+		bytesLimit = "COALESCE(NULLIF(hard_bytes, 0), ?)"
+		filesLimit = "COALESCE(NULLIF(hard_files, 0), ?)"
+	)
+	result := db.Table(q.TableName()).
+		Where("scope = ? AND owner_id = ?", scope, ownerID).
+		Where(bytesLimit+" = 0 OR used_bytes + ? <= "+bytesLimit, hardBytes, bytes, hardBytes).
+		Where(filesLimit+" = 0 OR used_files + ? <= "+filesLimit, hardFiles, files, hardFiles).
+		Updates(map[string]interface{}{
+			"used_bytes": gorm.Expr("used_bytes + ?", bytes),
+			"used_files": gorm.Expr("used_files + ?", files),
+			"update_at":  time2.NowUnix(),
+		})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (q *quota) SetLimit(db *gorm.DB, quota *models.Quota) error {
+	return db.Table(q.TableName()).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{
+				"soft_bytes", "hard_bytes", "soft_files", "hard_files", "update_at",
+			}),
+		}).
+		Create(quota).
+		Error
+}
+
+func (q *quota) ResetUsage(db *gorm.DB) error {
+	return db.Table(q.TableName()).
+		Where("1 = 1").
+		Updates(map[string]interface{}{
+			"used_bytes": 0,
+			"used_files": 0,
+			"update_at":  time2.NowUnix(),
+		}).
+		Error
+}
@@ -0,0 +1,53 @@
+package mysql
+
+import (
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type scrubReport struct{}
+
+// NewScrubReportRepo new ScrubReportRepo
+func NewScrubReportRepo() models.ScrubReportRepo {
+	return &scrubReport{}
+}
+
+func (s *scrubReport) TableName() string {
+	return "scrub_report"
+}
+
+func (s *scrubReport) Create(db *gorm.DB, report *models.ScrubReport) error {
+	return db.Table(s.TableName()).
+		Create(report).
+		Error
+}
+
+func (s *scrubReport) DeleteByFileID(db *gorm.DB, fileID string) error {
+	return db.Table(s.TableName()).
+		Where("file_id = ?", fileID).
+		Delete(&models.ScrubReport{}).
+		Error
+}
+
+func (s *scrubReport) List(db *gorm.DB, page, limit int) ([]*models.ScrubReport, int64, error) {
+	var total int64
+	list := make([]*models.ScrubReport, 0, limit)
+
+	ql := db.Table(s.TableName())
+	err := ql.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = ql.Order("create_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&list).
+		Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return list, total, nil
+}
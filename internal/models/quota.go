@@ -0,0 +1,50 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// quota scopes
+const (
+	QuotaTenant = "tenant"
+	QuotaApp    = "app"
+)
+
+// Quota usage and limits of a tenant or an app.
+// A zero limit falls back to the default of the scope in config.
+type Quota struct {
+	ID    string `gorm:"column:id"`
+	Scope string `gorm:"column:scope"`
+	// OwnerID the tenant id or the app id.
+	OwnerID   string `gorm:"column:owner_id"`
+	SoftBytes int64  `gorm:"column:soft_bytes"`
+	HardBytes int64  `gorm:"column:hard_bytes"`
+	SoftFiles int64  `gorm:"column:soft_files"`
+	HardFiles int64  `gorm:"column:hard_files"`
+	UsedBytes int64  `gorm:"column:used_bytes"`
+	UsedFiles int64  `gorm:"column:used_files"`
+	CreateAt  int64  `gorm:"column:create_at"`
+	UpdateAt  int64  `gorm:"column:update_at"`
+}
+
+// Usage storage used by a tenant or an app.
+type Usage struct {
+	OwnerID string `gorm:"column:owner_id"`
+	Bytes   int64  `gorm:"column:bytes"`
+	Files   int64  `gorm:"column:files"`
+}
+
+// QuotaRepo quota logical interface
+type QuotaRepo interface {
+	Get(db *gorm.DB, scope, ownerID string) (*Quota, error)
+	// AddUsage adds the deltas to the usage, the quota is created if not exists.
+	AddUsage(db *gorm.DB, scope, ownerID string, bytes, files int64) error
+	// AddUsageWithin adds the positive deltas to the usage only if the hard limits are not exceeded,
+	// and reports whether they are added. A zero limit of quota falls back to the given default,
+	// and a zero default means unlimited.
+	AddUsageWithin(db *gorm.DB, scope, ownerID string, bytes, files, hardBytes, hardFiles int64) (bool, error)
+	// SetLimit sets the limits of quota, the quota is created if not exists.
+	SetLimit(db *gorm.DB, quota *Quota) error
+	// ResetUsage clears the usage of all quotas.
+	ResetUsage(db *gorm.DB) error
+}
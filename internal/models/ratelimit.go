@@ -0,0 +1,13 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimitRepo token buckets shared by instances.
+type RateLimitRepo interface {
+	// Take takes a token from the bucket of key, which is refilled by rate tokens per second up to burst.
+	// If there is no token, it returns false and the time to wait for the next one.
+	Take(ctx context.Context, key string, rate float64, burst int64) (bool, time.Duration, error)
+}
@@ -0,0 +1,139 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+)
+
+// requeueScript moves the job back to the queue only if it is still in the processing list,
+// so that a job requeued by several instances is queued once.
+var requeueScript = redis.NewScript(`
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call("LPUSH", KEYS[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+type jobRepo struct {
+	c *redis.ClusterClient
+}
+
+func (j *jobRepo) Key(id string) string {
+	return fmt.Sprintf("%s:%s", jobKey, id)
+}
+
+// NewJobRepo NewJobRepo
+func NewJobRepo(c *redis.ClusterClient) models.JobRepo {
+	return &jobRepo{
+		c: c,
+	}
+}
+
+func (j *jobRepo) Push(ctx context.Context, job *models.Job, ttl time.Duration) error {
+	err := j.Save(ctx, job, ttl)
+	if err != nil {
+		return err
+	}
+
+	return j.c.LPush(ctx, jobQueueKey, job.ID).Err()
+}
+
+func (j *jobRepo) Pop(ctx context.Context, timeout time.Duration) (*models.Job, error) {
+	id, err := j.c.BRPopLPush(ctx, jobQueueKey, jobProcessingKey, timeout).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the job may have expired
+	job, err := j.Get(ctx, id)
+	if err == nil && job == nil {
+		err = j.Ack(ctx, id)
+	}
+
+	return job, err
+}
+
+func (j *jobRepo) Ack(ctx context.Context, id string) error {
+	return j.c.LRem(ctx, jobProcessingKey, 1, id).Err()
+}
+
+func (j *jobRepo) Requeue(ctx context.Context, before int64, ttl time.Duration) (int, error) {
+	ids, err := j.c.LRange(ctx, jobProcessingKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, id := range ids {
+		job, err := j.Get(ctx, id)
+		if err != nil {
+			return requeued, err
+		}
+		if job != nil && job.UpdateAt >= before {
+			continue
+		}
+
+		if job == nil {
+			err = j.Ack(ctx, id)
+			if err != nil {
+				return requeued, err
+			}
+
+			continue
+		}
+
+		job.Status = models.JobPending
+		err = j.Save(ctx, job, ttl)
+		if err != nil {
+			return requeued, err
+		}
+
+		moved, err := requeueScript.Run(ctx, j.c, []string{jobProcessingKey, jobQueueKey}, id).Int()
+		if err != nil {
+			return requeued, err
+		}
+		requeued += moved
+	}
+
+	return requeued, nil
+}
+
+func (j *jobRepo) Get(ctx context.Context, id string) (*models.Job, error) {
+	s, err := j.c.Get(ctx, j.Key(id)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.Job{}
+	err = json.Unmarshal([]byte(s), job)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (j *jobRepo) Save(ctx context.Context, job *models.Job, ttl time.Duration) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return j.c.SetEX(ctx, j.Key(job.ID), b, ttl).Err()
+}
+
+func (j *jobRepo) Len(ctx context.Context) (int64, error) {
+	return j.c.LLen(ctx, jobQueueKey).Result()
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	id2 "github.com/quanxiang-cloud/cabin/id"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+)
+
+// unlockScript deletes the lock only if it is held by the token.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type lockRepo struct {
+	c *redis.ClusterClient
+}
+
+func (l *lockRepo) Key(name string) string {
+	return fmt.Sprintf("%s:%s", lockKey, name)
+}
+
+// NewLockRepo NewLockRepo
+func NewLockRepo(c *redis.ClusterClient) models.LockRepo {
+	return &lockRepo{
+		c: c,
+	}
+}
+
+func (l *lockRepo) Lock(ctx context.Context, name string, expiration time.Duration) (string, error) {
+	key := l.Key(name)
+	token := id2.StringUUID()
+
+	ok, err := l.c.SetNX(ctx, key, token, expiration).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (l *lockRepo) Unlock(ctx context.Context, name, token string) error {
+	key := l.Key(name)
+
+	return unlockScript.Run(ctx, l.c, []string{key}, token).Err()
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+)
+
+// tokenBucket refills the bucket by the elapsed time and takes a token.
+// KEYS[1] bucket, ARGV[1] rate per second, ARGV[2] burst, ARGV[3] now in milliseconds.
+// It returns whether a token is taken and the milliseconds to wait otherwise.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+end
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(math.max(now, ts)))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+
+return {allowed, wait}
+`)
+
+type rateLimitRepo struct {
+	c *redis.ClusterClient
+}
+
+func (r *rateLimitRepo) Key(key string) string {
+	return fmt.Sprintf("%s:%s", rateLimitKey, key)
+}
+
+// NewRateLimitRepo NewRateLimitRepo
+func NewRateLimitRepo(c *redis.ClusterClient) models.RateLimitRepo {
+	return &rateLimitRepo{
+		c: c,
+	}
+}
+
+func (r *rateLimitRepo) Take(ctx context.Context, key string, rate float64, burst int64) (bool, time.Duration, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	result, err := tokenBucket.Run(ctx, r.c, []string{r.Key(key)}, rate, burst, now).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
@@ -1,5 +1,11 @@
 package redis
 
 const (
-	redisKey = "fileserver:multipart"
+	redisKey     = "fileserver:multipart"
+	lockKey      = "fileserver:lock"
+	rateLimitKey = "fileserver:ratelimit"
+	jobKey       = "fileserver:job"
+	// the queue and the processing list share a hash slot, the jobs are moved between them atomically.
+	jobQueueKey      = "fileserver:{jobqueue}"
+	jobProcessingKey = "fileserver:{jobqueue}:processing"
 )
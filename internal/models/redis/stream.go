@@ -0,0 +1,28 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+)
+
+type streamRepo struct {
+	c *redis.ClusterClient
+}
+
+// NewStreamRepo NewStreamRepo
+func NewStreamRepo(c *redis.ClusterClient) models.StreamRepo {
+	return &streamRepo{
+		c: c,
+	}
+}
+
+func (s *streamRepo) Add(ctx context.Context, stream string, maxLen int64, fields map[string]interface{}) (string, error) {
+	return s.c.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: maxLen > 0,
+		Values: fields,
+	}).Result()
+}
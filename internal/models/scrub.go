@@ -0,0 +1,34 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// scrub status
+const (
+	ScrubMissing = "missing"
+	ScrubCorrupt = "corrupt"
+)
+
+// ScrubReport object found broken by the scrubber.
+type ScrubReport struct {
+	ID     string `gorm:"column:id"`
+	FileID string `gorm:"column:file_id"`
+	Path   string `gorm:"column:path"`
+	Bucket string `gorm:"column:bucket"`
+	// Key the key of object in storage.
+	Key string `gorm:"column:key"`
+	// Digest the digest recorded at upload.
+	Digest string `gorm:"column:digest"`
+	// Actual the digest computed by the scrubber, empty if the object is missing.
+	Actual   string `gorm:"column:actual"`
+	Status   string `gorm:"column:status"`
+	CreateAt int64  `gorm:"column:create_at"`
+}
+
+// ScrubReportRepo scrub report logical interface
+type ScrubReportRepo interface {
+	Create(db *gorm.DB, report *ScrubReport) error
+	DeleteByFileID(db *gorm.DB, fileID string) error
+	List(db *gorm.DB, page, limit int) ([]*ScrubReport, int64, error)
+}
@@ -0,0 +1,11 @@
+package models
+
+import (
+	"context"
+)
+
+// StreamRepo append-only message streams, such as redis streams.
+type StreamRepo interface {
+	// Add appends the message of fields to stream, which is trimmed approximately to maxLen if it is positive.
+	Add(ctx context.Context, stream string, maxLen int64, fields map[string]interface{}) (string, error)
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	id2 "github.com/quanxiang-cloud/cabin/id"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+)
+
+// maxAuditError the maximum length of the error recorded.
+const maxAuditError = 255
+
+// auditor records the file operations of fileserver.
+type auditor struct {
+	FileServer
+	f *fileserver
+
+	// file the json lines file, nil if disabled.
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newAuditor(f *fileserver) (*auditor, error) {
+	a := &auditor{
+		FileServer: f,
+		f:          f,
+	}
+
+	if f.conf.Audit.File != "" {
+		file, err := os.OpenFile(f.conf.Audit.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		a.file = file
+	}
+
+	return a, nil
+}
+
+// record records the operation on path, a failed record does not fail the operation.
+func (a *auditor) record(ctx context.Context, operation, path string, err error) {
+	op := operator.FromContext(ctx)
+	_, requestID := header.GetRequestIDKV(ctx).Wreck()
+
+	audit := &models.Audit{
+		ID:        id2.StringUUID(),
+		Operation: operation,
+		Path:      path,
+		UserID:    op.UserID,
+		UserName:  op.UserName,
+		TenantID:  op.TenantID,
+		AppID:     op.AppID,
+		IP:        op.IP,
+		RequestID: requestID,
+		Result:    models.AuditSuccess,
+		CreateAt:  time2.NowUnix(),
+	}
+	if err != nil {
+		audit.Result = models.AuditFailure
+		audit.Error = err.Error()
+		if len(audit.Error) > maxAuditError {
+			audit.Error = audit.Error[:maxAuditError]
+		}
+	}
+
+	if err := a.f.auditRepo.Create(a.f.db, audit); err != nil {
+		logger.Logger.WithName("audit").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+
+	if a.file != nil {
+		if err := a.write(newAuditRecord(audit)); err != nil {
+			logger.Logger.WithName("audit").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+	}
+}
+
+func (a *auditor) write(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(line, '\n'))
+
+	return err
+}
+
+func (a *auditor) PresignedUpload(ctx context.Context, req *PresignedUploadReq) (*PresignedUploadResp, error) {
+	resp, err := a.FileServer.PresignedUpload(ctx, req)
+	a.record(ctx, models.AuditSignUpload, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) PresignedDownload(ctx context.Context, req *PresignedDownloadReq) (*PresignedDownloadResp, error) {
+	resp, err := a.FileServer.PresignedDownload(ctx, req)
+	a.record(ctx, models.AuditSignDownload, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) InitMultipartUpload(ctx context.Context, req *InitMultipartUploadReq) (*InitMultipartUploadResp, error) {
+	resp, err := a.FileServer.InitMultipartUpload(ctx, req)
+	a.record(ctx, models.AuditInitMultipart, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) PresignedMultipart(ctx context.Context, req *PresignedMultipartReq) (*PresignedMultipartResp, error) {
+	resp, err := a.FileServer.PresignedMultipart(ctx, req)
+	a.record(ctx, models.AuditSignPart, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) PresignedMultipartBatch(ctx context.Context, req *PresignedMultipartBatchReq) (*PresignedMultipartBatchResp, error) {
+	resp, err := a.FileServer.PresignedMultipartBatch(ctx, req)
+	a.record(ctx, models.AuditSignPart, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) CompleteMultiParts(ctx context.Context, req *CompleteMultiPartsReq) (*CompleteMultiPartsResp, error) {
+	resp, err := a.FileServer.CompleteMultiParts(ctx, req)
+	a.record(ctx, models.AuditCompleteMultipart, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) AbortMultipartUpload(ctx context.Context, req *AbortMultipartUploadReq) (*AbortMultipartUploadResp, error) {
+	resp, err := a.FileServer.AbortMultipartUpload(ctx, req)
+	a.record(ctx, models.AuditAbortMultipart, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) Finish(ctx context.Context, req *FinishReq) (*FinishResp, error) {
+	resp, err := a.FileServer.Finish(ctx, req)
+	a.record(ctx, models.AuditFinish, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) Precheck(ctx context.Context, req *PrecheckReq) (*PrecheckResp, error) {
+	resp, err := a.FileServer.Precheck(ctx, req)
+	a.record(ctx, models.AuditPrecheck, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) Thumbnail(ctx context.Context, req *ThumbnailReq) (*ThumbnailResp, error) {
+	resp, err := a.FileServer.Thumbnail(ctx, req)
+	a.record(ctx, models.AuditThumbnail, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) Image(ctx context.Context, req *ImageReq) (*ImageResp, error) {
+	resp, err := a.FileServer.Image(ctx, req)
+	a.record(ctx, models.AuditImage, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) DelUploadFile(ctx context.Context, req *DelUploadFileReq) (*DelUploadFileResp, error) {
+	resp, err := a.FileServer.DelUploadFile(ctx, req)
+	a.record(ctx, models.AuditDelete, req.Path, err)
+
+	return resp, err
+}
+
+func (a *auditor) CompressFile(ctx context.Context, req *CompressReq) (*CompressResp, error) {
+	resp, err := a.FileServer.CompressFile(ctx, req)
+
+	// the custom page is published at the url of its index
+	path := req.FileHeader.Filename
+	if resp != nil {
+		path = resp.URL
+	}
+	a.record(ctx, models.AuditPublish, path, err)
+
+	return resp, err
+}
+
+// AuditRecord AuditRecord.
+type AuditRecord struct {
+	ID        string `json:"id"`
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	UserID    string `json:"userID"`
+	UserName  string `json:"userName"`
+	TenantID  string `json:"tenantID"`
+	AppID     string `json:"appID"`
+	IP        string `json:"ip"`
+	RequestID string `json:"requestID"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+	CreateAt  int64  `json:"createAt"`
+}
+
+func newAuditRecord(audit *models.Audit) *AuditRecord {
+	return &AuditRecord{
+		ID:        audit.ID,
+		Operation: audit.Operation,
+		Path:      audit.Path,
+		UserID:    audit.UserID,
+		UserName:  audit.UserName,
+		TenantID:  audit.TenantID,
+		AppID:     audit.AppID,
+		IP:        audit.IP,
+		RequestID: audit.RequestID,
+		Result:    audit.Result,
+		Error:     audit.Error,
+		CreateAt:  audit.CreateAt,
+	}
+}
+
+// ListAuditsReq ListAuditsReq.
+type ListAuditsReq struct {
+	Operation string `json:"operation"`
+	// Path prefix of the path.
+	Path      string `json:"path"`
+	UserID    string `json:"userID"`
+	TenantID  string `json:"tenantID"`
+	AppID     string `json:"appID"`
+	RequestID string `json:"requestID"`
+	// From and To unix timestamps, To is exclusive.
+	From  int64 `json:"from" binding:"gte=0"`
+	To    int64 `json:"to" binding:"gte=0"`
+	Page  int   `json:"page" binding:"gte=0"`
+	Limit int   `json:"limit" binding:"gte=0,lte=1000"`
+}
+
+// ListAuditsResp ListAuditsResp.
+type ListAuditsResp struct {
+	Total  int64          `json:"total"`
+	Audits []*AuditRecord `json:"audits"`
+}
+
+func (f *fileserver) ListAudits(ctx context.Context, req *ListAuditsReq) (*ListAuditsResp, error) {
+	page, limit := pagination(req.Page, req.Limit)
+
+	list, total, err := f.auditRepo.List(f.db, &models.AuditQuery{
+		Operation: req.Operation,
+		Path:      req.Path,
+		UserID:    req.UserID,
+		TenantID:  req.TenantID,
+		AppID:     req.AppID,
+		RequestID: req.RequestID,
+		From:      req.From,
+		To:        req.To,
+	}, page, limit)
+	if err != nil {
+		logger.Logger.WithName("list audits").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrQuery)
+	}
+
+	audits := make([]*AuditRecord, 0, len(list))
+	for _, audit := range list {
+		audits = append(audits, newAuditRecord(audit))
+	}
+
+	return &ListAuditsResp{
+		Total:  total,
+		Audits: audits,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+)
+
+const (
+	backfillLock   = "backfill"
+	backfillBatch  = 500
+	backfillExpire = 24 * time.Hour
+)
+
+// BackfillReq BackfillReq.
+type BackfillReq struct{}
+
+// BackfillResp BackfillResp.
+type BackfillResp struct {
+	// Filled the number of files whose metadata are filled.
+	Filled int `json:"filled"`
+	// Missing files whose objects do not exist, they are left unknown.
+	Missing []*MissingObject `json:"missing"`
+}
+
+// Backfill fills the metadata of the files recorded before metadata
+// with HEAD requests to storage.
+func (f *fileserver) Backfill(ctx context.Context, req *BackfillReq) (*BackfillResp, error) {
+	token, err := f.lockRepo.Lock(ctx, backfillLock, backfillExpire)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, error2.New(code.ErrJobRunning)
+	}
+	defer f.lockRepo.Unlock(ctx, backfillLock, token)
+
+	resp := &BackfillResp{
+		Missing: make([]*MissingObject, 0),
+	}
+
+	var afterID string
+	for {
+		files, err := f.fileServerRepo.List(f.db, afterID, backfillBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		for _, file := range files {
+			afterID = file.ID
+			if file.Status != models.FileStatusUnknown {
+				continue
+			}
+
+			bucket, key, err := f.locate(file)
+			if errors.Is(err, errObjectNotFound) {
+				resp.Missing = append(resp.Missing, &MissingObject{
+					FileID: file.ID,
+					Path:   file.Path,
+				})
+
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			stat, err := f.storages.HeadObject(bucket, key)
+			if err != nil {
+				logger.Logger.WithName("backfill").Errorw(err.Error(), "path", file.Path)
+				resp.Missing = append(resp.Missing, &MissingObject{
+					FileID: file.ID,
+					Path:   file.Path,
+					Bucket: bucket,
+					Key:    key,
+				})
+
+				continue
+			}
+
+			file.Bucket = bucket
+			file.Size = stat.Size
+			file.ContentType = stat.ContentType
+			if file.FileName == "" {
+				file.FileName = filepath.Base(file.Path)
+			}
+			if file.StoreName == "" {
+				file.StoreName = f.conf.Storage.Name
+			}
+			file.Status = models.FileStatusNormal
+			file.UpdateAt = time2.NowUnix()
+
+			err = f.fileServerRepo.Update(f.db, file)
+			if err != nil {
+				return nil, err
+			}
+			resp.Filled++
+		}
+	}
+
+	// the usage is accounted by the sizes filled
+	err = f.recount()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Logger.WithName("backfill").Infow("backfill finished",
+		"filled", resp.Filled,
+		"missing", len(resp.Missing),
+	)
+
+	return resp, nil
+}
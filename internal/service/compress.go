@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"io/fs"
 	"mime/multipart"
@@ -11,10 +12,8 @@ import (
 	"strings"
 
 	error2 "github.com/quanxiang-cloud/cabin/error"
-	id2 "github.com/quanxiang-cloud/cabin/id"
 	"github.com/quanxiang-cloud/cabin/logger"
 	"github.com/quanxiang-cloud/cabin/tailormade/header"
-	time2 "github.com/quanxiang-cloud/cabin/time"
 	"github.com/quanxiang-cloud/fileserver/internal/models"
 	"github.com/quanxiang-cloud/fileserver/pkg/decompress"
 	"github.com/quanxiang-cloud/fileserver/pkg/mime"
@@ -35,13 +34,28 @@ type CompressResp struct {
 }
 
 func (f *fileserver) CompressFile(ctx context.Context, req *CompressReq) (*CompressResp, error) {
-	md5, err := utils.GetMD5ByMultipart(req.FileHeader)
+	// the assets are stored under the app
+	if req.AppID != "" && !validSegment(req.AppID) {
+		logger.Logger.WithName("compress file").Infow("invalid app id", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidPath)
+	}
+
+	digest, err := utils.GetSHA256ByMultipart(req.FileHeader)
 	if err != nil {
 		logger.Logger.WithName("compress file").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
 		return nil, error2.New(code.ErrUnarchive)
 	}
 
+	// only the archive is recorded, the extracted assets are not counted
+	archive := f.newFile(ctx, f.conf.Buckets[storage.Private], "", req.FileHeader.Filename, req.AppID)
+	archive.Size = req.FileHeader.Size
+	err = f.checkQuota(ctx, archive)
+	if err != nil {
+		return nil, err
+	}
+
 	ext := utils.GetExt(req.FileHeader.Filename)
 	extract, err := f.extract.GetDecompress(ext)
 	if err != nil {
@@ -63,7 +77,7 @@ func (f *fileserver) CompressFile(ctx context.Context, req *CompressReq) (*Compr
 	}
 
 	// unzip package
-	dst := filepath.Join(f.conf.Blob.TempPath, md5)
+	dst := filepath.Join(f.conf.Blob.TempPath, digest)
 	err = f.unarchive(ctx, req.FileHeader, extract, dst)
 	if err != nil {
 		return nil, error2.New(code.ErrUnarchive)
@@ -72,25 +86,46 @@ func (f *fileserver) CompressFile(ctx context.Context, req *CompressReq) (*Compr
 
 	path := utils.ExecuteURL(utils.Blob{
 		AppID:    req.AppID,
-		MD5:      md5,
+		Digest:   digest,
 		FileName: indexPath,
 	}, f.conf.Blob.Template)
 
+	err = f.scanAssets(ctx, dst, req, archive.Bucket, genArchiveName(path, req.FileHeader.Filename))
+	if err != nil {
+		return nil, err
+	}
+
 	f.eg.Go(func() error {
-		return f.uploadCompressFile(ctx, dst, req.AppID, md5)
+		return f.uploadCompressFile(ctx, dst, req.AppID, digest)
 	})
 
 	f.eg.Go(func() error {
-		return f.uploadArchive(ctx, req, path, md5)
+		return f.uploadArchive(ctx, req, path, digest)
 	})
 
 	err = f.eg.Wait()
 	if err != nil {
 		logger.Logger.WithName("compress upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
+		// the rejections of the assets are returned as they are
+		var e error2.Error
+		if errors.As(err, &e) {
+			return nil, e
+		}
+
 		return nil, error2.New(code.ErrUnarchive)
 	}
 
+	// the assets are published once all of them are uploaded
+	err = f.emit(ctx, f.db, models.EventPagePublished, &PageEvent{
+		URL:    path,
+		AppID:  req.AppID,
+		Digest: digest,
+	})
+	if err != nil {
+		logger.Logger.WithName("compress upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+
 	return &CompressResp{
 		URL: path,
 	}, nil
@@ -142,7 +177,7 @@ func (f *fileserver) unarchive(ctx context.Context, fileHeader *multipart.FileHe
 	return nil
 }
 
-func (f *fileserver) uploadCompressFile(ctx context.Context, dst, appID, md5 string) error {
+func (f *fileserver) uploadCompressFile(ctx context.Context, dst, appID, digest string) error {
 	blobTemplate := f.conf.Blob.Template
 	blobTemplatePath := f.conf.Blob.TempPath
 
@@ -153,6 +188,12 @@ func (f *fileserver) uploadCompressFile(ctx context.Context, dst, appID, md5 str
 		return error2.New(code.InvalidStorage)
 	}
 
+	// nothing is published unless all the assets pass
+	err := f.verifyAssets(ctx, dst, bucket, appID)
+	if err != nil {
+		return err
+	}
+
 	return filepath.Walk(dst, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			logger.Logger.WithName("upload compress file").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
@@ -168,7 +209,7 @@ func (f *fileserver) uploadCompressFile(ctx context.Context, dst, appID, md5 str
 		case strings.HasSuffix(info.Name(), ".htm"):
 			fallthrough
 		case strings.HasSuffix(info.Name(), ".html"):
-			obj := utils.Blob{AppID: appID, MD5: md5}
+			obj := utils.Blob{AppID: appID, Digest: digest}
 
 			buf, err := utils.ReplaceAttr(obj, blobTemplate, path, dst)
 			if err != nil {
@@ -195,7 +236,7 @@ func (f *fileserver) uploadCompressFile(ctx context.Context, dst, appID, md5 str
 	})
 }
 
-func (f *fileserver) uploadArchive(ctx context.Context, req *CompressReq, indexPath, md5 string) error {
+func (f *fileserver) uploadArchive(ctx context.Context, req *CompressReq, indexPath, digest string) error {
 	file, err := req.FileHeader.Open()
 	if err != nil {
 		logger.Logger.WithName("upload archive").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
@@ -222,14 +263,15 @@ func (f *fileserver) uploadArchive(ctx context.Context, req *CompressReq, indexP
 
 	contentType := mime.DetectFilePath(req.FileHeader.Filename)
 	tx := f.db.Begin()
-	newInfo := &models.FileServer{
-		ID:       id2.StringUUID(),
-		Path:     path,
-		CreateAt: time2.NowUnix(),
-		UpdateAt: time2.NowUnix(),
+	newInfo := f.newFile(ctx, bucket, path, req.FileHeader.Filename, req.AppID)
+	newInfo.Digest = digest
+	newInfo.Size = req.FileHeader.Size
+	newInfo.ContentType = contentType
+
+	err = f.createFile(tx, newInfo)
+	if err == nil {
+		err = f.emitFile(ctx, tx, models.EventFileUploaded, newInfo)
 	}
-
-	err = f.fileServerRepo.Create(tx, newInfo)
 	if err != nil {
 		tx.Rollback()
 
@@ -262,9 +304,10 @@ func genArchiveName(indexPath, oldArchiveName string) string {
 }
 
 // BoCompressFileReq BoCompressFileReq.
+// Digest is the sha256 of the archive, or md5 for the archives uploaded before.
 type BoCompressFileReq struct {
 	AppID    string `uri:"appID"`
-	MD5      string `uri:"md5"`
+	Digest   string `uri:"digest"`
 	FileName string `uri:"fileName"`
 }
 
@@ -282,10 +325,15 @@ func (f *fileserver) BoCompressFile(ctx context.Context, req *BoCompressFileReq)
 
 		return nil, error2.New(code.InvalidStorage)
 	}
+	if !validSegment(req.AppID) || !validSegment(req.Digest) || !validKey(strings.TrimPrefix(req.FileName, "/")) {
+		logger.Logger.WithName("BoCompressFile").Infow("invalid path", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidPath)
+	}
 
 	buffer := &bytes.Buffer{}
 
-	path := filepath.Join(req.AppID, req.MD5, req.FileName)
+	path := filepath.Join(req.AppID, req.Digest, req.FileName)
 	reader, err := f.storages.GetObject(bucket, path)
 	if err != nil {
 		logger.Logger.WithName("BoCompressFile").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
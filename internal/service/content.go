@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/fileserver/pkg/mime"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+)
+
+// sniff reads the leading bytes of r used to detect its content type.
+func sniff(r io.Reader) ([]byte, error) {
+	head := make([]byte, mime.SniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	return head[:n], nil
+}
+
+// sniffObject reads the leading bytes of the object.
+func (f *fileserver) sniffObject(bucket, key string) ([]byte, error) {
+	reader, err := f.storages.GetObject(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return sniff(reader)
+}
+
+// contentChecked reports whether the content types of uploads are checked.
+func (f *fileserver) contentChecked() bool {
+	return f.conf.Content.Verify || len(f.conf.Content.Policies) > 0
+}
+
+// verifyObject verifies the content of the uploaded object, see verifyContent.
+func (f *fileserver) verifyObject(ctx context.Context, bucket, key, fileName, declared string) error {
+	if !f.contentChecked() {
+		return nil
+	}
+
+	head, err := f.sniffObject(bucket, key)
+	if err != nil {
+		logger.Logger.WithName("verify content").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return error2.New(code.ErrUploadFile)
+	}
+
+	return f.verifyContent(ctx, bucket, f.externalKey(ctx, key), fileName, declared, head)
+}
+
+// verifyAssets verifies the content of the extracted files under dst, which are published to prefix of bucket.
+func (f *fileserver) verifyAssets(ctx context.Context, dst, bucket, prefix string) error {
+	if !f.contentChecked() {
+		return nil
+	}
+
+	return filepath.Walk(dst, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		head, err := sniff(file)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.Join(prefix, strings.Replace(path, f.conf.Blob.TempPath, "", 1))
+
+		return f.verifyContent(ctx, bucket, key, info.Name(), "", head)
+	})
+}
+
+// verifyContent detects the content type of the file by head, checks it against
+// the types declared by the name and the upload, and the content policy of the key.
+// key is the key seen by clients, without the tenant prefix.
+func (f *fileserver) verifyContent(ctx context.Context, bucket, key, fileName, declared string, head []byte) error {
+	detected := mime.DetectContent(head)
+	byName := mime.DetectFilePath(fileName)
+
+	if f.conf.Content.Verify && (!mime.Compatible(byName, detected) || !mime.Compatible(declared, detected)) {
+		logger.Logger.WithName("verify content").Infow("content type mismatch",
+			append(header.GetRequestIDKV(ctx).Fuzzy(), "key", key, "declared", declared, "name", byName, "detected", detected)...)
+
+		return error2.New(code.InvalidContentType)
+	}
+
+	policy := f.contentPolicy(bucket, key)
+	if policy == nil {
+		return nil
+	}
+
+	// the declared types are checked as well, they may be served as declared
+	types := []string{detected}
+	for _, t := range []string{byName, declared} {
+		if t != "" && !mime.IsDefault(t) {
+			types = append(types, t)
+		}
+	}
+	for _, t := range types {
+		if !contentAllowed(policy, t) {
+			logger.Logger.WithName("verify content").Infow("content type denied",
+				append(header.GetRequestIDKV(ctx).Fuzzy(), "key", key, "type", t)...)
+
+			return error2.New(code.ErrContentTypeDenied)
+		}
+	}
+
+	return nil
+}
+
+// contentPolicy returns the policy of the longest prefix matching the key of bucket.
+func (f *fileserver) contentPolicy(bucket, key string) *config.ContentPolicy {
+	var matched *config.ContentPolicy
+	for i := range f.conf.Content.Policies {
+		policy := &f.conf.Content.Policies[i]
+		if policy.Bucket != "*" && f.conf.Buckets[policy.Bucket] != bucket {
+			continue
+		}
+		if !strings.HasPrefix(key, policy.Prefix) {
+			continue
+		}
+
+		if matched == nil || len(policy.Prefix) > len(matched.Prefix) {
+			matched = policy
+		}
+	}
+
+	return matched
+}
+
+// contentAllowed reports whether the policy allows the content type.
+func contentAllowed(policy *config.ContentPolicy, contentType string) bool {
+	for _, pattern := range policy.Deny {
+		if mime.Match(pattern, contentType) {
+			return false
+		}
+	}
+
+	if len(policy.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range policy.Allow {
+		if mime.Match(pattern, contentType) {
+			return true
+		}
+	}
+
+	return false
+}
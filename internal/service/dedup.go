@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	id2 "github.com/quanxiang-cloud/cabin/id"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/storage"
+
+	"gorm.io/gorm"
+)
+
+const defaultBlobPrefix = "blobs"
+
+// dedupBucket reports whether the objects of bucket are stored once by digest.
+func (f *fileserver) dedupBucket(bucket string) bool {
+	for _, kind := range f.conf.Dedup.Buckets {
+		if name := f.conf.Buckets[kind]; name != "" && name == bucket {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *fileserver) blobPrefix() string {
+	if f.conf.Dedup.Prefix == "" {
+		return defaultBlobPrefix
+	}
+
+	return strings.Trim(f.conf.Dedup.Prefix, "/")
+}
+
+// blobKey returns the key of the object of a new blob, the id keeps a blob created again
+// from sharing the object of a released one, which is deleted after its transaction.
+func (f *fileserver) blobKey(digest, id string) string {
+	return path.Join(f.blobPrefix(), digest[:2], digest+"-"+id)
+}
+
+// reservedKey reports whether key is in the namespace of shared objects,
+// which can not be written by clients.
+func (f *fileserver) reservedKey(bucket, key string) bool {
+	return f.dedupBucket(bucket) && strings.HasPrefix(path.Clean(key), f.blobPrefix()+"/")
+}
+
+// objectKey returns the key of the object holding the content of file.
+func (f *fileserver) objectKey(info *models.FileServer) (string, error) {
+	if info.BlobID == "" {
+		return info.Path, nil
+	}
+
+	blob, err := f.blobRepo.Get(f.db, info.BlobID)
+	if err != nil {
+		return "", err
+	}
+
+	if blob == nil {
+		return "", error2.New(code.InvalidExist)
+	}
+
+	return blob.Path, nil
+}
+
+// errBlobReleased is returned if the blob of digest is released before it is referenced,
+// and there is no uploaded object to create it again.
+var errBlobReleased = errors.New("blob released")
+
+// newBlob copies the uploaded object of file to the key of a new blob,
+// the copy is made before the transaction referencing the blob.
+func (f *fileserver) newBlob(file *models.FileServer) (*models.Blob, error) {
+	id := id2.StringUUID()
+	blob := &models.Blob{
+		ID:       id,
+		Digest:   file.Digest,
+		Bucket:   file.Bucket,
+		Path:     f.blobKey(file.Digest, id),
+		Size:     file.Size,
+		Number:   1,
+		CreateAt: time2.NowUnix(),
+		UpdateAt: time2.NowUnix(),
+	}
+
+	err := f.storages.CopyObject(file.Bucket, file.Path, blob.Path)
+	if storage.IsNotExist(err) {
+		return nil, errBlobReleased
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return blob, nil
+}
+
+// dropBlob deletes the object of a new blob which is not referenced.
+func (f *fileserver) dropBlob(ctx context.Context, blob *models.Blob) {
+	if blob == nil {
+		return
+	}
+
+	err := f.storages.DeleteObject(blob.Bucket, blob.Path)
+	if err != nil {
+		logger.Logger.WithName("drop blob").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+}
+
+// refBlob references the blob of the digest of file with tx, the blob is locked until tx ends.
+// The candidate is created if there is no blob yet, or references the blob created by a concurrent upload.
+// Without candidate, errBlobReleased is returned if there is no blob.
+func (f *fileserver) refBlob(tx *gorm.DB, file *models.FileServer, candidate *models.Blob) (*models.Blob, error) {
+	if candidate != nil {
+		err := f.blobRepo.Upsert(tx, candidate)
+		if err != nil {
+			return nil, err
+		}
+
+		return f.blobRepo.Lock(tx, file.Bucket, file.Digest)
+	}
+
+	blob, err := f.blobRepo.Lock(tx, file.Bucket, file.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if blob == nil {
+		return nil, errBlobReleased
+	}
+
+	return blob, f.blobRepo.UpdateNumber(tx, blob.ID, models.IncrementNumber)
+}
+
+// unrefBlob releases the blob, and returns it if it is no longer referenced.
+// The blob is locked by the update until tx ends, so it can not be referenced meanwhile.
+// The caller deletes the object of the returned blob after tx is committed.
+func (f *fileserver) unrefBlob(tx *gorm.DB, id string) (*models.Blob, error) {
+	err := f.blobRepo.UpdateNumber(tx, id, models.ReduceNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := f.blobRepo.Get(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if blob == nil || blob.Number > 0 {
+		return nil, nil
+	}
+
+	deleted, err := f.blobRepo.DeleteReleased(tx, id)
+	if err != nil || !deleted {
+		return nil, err
+	}
+
+	return blob, nil
+}
+
+// finishDedup links the uploaded file with the blob of its content,
+// then removes the uploaded object.
+func (f *fileserver) finishDedup(ctx context.Context, file, info *models.FileServer) error {
+	var (
+		released *models.Blob
+		err      error
+	)
+	if info == nil || info.BlobID == "" || info.Digest != file.Digest {
+		released, err = f.linkBlob(ctx, file, info)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = f.storages.DeleteObject(file.Bucket, file.Path)
+	if err != nil {
+		logger.Logger.WithName("finish").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+
+	if released != nil {
+		err = f.storages.DeleteObject(released.Bucket, released.Path)
+		if err != nil {
+			logger.Logger.WithName("finish").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+	}
+
+	return nil
+}
+
+// linkBlob points the file to the blob of its digest, info is the recorded file at the same path.
+// It returns the blob released by the file.
+func (f *fileserver) linkBlob(ctx context.Context, file, info *models.FileServer) (*models.Blob, error) {
+	var candidate *models.Blob
+	blob, err := f.blobRepo.GetByDigest(f.db, file.Bucket, file.Digest)
+	if err == nil && blob == nil {
+		candidate, err = f.newBlob(file)
+	}
+	if err != nil {
+		return nil, f.linkBlobError(ctx, err)
+	}
+
+	tx := f.db.Begin()
+	blob, err = f.refBlob(tx, file, candidate)
+	if errors.Is(err, errBlobReleased) {
+		// the blob is released after it is read, it is created again
+		tx.Rollback()
+		candidate, err = f.newBlob(file)
+		if err != nil {
+			return nil, f.linkBlobError(ctx, err)
+		}
+
+		tx = f.db.Begin()
+		blob, err = f.refBlob(tx, file, candidate)
+	}
+	if err != nil {
+		tx.Rollback()
+		f.dropBlob(ctx, candidate)
+
+		return nil, f.linkBlobError(ctx, err)
+	}
+	if candidate != nil && candidate.ID != blob.ID {
+		// a concurrent upload created the blob first
+		f.dropBlob(ctx, candidate)
+		candidate = nil
+	}
+	file.BlobID = blob.ID
+
+	if info == nil {
+		err = f.createFile(tx, file)
+		if err == nil {
+			err = f.emitFile(ctx, tx, models.EventFileUploaded, file)
+		}
+		if err != nil {
+			tx.Rollback()
+			f.dropBlob(ctx, candidate)
+			logger.Logger.WithName("link blob").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, err
+		}
+		tx.Commit()
+
+		return nil, nil
+	}
+
+	var released *models.Blob
+	if info.BlobID != "" {
+		released, err = f.unrefBlob(tx, info.BlobID)
+		if err != nil {
+			tx.Rollback()
+			f.dropBlob(ctx, candidate)
+			logger.Logger.WithName("link blob").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, err
+		}
+	}
+
+	// the derivatives of the old content are stale
+	derivatives, err := f.removeDerivatives(ctx, tx, info)
+	if err == nil {
+		err = f.replaceFile(tx, info, file)
+	}
+	if err == nil {
+		err = f.emitFile(ctx, tx, models.EventFileUploaded, info)
+	}
+	if err != nil {
+		tx.Rollback()
+		f.dropBlob(ctx, candidate)
+		logger.Logger.WithName("link blob").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+	tx.Commit()
+	f.purgeDerivatives(ctx, derivatives)
+
+	return released, nil
+}
+
+func (f *fileserver) linkBlobError(ctx context.Context, err error) error {
+	if errors.Is(err, errBlobReleased) {
+		return err
+	}
+	logger.Logger.WithName("link blob").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+	return error2.New(code.ErrUploadFile)
+}
+
+// precheckDedup links the file to the blob of its digest without uploading,
+// and reports whether the blob exists and is referenced by a file the caller may read.
+func (f *fileserver) precheckDedup(ctx context.Context, file *models.FileServer) (bool, error) {
+	blob, err := f.blobRepo.GetByDigest(f.db, file.Bucket, file.Digest)
+	if err != nil {
+		logger.Logger.WithName("precheck").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return false, err
+	}
+
+	if blob == nil || blob.Size != file.Size {
+		return false, nil
+	}
+
+	sources, err := f.precheckSources(file)
+	if err != nil {
+		logger.Logger.WithName("precheck").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return false, err
+	}
+	if !referenced(sources, blob.ID) {
+		return false, nil
+	}
+
+	// the record may outlive a lost object, only link to an existing one
+	stat, err := f.storages.HeadObject(blob.Bucket, blob.Path)
+	if err != nil || stat.Size != file.Size {
+		return false, nil
+	}
+	file.ContentType = stat.ContentType
+
+	info, err := f.fileServerRepo.GetByPath(f.db, file.Path)
+	if err != nil {
+		logger.Logger.WithName("precheck").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return false, err
+	}
+
+	if info != nil && info.BlobID == blob.ID {
+		return true, nil
+	}
+
+	released, err := f.linkBlob(ctx, file, info)
+	if errors.Is(err, errBlobReleased) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if released != nil {
+		err = f.storages.DeleteObject(released.Bucket, released.Path)
+		if err != nil {
+			logger.Logger.WithName("precheck").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+	}
+
+	return true, nil
+}
+
+func referenced(files []*models.FileServer, blobID string) bool {
+	for _, file := range files {
+		if file.BlobID == blobID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/mime"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+
+	"gorm.io/gorm"
+)
+
+const regenerateBatch = 100
+
+// imageFile reports whether the file is an image, derivatives are generated for images only.
+func imageFile(file *models.FileServer) bool {
+	return strings.HasPrefix(fileContentType(file), "image/")
+}
+
+// svgFile reports whether the file is declared as svg, which is scaled as vector.
+func svgFile(file *models.FileServer) bool {
+	// the content type may carry parameters, such as charset
+	return strings.HasPrefix(fileContentType(file), mime.DetectFileExt(utils.FormatSVG))
+}
+
+// fileContentType returns the content type of the file, detected by its name if it is unknown.
+func fileContentType(file *models.FileServer) string {
+	if file.ContentType == "" || mime.IsDefault(file.ContentType) {
+		return mime.DetectFilePath(file.FileName)
+	}
+
+	return file.ContentType
+}
+
+// removeDerivatives deletes the records of the derivatives of file, and theirs, with tx.
+// It returns the removed derivatives, whose objects are deleted by purgeDerivatives once tx is committed.
+func (f *fileserver) removeDerivatives(ctx context.Context, tx *gorm.DB, file *models.FileServer) ([]*models.FileServer, error) {
+	list, err := f.fileServerRepo.ListByParent(tx, file.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]*models.FileServer, 0, len(list))
+	for _, derivative := range list {
+		err = f.deleteFile(tx, derivative)
+		if err == nil {
+			err = f.emitFile(ctx, tx, models.EventFileDeleted, derivative)
+		}
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, derivative)
+
+		children, err := f.removeDerivatives(ctx, tx, derivative)
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, children...)
+	}
+
+	return removed, nil
+}
+
+// purgeDerivatives deletes the objects of the removed derivatives,
+// a failed deletion only leaves an orphan object to the reconciliation.
+func (f *fileserver) purgeDerivatives(ctx context.Context, derivatives []*models.FileServer) {
+	for _, derivative := range derivatives {
+		err := f.storages.DeleteObject(derivative.Bucket, derivative.Path)
+		if err != nil {
+			logger.Logger.WithName("purge derivatives").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+	}
+}
+
+// RegenerateReq RegenerateReq.
+type RegenerateReq struct {
+	// Path the prefix of the original files, bucket/prefix,
+	// a trailing slash limits it to the directory.
+	Path string `json:"path" binding:"required"`
+}
+
+// RegenerateResp RegenerateResp.
+type RegenerateResp struct{}
+
+// Regenerate regenerates the derivatives of the images under the prefix in background,
+// the existing derivatives are removed and generated again with the configured presets.
+// The thumbnails generated before derivatives are recorded are linked to their originals first.
+func (f *fileserver) Regenerate(ctx context.Context, req *RegenerateReq) (*RegenerateResp, error) {
+	bucket, prefix, err := f.resolve(ctx, strings.TrimSuffix(req.Path, "/"))
+	if err != nil {
+		logger.Logger.WithName("regenerate").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+	if strings.HasSuffix(req.Path, "/") {
+		prefix += "/"
+	}
+
+	go f.regenerate(context.Background(), bucket, prefix)
+
+	return &RegenerateResp{}, nil
+}
+
+func (f *fileserver) regenerate(ctx context.Context, bucket, prefix string) {
+	f.linkLegacy(bucket, prefix)
+
+	var afterID string
+	files := 0
+	for {
+		list, err := f.fileServerRepo.ListByPrefix(f.db, bucket, prefix, afterID, regenerateBatch)
+		if err != nil {
+			logger.Logger.WithName("regenerate").Errorw(err.Error(), "prefix", prefix)
+
+			return
+		}
+
+		for _, file := range list {
+			if f.regenerateFile(ctx, file) {
+				files++
+			}
+		}
+
+		if len(list) < regenerateBatch {
+			break
+		}
+		afterID = list[len(list)-1].ID
+	}
+
+	logger.Logger.WithName("regenerate").Infow("regenerated", "bucket", bucket, "prefix", prefix, "files", files)
+}
+
+// regenerateFile removes the derivatives of the image and generates them again as its uploader,
+// it reports whether the file is an image.
+func (f *fileserver) regenerateFile(ctx context.Context, file *models.FileServer) bool {
+	if file.Status != models.FileStatusNormal || !imageFile(file) {
+		return false
+	}
+
+	// a legacy thumbnail whose original is not found, its thumbnails would be thumbnails of thumbnails
+	if _, ok := f.legacyVariant(file.Path); ok {
+		return false
+	}
+
+	ctx = operator.WithContext(ctx, &operator.Operator{
+		UserID:   file.UploaderID,
+		TenantID: file.TenantID,
+		AppID:    file.AppID,
+	})
+
+	tx := f.db.Begin()
+	derivatives, err := f.removeDerivatives(ctx, tx, file)
+	if err != nil {
+		tx.Rollback()
+		logger.Logger.WithName("regenerate").Errorw(err.Error(), "path", file.Path)
+
+		return true
+	}
+	tx.Commit()
+	f.purgeDerivatives(ctx, derivatives)
+
+	// the variants generated before and the configured presets,
+	// the derivatives of derivatives are not generated again
+	variants := make([]string, 0, len(derivatives)+len(f.conf.Jobs.Presets))
+	seen := make(map[string]struct{}, cap(variants))
+	for _, derivative := range derivatives {
+		if derivative.ParentID == file.ID && derivative.Variant != "" {
+			variants = append(variants, derivative.Variant)
+		}
+	}
+	variants = append(variants, f.conf.Jobs.Presets...)
+
+	for _, variant := range variants {
+		if _, ok := seen[variant]; ok {
+			continue
+		}
+		seen[variant] = struct{}{}
+
+		req, ok := f.variantReq(variant)
+		if !ok {
+			logger.Logger.WithName("regenerate").Infow("unknown variant", "path", file.Path, "variant", variant)
+
+			continue
+		}
+
+		if f.jobRepo != nil {
+			_, err = f.pushJob(ctx, models.JobThumbnail, file.Bucket, file.Path, req)
+		} else {
+			_, err = f.thumbnail(ctx, file.Bucket, file.Path, req, false)
+		}
+		if err != nil {
+			logger.Logger.WithName("regenerate").Errorw(err.Error(), "path", file.Path, "variant", variant)
+		}
+	}
+
+	return true
+}
+
+// linkLegacy links the thumbnails under the prefix generated before derivatives are recorded,
+// which have no parent, to their originals, so that they are regenerated with the originals.
+func (f *fileserver) linkLegacy(bucket, prefix string) {
+	var afterID string
+	files := 0
+	for {
+		list, err := f.fileServerRepo.ListByPrefix(f.db, bucket, prefix, afterID, regenerateBatch)
+		if err != nil {
+			logger.Logger.WithName("link legacy").Errorw(err.Error(), "prefix", prefix)
+
+			return
+		}
+
+		for _, file := range list {
+			original, variant, err := f.legacyOriginal(file)
+			if err != nil {
+				logger.Logger.WithName("link legacy").Errorw(err.Error(), "path", file.Path)
+
+				continue
+			}
+			if original == nil {
+				continue
+			}
+
+			file.ParentID = original.ID
+			file.Variant = variant
+			err = f.fileServerRepo.Update(f.db, file)
+			if err != nil {
+				logger.Logger.WithName("link legacy").Errorw(err.Error(), "path", file.Path)
+
+				continue
+			}
+			files++
+		}
+
+		if len(list) < regenerateBatch {
+			break
+		}
+		afterID = list[len(list)-1].ID
+	}
+
+	logger.Logger.WithName("link legacy").Infow("linked", "bucket", bucket, "prefix", prefix, "files", files)
+}
+
+// legacyVariant returns the variant of the thumbnail stored at dir/variant/name,
+// it reports false if the parent directory of path is not a variant.
+func (f *fileserver) legacyVariant(path string) (string, bool) {
+	variant := filepath.Base(filepath.Dir(path))
+	if _, ok := f.variantReq(variant); !ok {
+		return "", false
+	}
+
+	return variant, true
+}
+
+// legacyOriginal returns the original of the legacy thumbnail stored at dir/variant/name and the variant,
+// the original is dir/name, or dir/stem with another extension if the format of the thumbnail is converted.
+// The original is nil if file is not a thumbnail or its original is not found.
+func (f *fileserver) legacyOriginal(file *models.FileServer) (*models.FileServer, string, error) {
+	variant, ok := f.legacyVariant(file.Path)
+	if !ok || !imageFile(file) {
+		return nil, "", nil
+	}
+
+	variantDir, name := filepath.Split(file.Path)
+	dir, _ := filepath.Split(strings.TrimSuffix(variantDir, "/"))
+	original, err := f.fileServerRepo.GetByPath(f.db, dir+name)
+	if err != nil {
+		return nil, "", err
+	}
+	if original != nil && original.ParentID == "" && imageFile(original) {
+		return original, variant, nil
+	}
+
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	list, err := f.fileServerRepo.ListByPrefix(f.db, file.Bucket, dir+stem+".", "", regenerateBatch)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, original := range list {
+		rest := strings.TrimPrefix(original.Path, dir)
+		if !strings.Contains(rest, "/") && strings.TrimSuffix(rest, filepath.Ext(rest)) == stem && imageFile(original) {
+			return original, variant, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+// variantReq returns the thumbnail request of the variant, which is a preset or WxH[-fit[-crop]][-poster].
+func (f *fileserver) variantReq(variant string) (*ThumbnailReq, bool) {
+	if _, ok := f.conf.Thumbnail.Presets[variant]; ok {
+		return &ThumbnailReq{Preset: variant}, true
+	}
+
+	poster := strings.HasSuffix(variant, "-poster")
+	parts := strings.SplitN(strings.TrimSuffix(variant, "-poster"), "-", 3)
+	size := strings.SplitN(parts[0], "x", 2)
+	if len(size) != 2 {
+		return nil, false
+	}
+
+	width, err := strconv.Atoi(size[0])
+	if err != nil {
+		return nil, false
+	}
+	hight, err := strconv.Atoi(size[1])
+	if err != nil {
+		return nil, false
+	}
+
+	req := &ThumbnailReq{
+		Width:  width,
+		Hight:  hight,
+		Poster: poster,
+	}
+	if len(parts) > 1 {
+		req.Fit = parts[1]
+	}
+	if len(parts) > 2 {
+		req.Crop = parts[2]
+	}
+
+	return req, true
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+)
+
+func TestLegacyVariant(t *testing.T) {
+	f := &fileserver{
+		conf: &config.Config{
+			Thumbnail: config.Thumbnail{
+				Presets: map[string]config.Preset{
+					"small": {Width: 128, Height: 128},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		variant string
+		ok      bool
+	}{
+		{"preset", "t1/photos/small/a.jpeg", "small", true},
+		{"size", "t1/photos/128x128/a.png", "128x128", true},
+		{"fit and crop", "t1/photos/128x128-cover-top/a.png", "128x128-cover-top", true},
+		{"poster", "t1/photos/128x0-poster/a.png", "128x0-poster", true},
+		{"top level", "small/a.png", "small", true},
+		{"original", "t1/photos/a.png", "", false},
+		{"root", "a.png", "", false},
+		{"not a size", "t1/128xabc/a.png", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variant, ok := f.legacyVariant(tt.path)
+			if variant != tt.variant || ok != tt.ok {
+				t.Errorf("legacyVariant(%q) = %q, %v, want %q, %v", tt.path, variant, ok, tt.variant, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSVGFile(t *testing.T) {
+	tests := []struct {
+		name string
+		file *models.FileServer
+		want bool
+	}{
+		{"content type", &models.FileServer{ContentType: "image/svg+xml", FileName: "a.bin"}, true},
+		{"charset", &models.FileServer{ContentType: "image/svg+xml; charset=utf-8"}, true},
+		{"file name", &models.FileServer{ContentType: "application/octet-stream", FileName: "a.svg"}, true},
+		{"xml", &models.FileServer{ContentType: "text/xml", FileName: "a.svg"}, false},
+		{"png", &models.FileServer{ContentType: "image/png", FileName: "a.png"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svgFile(tt.file); got != tt.want {
+				t.Errorf("svgFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
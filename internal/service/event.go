@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	id2 "github.com/quanxiang-cloud/cabin/id"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+	"github.com/quanxiang-cloud/fileserver/pkg/webhook"
+
+	"gorm.io/gorm"
+)
+
+const (
+	eventLock              = "events"
+	defaultEventInterval   = 5 * time.Second
+	defaultEventBatch      = 100
+	defaultEventAttempts   = 10
+	defaultEventBackoff    = 10 * time.Second
+	defaultEventMaxBackoff = time.Hour
+	defaultWebhookTimeout  = 10 * time.Second
+	maxEventError          = 255
+
+	// brokerRedis publishes the events to redis streams.
+	brokerRedis = "redis"
+)
+
+var errSinkNotFound = errors.New("sink not configured")
+
+// Event the event delivered to the sinks.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	RequestID string      `json:"requestID"`
+	CreateAt  int64       `json:"createAt"`
+	Data      interface{} `json:"data"`
+}
+
+// MultipartEvent data of multipart.completed.
+type MultipartEvent struct {
+	Path     string `json:"path"`
+	UploadID string `json:"uploadID"`
+	Size     int64  `json:"size"`
+	AppID    string `json:"appID"`
+}
+
+// PageEvent data of page.published.
+type PageEvent struct {
+	URL    string `json:"url"`
+	AppID  string `json:"appID"`
+	Digest string `json:"digest"`
+}
+
+// sink delivers the events to a destination.
+type sink interface {
+	// accept reports whether the sink subscribes the event type.
+	accept(eventType string) bool
+	send(ctx context.Context, event *models.Event) error
+}
+
+type webhookSink struct {
+	conf   config.Webhook
+	client *webhook.Client
+}
+
+func newWebhookSink(conf config.Webhook) *webhookSink {
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+
+	return &webhookSink{
+		conf:   conf,
+		client: webhook.New(timeout),
+	}
+}
+
+func (w *webhookSink) accept(eventType string) bool {
+	return subscribed(w.conf.Events, eventType)
+}
+
+func (w *webhookSink) send(ctx context.Context, event *models.Event) error {
+	return w.client.Send(ctx, w.conf.URL, w.conf.Secret, event.EventID, event.Type, []byte(event.Payload))
+}
+
+// streamSink publishes the events to a redis stream.
+type streamSink struct {
+	conf       config.Broker
+	streamRepo models.StreamRepo
+}
+
+func (s *streamSink) accept(eventType string) bool {
+	return subscribed(s.conf.Events, eventType)
+}
+
+func (s *streamSink) send(ctx context.Context, event *models.Event) error {
+	_, err := s.streamRepo.Add(ctx, s.conf.Topic, s.conf.MaxLen, map[string]interface{}{
+		"id":      event.EventID,
+		"type":    event.Type,
+		"payload": event.Payload,
+	})
+
+	return err
+}
+
+// subscribed reports whether eventType is in events, an empty events subscribes all.
+func subscribed(events []string, eventType string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, t := range events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newSinks returns the configured sinks by their names in the outbox.
+func newSinks(conf config.Events, streamRepo models.StreamRepo) (map[string]sink, error) {
+	sinks := make(map[string]sink, len(conf.Webhooks)+len(conf.Brokers))
+	for _, w := range conf.Webhooks {
+		sinks["webhook:"+w.Name] = newWebhookSink(w)
+	}
+
+	for _, b := range conf.Brokers {
+		switch b.Kind {
+		case brokerRedis:
+			if b.Topic == "" {
+				return nil, fmt.Errorf("topic of broker %s is empty", b.Name)
+			}
+			sinks["mq:"+b.Name] = &streamSink{
+				conf:       b,
+				streamRepo: streamRepo,
+			}
+		default:
+			return nil, fmt.Errorf("unsupported kind %q of broker %s", b.Kind, b.Name)
+		}
+	}
+
+	return sinks, nil
+}
+
+// emit records the event for every sink subscribing it in the outbox,
+// it should be called with the transaction changing the file so that
+// the event is recorded if and only if the change is committed.
+func (f *fileserver) emit(ctx context.Context, tx *gorm.DB, eventType string, data interface{}) error {
+	if !f.conf.Events.Enable || len(f.sinks) == 0 {
+		return nil
+	}
+
+	_, requestID := header.GetRequestIDKV(ctx).Wreck()
+	event := &Event{
+		ID:        id2.StringUUID(),
+		Type:      eventType,
+		RequestID: requestID,
+		CreateAt:  time2.NowUnix(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	events := make([]*models.Event, 0, len(f.sinks))
+	for name, s := range f.sinks {
+		if !s.accept(eventType) {
+			continue
+		}
+
+		events = append(events, &models.Event{
+			ID:       id2.StringUUID(),
+			EventID:  event.ID,
+			Sink:     name,
+			Type:     eventType,
+			Payload:  string(payload),
+			Status:   models.EventPending,
+			NextAt:   event.CreateAt,
+			CreateAt: event.CreateAt,
+			UpdateAt: event.CreateAt,
+		})
+	}
+
+	return f.eventRepo.Create(tx, events)
+}
+
+// emitFile records an event of the file.
+func (f *fileserver) emitFile(ctx context.Context, tx *gorm.DB, eventType string, file *models.FileServer) error {
+	return f.emit(ctx, tx, eventType, f.toFile(ctx, file))
+}
+
+// relayLoop delivers the events in the outbox periodically.
+func (f *fileserver) relayLoop() {
+	interval := f.conf.Events.Interval
+	if interval <= 0 {
+		interval = defaultEventInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		f.relay(context.Background())
+	}
+}
+
+// relay delivers the due events until the outbox is drained, only one instance runs at a time.
+// The events are delivered at least once, the receivers should deduplicate them by event id.
+func (f *fileserver) relay(ctx context.Context) {
+	interval := f.conf.Events.Interval
+	if interval <= 0 {
+		interval = defaultEventInterval
+	}
+
+	token, err := f.lockRepo.Lock(ctx, eventLock, interval+time.Minute)
+	if err != nil {
+		logger.Logger.WithName("relay").Errorw(err.Error())
+
+		return
+	}
+	if token == "" {
+		return
+	}
+	defer f.lockRepo.Unlock(ctx, eventLock, token)
+
+	batch := f.conf.Events.Batch
+	if batch <= 0 {
+		batch = defaultEventBatch
+	}
+
+	for {
+		events, err := f.eventRepo.ListPending(f.db, time2.NowUnix(), batch)
+		if err != nil {
+			logger.Logger.WithName("relay").Errorw(err.Error())
+
+			return
+		}
+
+		for _, event := range events {
+			f.deliver(ctx, event)
+		}
+
+		if len(events) < batch {
+			return
+		}
+	}
+}
+
+// deliver sends the event to its sink, the delivered event is removed from the outbox,
+// the failed one is rescheduled with backoff or marked failed after the last attempt.
+func (f *fileserver) deliver(ctx context.Context, event *models.Event) {
+	var err error
+	s, ok := f.sinks[event.Sink]
+	if ok {
+		err = s.send(ctx, event)
+	} else {
+		err = errSinkNotFound
+	}
+
+	if err == nil {
+		err = f.eventRepo.Delete(f.db, event.ID)
+		if err != nil {
+			logger.Logger.WithName("relay").Errorw(err.Error(), "event", event.EventID, "sink", event.Sink)
+		}
+
+		return
+	}
+
+	logger.Logger.WithName("relay").Infow(err.Error(), "event", event.EventID, "sink", event.Sink)
+
+	maxAttempts := f.conf.Events.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultEventAttempts
+	}
+
+	event.Attempts++
+	event.Error = err.Error()
+	if len(event.Error) > maxEventError {
+		event.Error = event.Error[:maxEventError]
+	}
+	event.UpdateAt = time2.NowUnix()
+	if event.Attempts >= maxAttempts || !ok {
+		event.Status = models.EventFailed
+	} else {
+		event.NextAt = event.UpdateAt + int64(f.backoff(event.Attempts)/time.Second)
+	}
+
+	err = f.eventRepo.Update(f.db, event)
+	if err != nil {
+		logger.Logger.WithName("relay").Errorw(err.Error(), "event", event.EventID, "sink", event.Sink)
+	}
+}
+
+// backoff returns the delay before the next attempt after attempts failures.
+func (f *fileserver) backoff(attempts int) time.Duration {
+	delay := f.conf.Events.Backoff
+	if delay <= 0 {
+		delay = defaultEventBackoff
+	}
+	maxDelay := f.conf.Events.MaxBackoff
+	if maxDelay <= 0 {
+		maxDelay = defaultEventMaxBackoff
+	}
+
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
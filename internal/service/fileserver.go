@@ -1,10 +1,10 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"fmt"
+	"errors"
 	"path/filepath"
+	"strings"
 
 	error2 "github.com/quanxiang-cloud/cabin/error"
 	id2 "github.com/quanxiang-cloud/cabin/id"
@@ -16,10 +16,11 @@ import (
 	"github.com/quanxiang-cloud/fileserver/internal/models"
 	repo "github.com/quanxiang-cloud/fileserver/internal/models/mysql"
 	"github.com/quanxiang-cloud/fileserver/internal/models/redis"
+	"github.com/quanxiang-cloud/fileserver/pkg/clamav"
 	"github.com/quanxiang-cloud/fileserver/pkg/decompress"
-	"github.com/quanxiang-cloud/fileserver/pkg/mime"
 	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
 	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
 	"github.com/quanxiang-cloud/fileserver/pkg/storage"
 	"github.com/quanxiang-cloud/fileserver/pkg/utils"
 
@@ -31,28 +32,54 @@ import (
 type FileServer interface {
 	DelUploadFile(ctx context.Context, req *DelUploadFileReq) (*DelUploadFileResp, error)
 	Thumbnail(ctx context.Context, req *ThumbnailReq) (*ThumbnailResp, error)
+	Image(ctx context.Context, req *ImageReq) (*ImageResp, error)
+	GetJob(ctx context.Context, req *GetJobReq) (*GetJobResp, error)
+	JobStats(ctx context.Context, req *JobStatsReq) (*JobStatsResp, error)
 	Domain(ctx context.Context, req *DomainReq) (*DomainResp, error)
+	Stat(ctx context.Context, req *StatReq) (*StatResp, error)
 	CompressFile(ctx context.Context, req *CompressReq) (*CompressResp, error)
 	BoCompressFile(ctx context.Context, req *BoCompressFileReq) (*BoCompressFileResp, error)
 	PresignedUpload(ctx context.Context, req *PresignedUploadReq) (*PresignedUploadResp, error)
 	PresignedDownload(ctx context.Context, req *PresignedDownloadReq) (*PresignedDownloadResp, error)
 	InitMultipartUpload(ctx context.Context, req *InitMultipartUploadReq) (*InitMultipartUploadResp, error)
 	PresignedMultipart(ctx context.Context, req *PresignedMultipartReq) (*PresignedMultipartResp, error)
+	PresignedMultipartBatch(ctx context.Context, req *PresignedMultipartBatchReq) (*PresignedMultipartBatchResp, error)
 	ListMultiParts(ctx context.Context, req *ListMultiPartsReq) (*ListMultiPartsResp, error)
 	CompleteMultiParts(ctx context.Context, req *CompleteMultiPartsReq) (*CompleteMultiPartsResp, error)
 	AbortMultipartUpload(ctx context.Context, req *AbortMultipartUploadReq) (*AbortMultipartUploadResp, error)
 	Finish(ctx context.Context, req *FinishReq) (*FinishResp, error)
+	Precheck(ctx context.Context, req *PrecheckReq) (*PrecheckResp, error)
+	Scrub(ctx context.Context, req *ScrubReq) (*ScrubResp, error)
+	ListScrubReports(ctx context.Context, req *ListScrubReportsReq) (*ListScrubReportsResp, error)
+	Reconcile(ctx context.Context, req *ReconcileReq) (*ReconcileResp, error)
+	Backfill(ctx context.Context, req *BackfillReq) (*BackfillResp, error)
+	Search(ctx context.Context, req *SearchReq) (*SearchResp, error)
+	Usage(ctx context.Context, req *UsageReq) (*UsageResp, error)
+	SetQuota(ctx context.Context, req *SetQuotaReq) (*SetQuotaResp, error)
+	RecountQuota(ctx context.Context, req *RecountQuotaReq) (*RecountQuotaResp, error)
+	ListAudits(ctx context.Context, req *ListAuditsReq) (*ListAuditsResp, error)
+	Regenerate(ctx context.Context, req *RegenerateReq) (*RegenerateResp, error)
 }
 
 type fileserver struct {
 	db   *gorm.DB
 	conf *config.Config
 
-	storages       *storage.Storage
-	extract        *decompress.Decompressor
-	fileServerRepo models.FileServerRepo
-	multipartRepo  models.MultipartRepo
-	eg             *errgroup.Group
+	storages        *storage.Storage
+	extract         *decompress.Decompressor
+	fileServerRepo  models.FileServerRepo
+	blobRepo        models.BlobRepo
+	scrubReportRepo models.ScrubReportRepo
+	quotaRepo       models.QuotaRepo
+	auditRepo       models.AuditRepo
+	eventRepo       models.EventRepo
+	imageMetaRepo   models.ImageMetaRepo
+	multipartRepo   models.MultipartRepo
+	lockRepo        models.LockRepo
+	jobRepo         models.JobRepo
+	sinks           map[string]sink
+	scanner         *clamav.Client
+	eg              *errgroup.Group
 }
 
 // NewFileServer new fileserver.
@@ -73,19 +100,70 @@ func NewFileServer(conf *config.Config) (FileServer, error) {
 		return nil, err
 	}
 
+	sinks, err := newSinks(conf.Events, redis.NewStreamRepo(redisClient))
+	if err != nil {
+		return nil, err
+	}
+
 	f := &fileserver{
-		db:             db,
-		conf:           conf,
-		extract:        decompress.NewDecompressor(),
-		storages:       storages,
-		fileServerRepo: repo.NewFileServerRepo(),
-		multipartRepo:  redis.NewMultipartRepo(redisClient),
-		eg:             &errgroup.Group{},
+		db:              db,
+		conf:            conf,
+		extract:         decompress.NewDecompressor(),
+		storages:        storages,
+		fileServerRepo:  repo.NewFileServerRepo(),
+		blobRepo:        repo.NewBlobRepo(),
+		scrubReportRepo: repo.NewScrubReportRepo(),
+		quotaRepo:       repo.NewQuotaRepo(),
+		auditRepo:       repo.NewAuditRepo(),
+		eventRepo:       repo.NewEventRepo(),
+		imageMetaRepo:   repo.NewImageMetaRepo(),
+		multipartRepo:   redis.NewMultipartRepo(redisClient),
+		lockRepo:        redis.NewLockRepo(redisClient),
+		sinks:           sinks,
+		eg:              &errgroup.Group{},
+	}
+
+	if conf.Scan.Enable {
+		if conf.Scan.Quarantine == "" {
+			return nil, errors.New("quarantine bucket of scan is empty")
+		}
+		f.scanner = clamav.New(conf.Scan.Address, conf.Scan.Timeout, conf.Scan.ChunkSize)
+	}
+
+	if conf.Scrub.Enable {
+		go f.scrubLoop()
+	}
+	if conf.Reconcile.Enable {
+		go f.reconcileLoop()
+	}
+	if conf.Events.Enable {
+		go f.relayLoop()
+	}
+	if conf.Jobs.Enable {
+		f.jobRepo = redis.NewJobRepo(redisClient)
+		f.startWorkers()
+	}
+
+	if conf.Audit.Enable {
+		return newAuditor(f)
 	}
 
 	return f, nil
 }
 
+const defaultPageLimit = 20
+
+func pagination(page, limit int) (int, int) {
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+
+	return page, limit
+}
+
 // DelUploadFileReq DelUploadFileReq.
 type DelUploadFileReq struct {
 	Path string `json:"path" binding:"required"`
@@ -95,157 +173,274 @@ type DelUploadFileReq struct {
 type DelUploadFileResp struct{}
 
 func (f *fileserver) DelUploadFile(ctx context.Context, req *DelUploadFileReq) (*DelUploadFileResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("delete file").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("delete file").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+		return nil, err
+	}
 
-		return nil, error2.New(code.InvalidStorage)
+	err = f.deleteUpload(ctx, bucket, path)
+	if err != nil {
+		return nil, err
 	}
 
+	return &DelUploadFileResp{}, nil
+}
+
+// deleteUpload deletes the file at the key of bucket and its object.
+func (f *fileserver) deleteUpload(ctx context.Context, bucket, path string) error {
 	info, err := f.fileServerRepo.GetByPath(f.db, path)
 	if err != nil {
 		logger.Logger.WithName("delete file").Errorw("get file info failed", header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, err
+		return err
 	}
 
 	if info == nil {
-		return &DelUploadFileResp{}, nil
+		return nil
 	}
 
 	tx := f.db.Begin()
-	err = f.fileServerRepo.Delete(tx, info.ID)
+	err = f.deleteFile(tx, info)
 	if err != nil {
 		tx.Rollback()
 		logger.Logger.WithName("delete file").Errorw("delete file info failed", header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, err
+		return err
 	}
 
-	err = f.storages.DeleteObject(bucket, path)
+	err = f.emitFile(ctx, tx, models.EventFileDeleted, info)
 	if err != nil {
 		tx.Rollback()
-		logger.Logger.WithName("delete file").Errorw("delete file object failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+		logger.Logger.WithName("delete file").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return err
+	}
+
+	// the derivatives are deleted with the file
+	derivatives, err := f.removeDerivatives(ctx, tx, info)
+	if err != nil {
+		tx.Rollback()
+		logger.Logger.WithName("delete file").Errorw("delete derivatives failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return err
+	}
+
+	key := path
+	if info.BlobID != "" {
+		// shared object is deleted with the last reference
+		released, err := f.unrefBlob(tx, info.BlobID)
+		if err != nil {
+			tx.Rollback()
+			logger.Logger.WithName("delete file").Errorw("release blob failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return err
+		}
+
+		if released == nil {
+			tx.Commit()
+			f.purgeDerivatives(ctx, derivatives)
 
-		return nil, error2.New(code.InvalidDelFile)
+			return nil
+		}
+		key = released.Path
 	}
 
+	// a file without object can not be served, so the row is deleted first,
+	// a failed object deletion only leaves an orphan object to the reconciliation.
 	tx.Commit()
+	f.purgeDerivatives(ctx, derivatives)
 
-	return &DelUploadFileResp{}, nil
+	err = f.storages.DeleteObject(bucket, key)
+	if err != nil {
+		logger.Logger.WithName("delete file").Errorw("delete file object failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+
+	return nil
 }
 
-// ThumbnailReq ThumbnailReq.
-type ThumbnailReq struct {
-	Path  string `json:"path" binding:"required"`
-	Width int    `json:"width"`
-	Hight int    `json:"hight"`
+// DomainReq DomainReq.
+type DomainReq struct{}
+
+// DomainResp DomainResp.
+type DomainResp struct {
+	Domain   string `json:"domain"`
+	Private  string `json:"private"`
+	Readable string `json:"readable"`
 }
 
-// ThumbnailResp ThumbnailResp.
-type ThumbnailResp struct{}
+func (f *fileserver) Domain(ctx context.Context, req *DomainReq) (*DomainResp, error) {
+	domain := f.conf.Storage.Endpoint
+	if i := strings.Index(domain, "://"); i >= 0 {
+		domain = domain[i+len("://"):]
+	}
+	readable := f.conf.Buckets[storage.Readable]
+	private := f.conf.Buckets[storage.Private]
 
-func (f *fileserver) Thumbnail(ctx context.Context, req *ThumbnailReq) (*ThumbnailResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
+	return &DomainResp{
+		Domain:   domain,
+		Private:  private,
+		Readable: readable,
+	}, nil
+}
+
+// StatReq StatReq.
+type StatReq struct {
+	Path string `json:"path" binding:"required"`
+}
 
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("thumbnail").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+// StatResp StatResp.
+type StatResp struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+	// Digest hex encoded sha256 of the file, computed by the server.
+	Digest     string `json:"digest"`
+	FileName   string `json:"fileName"`
+	UploaderID string `json:"uploaderID"`
+	TenantID   string `json:"tenantID"`
+	AppID      string `json:"appID"`
+	StoreName  string `json:"storeName"`
+	CreateAt   int64  `json:"createAt"`
+	UpdateAt   int64  `json:"updateAt"`
+	// Image the metadata of image, empty if they are not extracted.
+	Image *ImageInfo `json:"image,omitempty"`
+}
 
-		return nil, error2.New(code.InvalidStorage)
+func (f *fileserver) Stat(ctx context.Context, req *StatReq) (*StatResp, error) {
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("stat").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
 	}
 
 	info, err := f.fileServerRepo.GetByPath(f.db, path)
 	if err != nil {
-		logger.Logger.WithName("thumbnail").Errorw("get file info failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+		logger.Logger.WithName("stat").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
 		return nil, err
 	}
 
 	if info == nil {
-		logger.Logger.WithName("thumbnail").Infow("file not found", header.GetRequestIDKV(ctx).Fuzzy()...)
+		logger.Logger.WithName("stat").Infow("file not found", header.GetRequestIDKV(ctx).Fuzzy()...)
 
 		return nil, error2.New(code.InvalidExist)
 	}
 
-	// thumbnail suffix
-	dir, file := filepath.Split(path)
-	middle := fmt.Sprintf("%dx%d", req.Width, req.Hight)
-	thumbnailPath := filepath.Join(dir, middle, file)
-
-	thumbnailInfo, err := f.fileServerRepo.GetByPath(f.db, thumbnailPath)
+	key, err := f.objectKey(info)
 	if err != nil {
-		logger.Logger.WithName("thumbnail").Errorw("get thumbnail info failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+		logger.Logger.WithName("stat").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
 		return nil, err
 	}
 
-	if thumbnailInfo != nil {
-		return &ThumbnailResp{}, nil
-	}
-
-	reader, err := f.storages.GetObject(bucket, path)
+	stat, err := f.storages.HeadObject(bucket, key)
 	if err != nil {
-		logger.Logger.WithName("thumbnail").Errorw("get file object failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+		logger.Logger.WithName("stat").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
 		return nil, error2.New(code.InvalidExist)
 	}
 
-	out := &bytes.Buffer{}
-	err = utils.Scale(reader, out, req.Width, req.Hight, 100)
-	if err != nil {
-		logger.Logger.WithName("thumbnail").Errorw("scale image failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+	return &StatResp{
+		Path:        req.Path,
+		Size:        stat.Size,
+		ContentType: stat.ContentType,
+		Digest:      info.Digest,
+		FileName:    info.FileName,
+		UploaderID:  info.UploaderID,
+		TenantID:    info.TenantID,
+		AppID:       info.AppID,
+		StoreName:   info.StoreName,
+		CreateAt:    info.CreateAt,
+		UpdateAt:    info.UpdateAt,
+		Image:       f.imageInfo(ctx, info.ID),
+	}, nil
+}
+
+// newFile returns a file at path in bucket, uploaded by the operator of ctx.
+func (f *fileserver) newFile(ctx context.Context, bucket, path, fileName, appID string) *models.FileServer {
+	op := operator.FromContext(ctx)
 
-		return nil, error2.New(code.ErrThumbnail)
+	if fileName == "" {
+		fileName = filepath.Base(path)
+	}
+	if appID == "" {
+		appID = op.AppID
 	}
 
-	tx := f.db.Begin()
-	contentType := mime.DetectFilePath(thumbnailPath)
+	return &models.FileServer{
+		ID:         id2.StringUUID(),
+		Bucket:     bucket,
+		Path:       path,
+		FileName:   fileName,
+		UploaderID: op.UserID,
+		TenantID:   op.TenantID,
+		AppID:      appID,
+		StoreName:  f.conf.Storage.Name,
+		Status:     models.FileStatusNormal,
+		CreateAt:   time2.NowUnix(),
+		UpdateAt:   time2.NowUnix(),
+	}
+}
 
-	err = f.storages.PutObject(bucket, thumbnailPath, bytes.NewReader(out.Bytes()), contentType)
+// createFile records the file and adds it to the usage.
+func (f *fileserver) createFile(tx *gorm.DB, file *models.FileServer) error {
+	err := f.fileServerRepo.Create(tx, file)
 	if err != nil {
-		tx.Rollback()
-		logger.Logger.WithName("thumbnail").Errorw("upload thumbnail object failed", header.GetRequestIDKV(ctx).Fuzzy()...)
-
-		return nil, error2.New(code.ErrThumbnail)
+		return err
 	}
 
-	err = f.fileServerRepo.Create(tx, &models.FileServer{
-		ID:       id2.StringUUID(),
-		Path:     thumbnailPath,
-		CreateAt: time2.NowUnix(),
-		UpdateAt: time2.NowUnix(),
-	})
-	if err != nil {
-		tx.Rollback()
-		logger.Logger.WithName("thumbnail").Errorw("create thumbnail info failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+	return f.account(tx, file, 1)
+}
 
-		return nil, err
+// replaceFile updates the content of the file recorded in info with the uploaded file,
+// the file keeps its id, name and uploader.
+func (f *fileserver) replaceFile(tx *gorm.DB, info, file *models.FileServer) error {
+	err := f.account(tx, info, -1)
+	if err != nil {
+		return err
 	}
 
-	tx.Commit()
+	info.Bucket = file.Bucket
+	info.Digest = file.Digest
+	info.BlobID = file.BlobID
+	info.Size = file.Size
+	info.ContentType = file.ContentType
+	info.StoreName = file.StoreName
+	info.Status = file.Status
+	info.UpdateAt = time2.NowUnix()
+	err = f.fileServerRepo.Update(tx, info)
+	if err != nil {
+		return err
+	}
 
-	return &ThumbnailResp{}, nil
+	return f.account(tx, info, 1)
 }
 
-// DomainReq DomainReq.
-type DomainReq struct{}
+// deleteFile deletes the record of the file and removes it from the usage.
+func (f *fileserver) deleteFile(tx *gorm.DB, file *models.FileServer) error {
+	err := f.fileServerRepo.Delete(tx, file.ID)
+	if err != nil {
+		return err
+	}
 
-// DomainResp DomainResp.
-type DomainResp struct {
-	Domain   string `json:"domain"`
-	Private  string `json:"private"`
-	Readable string `json:"readable"`
+	err = f.imageMetaRepo.Delete(tx, file.ID)
+	if err != nil {
+		return err
+	}
+
+	return f.account(tx, file, -1)
 }
 
-func (f *fileserver) Domain(ctx context.Context, req *DomainReq) (*DomainResp, error) {
-	_, domain := utils.Split(f.conf.Storage.Endpoint, "://")
-	readable := f.conf.Buckets[storage.Readable]
-	private := f.conf.Buckets[storage.Private]
+// digestObject computes the sha256 and size of the object.
+func (f *fileserver) digestObject(bucket, key string) (string, int64, error) {
+	reader, err := f.storages.GetObject(bucket, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer reader.Close()
 
-	return &DomainResp{
-		Domain:   domain,
-		Private:  private,
-		Readable: readable,
-	}, nil
+	return utils.GetSHA256(reader)
 }
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/mime"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/storage"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+)
+
+const (
+	defaultImageMaxSize   = 4096
+	defaultImageMaxAge    = 24 * time.Hour
+	defaultImageMaxFrames = 300
+	defaultImageMaxSVG    = 1 << 20
+	// imageCacheVersion changes with the output of the transformation,
+	// v2 drops the svg derivatives cached before they were sanitized.
+	imageCacheVersion = "v2"
+)
+
+// ImageReq ImageReq.
+type ImageReq struct {
+	// Path bucket/key of the source image.
+	Path    string `form:"-"`
+	Width   int    `form:"w" binding:"gte=0"`
+	Height  int    `form:"h" binding:"gte=0"`
+	Fit     string `form:"fit"`
+	Crop    string `form:"crop"`
+	Format  string `form:"fmt"`
+	Quality int    `form:"q" binding:"gte=0,lte=100"`
+	// Poster keeps the first frame of animated images only.
+	Poster bool `form:"poster"`
+	// IfNoneMatch the If-None-Match header of the request.
+	IfNoneMatch string `form:"-"`
+}
+
+// ImageResp ImageResp.
+type ImageResp struct {
+	ETag         string
+	CacheControl string
+	// NotModified is true if the derivative matches IfNoneMatch, Body is nil.
+	NotModified   bool
+	ContentType   string
+	ContentLength int64
+	Body          io.ReadCloser
+}
+
+// Image transforms the image at path by the parameters, the derivative is cached by the digest of the image.
+func (f *fileserver) Image(ctx context.Context, req *ImageReq) (*ImageResp, error) {
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("image").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	opts := &utils.ImageOptions{
+		Width:     req.Width,
+		Height:    req.Height,
+		Fit:       req.Fit,
+		Crop:      req.Crop,
+		Format:    req.Format,
+		Quality:   req.Quality,
+		MaxPixels: f.conf.Image.MaxPixels,
+		Poster:    req.Poster,
+	}
+	err = f.validImageOptions(opts)
+	if err != nil {
+		logger.Logger.WithName("image").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidImageOption)
+	}
+
+	info, err := f.fileServerRepo.GetByPath(f.db, path)
+	if err != nil {
+		logger.Logger.WithName("image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+	if info == nil {
+		logger.Logger.WithName("image").Infow("file not found", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidExist)
+	}
+	if info.Status == models.FileStatusBlocked {
+		logger.Logger.WithName("image").Infow("file blocked", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrFileBlocked)
+	}
+	f.sourceImageOptions(opts, info)
+
+	cacheKey := imageCacheKey(info, opts)
+	sum := sha256.Sum256([]byte(cacheKey))
+	resp := &ImageResp{
+		ETag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+		CacheControl: f.imageCacheControl(bucket),
+	}
+	if req.IfNoneMatch == resp.ETag {
+		resp.NotModified = true
+
+		return resp, nil
+	}
+
+	cacheBucket := f.conf.Image.CacheBucket
+	if cacheBucket != "" {
+		stat, err := f.storages.HeadObject(cacheBucket, cacheKey)
+		if err == nil {
+			body, err := f.storages.GetObject(cacheBucket, cacheKey)
+			if err == nil {
+				resp.ContentType = stat.ContentType
+				resp.ContentLength = stat.Size
+				resp.Body = body
+
+				return resp, nil
+			}
+		}
+		if err != nil && !storage.IsNotExist(err) {
+			logger.Logger.WithName("image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+	}
+
+	key, err := f.objectKey(info)
+	if err != nil {
+		logger.Logger.WithName("image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	reader, err := f.storages.GetObject(bucket, key)
+	if err != nil {
+		logger.Logger.WithName("image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidExist)
+	}
+
+	out := &bytes.Buffer{}
+	format, err := utils.Transform(reader, out, opts)
+	reader.Close()
+	if errors.Is(err, utils.ErrImageTooLarge) {
+		logger.Logger.WithName("image").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrImageTooLarge)
+	}
+	if err != nil {
+		logger.Logger.WithName("image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrThumbnail)
+	}
+
+	contentType := mime.DetectFileExt(format)
+	if cacheBucket != "" {
+		err = f.storages.PutObject(cacheBucket, cacheKey, bytes.NewReader(out.Bytes()), contentType)
+		if err != nil {
+			logger.Logger.WithName("image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+	}
+
+	resp.ContentType = contentType
+	resp.ContentLength = int64(out.Len())
+	resp.Body = ioutil.NopCloser(out)
+
+	return resp, nil
+}
+
+// validImageOptions validates the options and the size of derivative.
+func (f *fileserver) validImageOptions(opts *utils.ImageOptions) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
+	maxWidth, maxHeight := f.conf.Image.MaxWidth, f.conf.Image.MaxHeight
+	if maxWidth <= 0 {
+		maxWidth = defaultImageMaxSize
+	}
+	if maxHeight <= 0 {
+		maxHeight = defaultImageMaxSize
+	}
+	if opts.Width > maxWidth || opts.Height > maxHeight {
+		return utils.ErrImageOption
+	}
+
+	opts.MaxFrames = f.conf.Image.MaxFrames
+	if opts.MaxFrames <= 0 {
+		opts.MaxFrames = defaultImageMaxFrames
+	}
+
+	return nil
+}
+
+// sourceImageOptions sets the options decided by the source image of info.
+func (f *fileserver) sourceImageOptions(opts *utils.ImageOptions, info *models.FileServer) {
+	opts.SVG = svgFile(info)
+	opts.MaxSVGSize = f.conf.Image.MaxSVGSize
+	if opts.MaxSVGSize <= 0 {
+		opts.MaxSVGSize = defaultImageMaxSVG
+	}
+}
+
+// imageCacheKey returns the key of the derivative, which changes with the content of the image.
+func imageCacheKey(info *models.FileServer, opts *utils.ImageOptions) string {
+	version := info.Digest
+	if version == "" {
+		version = info.ID + "-" + strconv.FormatInt(info.UpdateAt, 10)
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = "auto"
+	}
+
+	poster := ""
+	if opts.Poster {
+		poster = "-poster"
+	}
+
+	return fmt.Sprintf("%s/%s/%dx%d-%s-%s-q%d%s.%s", imageCacheVersion, version, opts.Width, opts.Height, opts.Fit, opts.Crop, opts.Quality, poster, format)
+}
+
+// imageCacheControl returns the Cache-Control of the derivatives of bucket,
+// only the derivatives of readable bucket are cached by shared caches.
+func (f *fileserver) imageCacheControl(bucket string) string {
+	maxAge := f.conf.Image.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultImageMaxAge
+	}
+
+	scope := "private"
+	if bucket == f.conf.Buckets[storage.Readable] {
+		scope = "public"
+	}
+
+	return fmt.Sprintf("%s, max-age=%d", scope, int64(maxAge/time.Second))
+}
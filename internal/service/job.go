@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	id2 "github.com/quanxiang-cloud/cabin/id"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+)
+
+const (
+	defaultJobWorkers  = 4
+	defaultJobAttempts = 3
+	defaultJobTTL      = 24 * time.Hour
+	jobPollTimeout     = 5 * time.Second
+	// jobLease the time a running job may go without update before it is taken as abandoned.
+	jobLease = 10 * time.Minute
+)
+
+func (f *fileserver) jobTTL() time.Duration {
+	if f.conf.Jobs.TTL <= 0 {
+		return defaultJobTTL
+	}
+
+	return f.conf.Jobs.TTL
+}
+
+// pushJob queues a job of jobType on the file at key of bucket for the operator of ctx.
+func (f *fileserver) pushJob(ctx context.Context, jobType, bucket, key string, params interface{}) (*models.Job, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	op := operator.FromContext(ctx)
+	job := &models.Job{
+		ID:       id2.StringUUID(),
+		Type:     jobType,
+		Bucket:   bucket,
+		Key:      key,
+		Params:   string(b),
+		UserID:   op.UserID,
+		UserName: op.UserName,
+		TenantID: op.TenantID,
+		AppID:    op.AppID,
+		Status:   models.JobPending,
+		CreateAt: time2.NowUnix(),
+		UpdateAt: time2.NowUnix(),
+	}
+
+	err = f.jobRepo.Push(ctx, job, f.jobTTL())
+	if err != nil {
+		logger.Logger.WithName("push job").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// queueDerivatives queues the thumbnails of the configured presets of the finished image.
+func (f *fileserver) queueDerivatives(ctx context.Context, file *models.FileServer) {
+	if f.jobRepo == nil || len(f.conf.Jobs.Presets) == 0 {
+		return
+	}
+
+	if !imageFile(file) {
+		return
+	}
+
+	for _, preset := range f.conf.Jobs.Presets {
+		_, err := f.pushJob(ctx, models.JobThumbnail, file.Bucket, file.Path, &ThumbnailReq{
+			Preset: preset,
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// startWorkers starts the pool of workers running the queued jobs.
+func (f *fileserver) startWorkers() {
+	workers := f.conf.Jobs.Workers
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+
+	for i := 0; i < workers; i++ {
+		go f.work()
+	}
+	go f.requeueLoop()
+}
+
+// requeueLoop queues again the jobs left running by the stopped workers,
+// on start and every lease.
+func (f *fileserver) requeueLoop() {
+	ctx := context.Background()
+	for {
+		before := time.Now().Add(-jobLease).Unix()
+		n, err := f.jobRepo.Requeue(ctx, before, f.jobTTL())
+		if err != nil {
+			logger.Logger.WithName("requeue jobs").Errorw(err.Error())
+		}
+		if n > 0 {
+			logger.Logger.WithName("requeue jobs").Infow("requeued", "jobs", n)
+		}
+
+		time.Sleep(jobLease)
+	}
+}
+
+func (f *fileserver) work() {
+	ctx := context.Background()
+	for {
+		job, err := f.jobRepo.Pop(ctx, jobPollTimeout)
+		if err != nil {
+			logger.Logger.WithName("job worker").Errorw(err.Error())
+			time.Sleep(jobPollTimeout)
+
+			continue
+		}
+		if job == nil {
+			continue
+		}
+
+		f.runJob(ctx, job)
+	}
+}
+
+// runJob runs the job as its operator, the failed job is queued again until the last attempt.
+// The job is acknowledged once it ends, a job left unacknowledged by a stopped worker is requeued.
+func (f *fileserver) runJob(ctx context.Context, job *models.Job) {
+	defer func() {
+		err := f.jobRepo.Ack(ctx, job.ID)
+		if err != nil {
+			logger.Logger.WithName("job worker").Errorw(err.Error(), "job", job.ID)
+		}
+	}()
+
+	ctx = operator.WithContext(ctx, &operator.Operator{
+		UserID:   job.UserID,
+		UserName: job.UserName,
+		TenantID: job.TenantID,
+		AppID:    job.AppID,
+	})
+
+	job.Status = models.JobRunning
+	job.Attempts++
+	job.UpdateAt = time2.NowUnix()
+	err := f.jobRepo.Save(ctx, job, f.jobTTL())
+	if err != nil {
+		logger.Logger.WithName("job worker").Errorw(err.Error(), "job", job.ID)
+	}
+
+	result, err := f.execJob(ctx, job)
+	job.UpdateAt = time2.NowUnix()
+	if err == nil {
+		job.Status = models.JobDone
+		job.Result = result
+		job.Error = ""
+		err = f.jobRepo.Save(ctx, job, f.jobTTL())
+		if err != nil {
+			logger.Logger.WithName("job worker").Errorw(err.Error(), "job", job.ID)
+		}
+
+		return
+	}
+
+	logger.Logger.WithName("job worker").Infow(err.Error(), "job", job.ID, "type", job.Type, "key", job.Key)
+
+	maxAttempts := f.conf.Jobs.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultJobAttempts
+	}
+
+	job.Error = err.Error()
+	if job.Attempts >= maxAttempts {
+		job.Status = models.JobFailed
+		err = f.jobRepo.Save(ctx, job, f.jobTTL())
+	} else {
+		job.Status = models.JobPending
+		err = f.jobRepo.Push(ctx, job, f.jobTTL())
+	}
+	if err != nil {
+		logger.Logger.WithName("job worker").Errorw(err.Error(), "job", job.ID)
+	}
+}
+
+// execJob runs the job and returns the key of the file produced.
+func (f *fileserver) execJob(ctx context.Context, job *models.Job) (string, error) {
+	switch job.Type {
+	case models.JobThumbnail:
+		req := &ThumbnailReq{}
+		err := json.Unmarshal([]byte(job.Params), req)
+		if err != nil {
+			return "", err
+		}
+
+		resp, err := f.thumbnail(ctx, job.Bucket, job.Key, req, false)
+		if err != nil {
+			return "", err
+		}
+
+		return resp.Path, nil
+	default:
+		return "", fmt.Errorf("unknown job type %s", job.Type)
+	}
+}
+
+// GetJobReq GetJobReq.
+type GetJobReq struct {
+	ID string `json:"id" binding:"required"`
+}
+
+// GetJobResp GetJobResp.
+type GetJobResp struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Path the file the job runs on.
+	Path     string `json:"path"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// Result the path of the file produced by the job.
+	Result string `json:"result,omitempty"`
+	// URL the presigned download url of the result.
+	URL      string `json:"url,omitempty"`
+	Error    string `json:"error,omitempty"`
+	CreateAt int64  `json:"createAt"`
+	UpdateAt int64  `json:"updateAt"`
+}
+
+// GetJob returns the status of a job of the tenant of the operator.
+func (f *fileserver) GetJob(ctx context.Context, req *GetJobReq) (*GetJobResp, error) {
+	if f.jobRepo == nil {
+		return nil, error2.New(code.InvalidExist)
+	}
+
+	job, err := f.jobRepo.Get(ctx, req.ID)
+	if err != nil {
+		logger.Logger.WithName("get job").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+	if job == nil || job.TenantID != operator.FromContext(ctx).TenantID {
+		return nil, error2.New(code.InvalidExist)
+	}
+
+	resp := &GetJobResp{
+		ID:       job.ID,
+		Type:     job.Type,
+		Path:     f.externalPath(ctx, job.Bucket, job.Key),
+		Status:   job.Status,
+		Attempts: job.Attempts,
+		Result:   job.Result,
+		Error:    job.Error,
+		CreateAt: job.CreateAt,
+		UpdateAt: job.UpdateAt,
+	}
+
+	if job.Status == models.JobDone && job.Result != "" {
+		bucket, key, err := f.resolve(ctx, job.Result)
+		if err == nil {
+			resp.URL, err = f.storages.GetObjectRequest(bucket, key, "", f.conf.Storage.URLExpire)
+		}
+		if err != nil {
+			logger.Logger.WithName("get job").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+	}
+
+	return resp, nil
+}
+
+// JobStatsReq JobStatsReq.
+type JobStatsReq struct{}
+
+// JobStatsResp JobStatsResp.
+type JobStatsResp struct {
+	// Pending the number of jobs waiting in the queue.
+	Pending int64 `json:"pending"`
+	// Workers the number of workers of an instance.
+	Workers int `json:"workers"`
+}
+
+// JobStats returns the length of the job queue.
+func (f *fileserver) JobStats(ctx context.Context, req *JobStatsReq) (*JobStatsResp, error) {
+	if f.jobRepo == nil {
+		return &JobStatsResp{}, nil
+	}
+
+	pending, err := f.jobRepo.Len(ctx)
+	if err != nil {
+		logger.Logger.WithName("job stats").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	workers := f.conf.Jobs.Workers
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+
+	return &JobStatsResp{
+		Pending: pending,
+		Workers: workers,
+	}, nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/exif"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+
+	"gorm.io/gorm"
+)
+
+// ImageInfo metadata of image.
+type ImageInfo struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	// ColorModel the color model, such as ycbcr, rgba or paletted.
+	ColorModel string `json:"colorModel"`
+	// Exif the exif tags by names, the gps coordinates are in decimal degrees,
+	// the gps and serial number tags are returned only if metadata.privateTags is set.
+	Exif map[string]string `json:"exif,omitempty"`
+}
+
+// stripBucket reports whether the images of bucket are rewritten without private metadata.
+func (f *fileserver) stripBucket(bucket string) bool {
+	for _, kind := range f.conf.Metadata.Strip {
+		if name := f.conf.Buckets[kind]; name != "" && name == bucket {
+			return true
+		}
+	}
+
+	return false
+}
+
+// processImage strips the private metadata of the image uploaded at the path of file if its bucket requires,
+// and returns the metadata to record, nil if they are not extracted.
+// The digest and size of file are updated if the image is rewritten.
+func (f *fileserver) processImage(ctx context.Context, file *models.FileServer) (*models.ImageMeta, error) {
+	strip := f.stripBucket(file.Bucket)
+	if !imageFile(file) || (!strip && !f.conf.Metadata.Extract) {
+		return nil, nil
+	}
+
+	if f.conf.Metadata.MaxSize > 0 && file.Size > f.conf.Metadata.MaxSize {
+		// an image can not be published with its metadata
+		if strip {
+			logger.Logger.WithName("process image").Infow("image too large to strip", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, error2.New(code.ErrStripImage)
+		}
+
+		return nil, nil
+	}
+
+	reader, err := f.storages.GetObject(file.Bucket, file.Path)
+	if err != nil {
+		logger.Logger.WithName("process image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrUploadFile)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		logger.Logger.WithName("process image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrUploadFile)
+	}
+
+	if strip {
+		data, err = f.stripImage(ctx, file, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !f.conf.Metadata.Extract {
+		return nil, nil
+	}
+
+	// the images that can not be decoded, such as svg, have no metadata
+	info, err := utils.DecodeInfo(bytes.NewReader(data))
+	if err != nil {
+		logger.Logger.WithName("process image").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, nil
+	}
+
+	meta := &models.ImageMeta{
+		FileID:     file.ID,
+		Width:      info.Width,
+		Height:     info.Height,
+		Format:     info.Format,
+		ColorModel: info.ColorModel,
+		CreateAt:   time2.NowUnix(),
+		UpdateAt:   time2.NowUnix(),
+	}
+
+	// a broken exif does not fail the upload
+	tags, err := exif.Tags(data)
+	if err != nil {
+		logger.Logger.WithName("process image").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+	tags = f.publicTags(tags)
+	if len(tags) > 0 {
+		b, err := json.Marshal(tags)
+		if err != nil {
+			return nil, err
+		}
+		meta.Exif = string(b)
+	}
+
+	return meta, nil
+}
+
+// stripImage rewrites the object of file without private metadata and returns the content stored.
+func (f *fileserver) stripImage(ctx context.Context, file *models.FileServer, data []byte) ([]byte, error) {
+	stripped, err := exif.Strip(data)
+	if errors.Is(err, exif.ErrUnsupported) {
+		// the other formats carrying exif, such as tiff, are re-encoded
+		tags, err := exif.Tags(data)
+		if err == nil && len(tags) == 0 {
+			return data, nil
+		}
+
+		out := &bytes.Buffer{}
+		_, err = utils.Transform(bytes.NewReader(data), out, &utils.ImageOptions{
+			MaxPixels: f.conf.Image.MaxPixels,
+		})
+		stripped = out.Bytes()
+	}
+	if err != nil {
+		logger.Logger.WithName("strip image").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrStripImage)
+	}
+
+	if bytes.Equal(stripped, data) {
+		return data, nil
+	}
+
+	err = f.storages.PutObject(file.Bucket, file.Path, bytes.NewReader(stripped), file.ContentType)
+	if err != nil {
+		logger.Logger.WithName("strip image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrUploadFile)
+	}
+
+	digest, size, err := utils.GetSHA256(bytes.NewReader(stripped))
+	if err != nil {
+		logger.Logger.WithName("strip image").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrUploadFile)
+	}
+	file.Digest = digest
+	file.Size = size
+
+	return stripped, nil
+}
+
+// recordImageMeta records the metadata of the file, the stale ones are removed if meta is nil.
+func (f *fileserver) recordImageMeta(db *gorm.DB, fileID string, meta *models.ImageMeta) error {
+	if meta == nil {
+		return f.imageMetaRepo.Delete(db, fileID)
+	}
+
+	meta.FileID = fileID
+
+	return f.imageMetaRepo.Save(db, meta)
+}
+
+// imageInfo returns the recorded metadata of the image, nil if there is none.
+func (f *fileserver) imageInfo(ctx context.Context, fileID string) *ImageInfo {
+	meta, err := f.imageMetaRepo.Get(f.db, fileID)
+	if err != nil {
+		logger.Logger.WithName("image info").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil
+	}
+	if meta == nil {
+		return nil
+	}
+
+	info := &ImageInfo{
+		Width:      meta.Width,
+		Height:     meta.Height,
+		Format:     meta.Format,
+		ColorModel: meta.ColorModel,
+	}
+	if meta.Exif != "" {
+		err = json.Unmarshal([]byte(meta.Exif), &info.Exif)
+		if err != nil {
+			logger.Logger.WithName("image info").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+		// the tags recorded before are redacted as well
+		info.Exif = f.publicTags(info.Exif)
+	}
+
+	return info
+}
+
+// publicTags removes the private tags of exif unless they are allowed.
+func (f *fileserver) publicTags(tags map[string]string) map[string]string {
+	if f.conf.Metadata.PrivateTags {
+		return tags
+	}
+
+	for name := range tags {
+		if exif.Private(name) {
+			delete(tags, name)
+		}
+	}
+
+	return tags
+}
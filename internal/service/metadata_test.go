@@ -0,0 +1,37 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+)
+
+func TestPublicTags(t *testing.T) {
+	tags := func() map[string]string {
+		return map[string]string{
+			"Orientation":      "6",
+			"Make":             "Canon",
+			"GPSLatitude":      "35.500000",
+			"GPSLongitude":     "-139.760000",
+			"BodySerialNumber": "123456",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		privateTags bool
+		want        map[string]string
+	}{
+		{"redacted", false, map[string]string{"Orientation": "6", "Make": "Canon"}},
+		{"allowed", true, tags()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fileserver{conf: &config.Config{Metadata: config.Metadata{PrivateTags: tt.privateTags}}}
+			if got := f.publicTags(tags()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("publicTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+)
+
+// maxKeyLength the maximum length of object key in bytes.
+const maxKeyLength = 1024
+
+// resolve validates the path of request, which is bucket/key,
+// and returns the bucket and the key of the object.
+// The key is prefixed with the tenant of the operator if tenant namespacing is enabled.
+func (f *fileserver) resolve(ctx context.Context, p string) (string, string, error) {
+	bucket, key := utils.Split(p, "/")
+	if bucket == "" || !utils.ExistBucket(f.conf.Buckets, bucket) {
+		return "", "", error2.New(code.InvalidStorage)
+	}
+
+	if f.conf.Namespace.Tenant {
+		tenantID := operator.FromContext(ctx).TenantID
+		if !validSegment(tenantID) {
+			return "", "", error2.New(code.InvalidPath)
+		}
+		key = tenantID + "/" + key
+	}
+
+	if !validKey(key) {
+		return "", "", error2.New(code.InvalidPath)
+	}
+
+	return bucket, key, nil
+}
+
+// externalPath returns the path of the object used by the apis, the tenant prefix is removed.
+func (f *fileserver) externalPath(ctx context.Context, bucket, key string) string {
+	return joinPath(bucket, f.externalKey(ctx, key))
+}
+
+// externalKey returns the key without the tenant prefix.
+func (f *fileserver) externalKey(ctx context.Context, key string) string {
+	if f.conf.Namespace.Tenant {
+		key = strings.TrimPrefix(key, operator.FromContext(ctx).TenantID+"/")
+	}
+
+	return key
+}
+
+// validKey reports whether key is a relative path without empty, dot or dot-dot segments.
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength || !utf8.ValidString(key) {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if !validSegment(segment) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validSegment(segment string) bool {
+	if segment == "" || segment == "." || segment == ".." {
+		return false
+	}
+
+	for _, r := range segment {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+)
+
+func newPathServer(tenant bool) *fileserver {
+	return &fileserver{
+		conf: &config.Config{
+			Buckets: map[string]string{
+				"private":  "private-bucket",
+				"readable": "readable-bucket",
+			},
+			Namespace: config.Namespace{
+				Tenant: tenant,
+			},
+		},
+	}
+}
+
+func errorCode(err error) int64 {
+	var e error2.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+
+	return 0
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		tenant   bool
+		tenantID string
+		path     string
+		bucket   string
+		key      string
+		code     int64
+	}{
+		{name: "key", path: "private-bucket/a/b.png", bucket: "private-bucket", key: "a/b.png"},
+		{name: "unicode key", path: "readable-bucket/文件/图片.png", bucket: "readable-bucket", key: "文件/图片.png"},
+		{name: "unknown bucket", path: "other/a.png", code: code.InvalidStorage},
+		{name: "bucket type is not a bucket", path: "private/a.png", code: code.InvalidStorage},
+		{name: "empty bucket", path: "/a.png", code: code.InvalidStorage},
+		{name: "without key", path: "private-bucket", code: code.InvalidPath},
+		{name: "empty key", path: "private-bucket/", code: code.InvalidPath},
+		{name: "dot dot", path: "private-bucket/a/../../b.png", code: code.InvalidPath},
+		{name: "dot", path: "private-bucket/./a.png", code: code.InvalidPath},
+		{name: "empty segment", path: "private-bucket/a//b.png", code: code.InvalidPath},
+		{name: "trailing slash", path: "private-bucket/a/", code: code.InvalidPath},
+		{name: "backslash", path: `private-bucket/a\..\b.png`, code: code.InvalidPath},
+		{name: "control character", path: "private-bucket/a\x00.png", code: code.InvalidPath},
+		{name: "invalid utf8", path: "private-bucket/\xff.png", code: code.InvalidPath},
+		{name: "too long", path: "private-bucket/" + strings.Repeat("a", maxKeyLength+1), code: code.InvalidPath},
+		{name: "tenant prefix", tenant: true, tenantID: "t1", path: "private-bucket/a.png", bucket: "private-bucket", key: "t1/a.png"},
+		{name: "tenant escape", tenant: true, tenantID: "t1", path: "private-bucket/../t2/a.png", code: code.InvalidPath},
+		{name: "without tenant", tenant: true, path: "private-bucket/a.png", code: code.InvalidPath},
+		{name: "invalid tenant", tenant: true, tenantID: "..", path: "private-bucket/a.png", code: code.InvalidPath},
+		{name: "tenant with slash", tenant: true, tenantID: "t1/t2", path: "private-bucket/a.png", code: code.InvalidPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := operator.WithContext(context.Background(), &operator.Operator{TenantID: tt.tenantID})
+			bucket, key, err := newPathServer(tt.tenant).resolve(ctx, tt.path)
+			if tt.code != 0 {
+				if got := errorCode(err); got != tt.code {
+					t.Fatalf("resolve(%q) error = %v, want code %d", tt.path, err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve(%q) error = %v", tt.path, err)
+			}
+			if bucket != tt.bucket || key != tt.key {
+				t.Errorf("resolve(%q) = %q, %q, want %q, %q", tt.path, bucket, key, tt.bucket, tt.key)
+			}
+		})
+	}
+}
+
+func TestExternalPath(t *testing.T) {
+	ctx := operator.WithContext(context.Background(), &operator.Operator{TenantID: "t1"})
+
+	if got := newPathServer(true).externalPath(ctx, "private-bucket", "t1/a.png"); got != "private-bucket/a.png" {
+		t.Errorf("externalPath() = %q", got)
+	}
+	if got := newPathServer(false).externalPath(ctx, "private-bucket", "t1/a.png"); got != "private-bucket/t1/a.png" {
+		t.Errorf("externalPath() without namespace = %q", got)
+	}
+}
@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	id2 "github.com/quanxiang-cloud/cabin/id"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+
+	"gorm.io/gorm"
+)
+
+// account adds the file to the usage of its tenant and app,
+// sign is 1 when the file is stored and -1 when it is removed.
+// With quota enabled, a stored file is added only within the hard limits, in one conditional update,
+// so that concurrent uploads can not exceed them together.
+// Blocked files are not charged, their objects are kept in the quarantine bucket.
+func (f *fileserver) account(tx *gorm.DB, file *models.FileServer, sign int64) error {
+	if file.Status == models.FileStatusBlocked {
+		return nil
+	}
+
+	owners := map[string]string{
+		models.QuotaTenant: file.TenantID,
+		models.QuotaApp:    file.AppID,
+	}
+	for scope, ownerID := range owners {
+		if ownerID == "" {
+			continue
+		}
+
+		if sign < 0 || !f.conf.Quota.Enable {
+			err := f.quotaRepo.AddUsage(tx, scope, ownerID, sign*file.Size, sign)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		limit := f.defaultLimit(scope)
+		ok, err := f.quotaRepo.AddUsageWithin(tx, scope, ownerID, file.Size, 1, limit.HardBytes, limit.HardFiles)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return error2.New(code.ErrQuotaExceeded)
+		}
+	}
+
+	return nil
+}
+
+// quotaExceeded reports whether err is the rejection of a hard limit.
+func quotaExceeded(err error) bool {
+	var e error2.Error
+	return errors.As(err, &e) && e.Code == code.ErrQuotaExceeded
+}
+
+// quotaDelta returns the usage added by storing size bytes at path,
+// an existing file at path is replaced. An empty path is always a new file.
+func (f *fileserver) quotaDelta(path string, size int64) (int64, int64, error) {
+	if path == "" {
+		return size, 1, nil
+	}
+
+	info, err := f.fileServerRepo.GetByPath(f.db, path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if info == nil {
+		return size, 1, nil
+	}
+
+	return size - info.Size, 0, nil
+}
+
+// checkQuota reports an error if storing the file exceeds the hard limits of its tenant or app,
+// which rejects the upload early, the limits are enforced when the file is accounted.
+func (f *fileserver) checkQuota(ctx context.Context, file *models.FileServer) error {
+	if !f.conf.Quota.Enable {
+		return nil
+	}
+
+	bytes, files, err := f.quotaDelta(file.Path, file.Size)
+	if err != nil {
+		logger.Logger.WithName("check quota").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return err
+	}
+
+	if bytes <= 0 && files <= 0 {
+		return nil
+	}
+
+	owners := []struct {
+		scope   string
+		ownerID string
+	}{
+		{models.QuotaTenant, file.TenantID},
+		{models.QuotaApp, file.AppID},
+	}
+	for _, owner := range owners {
+		if owner.ownerID == "" {
+			continue
+		}
+
+		usage, err := f.usage(owner.scope, owner.ownerID)
+		if err != nil {
+			logger.Logger.WithName("check quota").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return err
+		}
+
+		usage.UsedBytes += bytes
+		usage.UsedFiles += files
+		usage.check()
+		if usage.HardExceeded {
+			logger.Logger.WithName("check quota").Infow("hard limit exceeded",
+				append(header.GetRequestIDKV(ctx).Fuzzy(), "scope", owner.scope, "owner", owner.ownerID)...)
+
+			return error2.New(code.ErrQuotaExceeded)
+		}
+		if usage.SoftExceeded {
+			logger.Logger.WithName("check quota").Infow("soft limit exceeded",
+				append(header.GetRequestIDKV(ctx).Fuzzy(), "scope", owner.scope, "owner", owner.ownerID)...)
+		}
+	}
+
+	return nil
+}
+
+// discardUpload removes the uploaded object rejected by the quota,
+// the file recorded at the same path is removed as well if its object is overwritten.
+func (f *fileserver) discardUpload(ctx context.Context, bucket, path string) {
+	info, err := f.fileServerRepo.GetByPath(f.db, path)
+	if err == nil && info != nil && info.BlobID == "" {
+		err = f.deleteUpload(ctx, bucket, path)
+		if err != nil {
+			logger.Logger.WithName("discard upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+
+		return
+	}
+
+	err = f.storages.DeleteObject(bucket, path)
+	if err != nil {
+		logger.Logger.WithName("discard upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+}
+
+// Usage usage and limits of a tenant or an app.
+type Usage struct {
+	Scope     string `json:"scope"`
+	OwnerID   string `json:"ownerID"`
+	UsedBytes int64  `json:"usedBytes"`
+	UsedFiles int64  `json:"usedFiles"`
+	SoftBytes int64  `json:"softBytes"`
+	HardBytes int64  `json:"hardBytes"`
+	SoftFiles int64  `json:"softFiles"`
+	HardFiles int64  `json:"hardFiles"`
+	// SoftExceeded is true if any soft limit is exceeded.
+	SoftExceeded bool `json:"softExceeded"`
+	// HardExceeded is true if any hard limit is exceeded.
+	HardExceeded bool `json:"hardExceeded"`
+}
+
+func (u *Usage) check() {
+	exceeded := func(used, limit int64) bool {
+		return limit > 0 && used > limit
+	}
+
+	u.SoftExceeded = exceeded(u.UsedBytes, u.SoftBytes) || exceeded(u.UsedFiles, u.SoftFiles)
+	u.HardExceeded = exceeded(u.UsedBytes, u.HardBytes) || exceeded(u.UsedFiles, u.HardFiles)
+}
+
+// defaultLimit returns the limits of scope in config.
+func (f *fileserver) defaultLimit(scope string) config.Limit {
+	switch scope {
+	case models.QuotaTenant:
+		return f.conf.Quota.Tenant
+	case models.QuotaApp:
+		return f.conf.Quota.App
+	}
+
+	return config.Limit{}
+}
+
+// usage returns the usage of owner with the limits overridden by its quota.
+func (f *fileserver) usage(scope, ownerID string) (*Usage, error) {
+	limit := f.defaultLimit(scope)
+	usage := &Usage{
+		Scope:     scope,
+		OwnerID:   ownerID,
+		SoftBytes: limit.SoftBytes,
+		HardBytes: limit.HardBytes,
+		SoftFiles: limit.SoftFiles,
+		HardFiles: limit.HardFiles,
+	}
+
+	quota, err := f.quotaRepo.Get(f.db, scope, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if quota == nil {
+		return usage, nil
+	}
+
+	usage.UsedBytes = quota.UsedBytes
+	usage.UsedFiles = quota.UsedFiles
+	override := func(limit *int64, value int64) {
+		if value > 0 {
+			*limit = value
+		}
+	}
+	override(&usage.SoftBytes, quota.SoftBytes)
+	override(&usage.HardBytes, quota.HardBytes)
+	override(&usage.SoftFiles, quota.SoftFiles)
+	override(&usage.HardFiles, quota.HardFiles)
+
+	return usage, nil
+}
+
+// recount recomputes the usage of all tenants and apps from the fileserver table.
+func (f *fileserver) recount() error {
+	tx := f.db.Begin()
+	err := f.quotaRepo.ResetUsage(tx)
+	if err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	for _, scope := range []string{models.QuotaTenant, models.QuotaApp} {
+		list, err := f.fileServerRepo.Usage(tx, scope)
+		if err != nil {
+			tx.Rollback()
+
+			return err
+		}
+
+		for _, u := range list {
+			err = f.quotaRepo.AddUsage(tx, scope, u.OwnerID, u.Bytes, u.Files)
+			if err != nil {
+				tx.Rollback()
+
+				return err
+			}
+		}
+	}
+	tx.Commit()
+
+	return nil
+}
+
+// UsageReq UsageReq.
+type UsageReq struct {
+	// AppID the app to query, defaults to the App-Id header.
+	AppID string `json:"appID"`
+}
+
+// UsageResp UsageResp.
+type UsageResp struct {
+	Tenant *Usage `json:"tenant,omitempty"`
+	App    *Usage `json:"app,omitempty"`
+}
+
+// Usage returns the usage of the tenant of the operator and the app.
+func (f *fileserver) Usage(ctx context.Context, req *UsageReq) (*UsageResp, error) {
+	op := operator.FromContext(ctx)
+	appID := req.AppID
+	if appID == "" {
+		appID = op.AppID
+	}
+
+	var (
+		resp = &UsageResp{}
+		err  error
+	)
+	if op.TenantID != "" {
+		resp.Tenant, err = f.usage(models.QuotaTenant, op.TenantID)
+		if err != nil {
+			logger.Logger.WithName("usage").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, error2.New(code.ErrQuery)
+		}
+		resp.Tenant.check()
+	}
+
+	if appID != "" {
+		resp.App, err = f.usage(models.QuotaApp, appID)
+		if err != nil {
+			logger.Logger.WithName("usage").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, error2.New(code.ErrQuery)
+		}
+		resp.App.check()
+	}
+
+	return resp, nil
+}
+
+// SetQuotaReq SetQuotaReq.
+type SetQuotaReq struct {
+	Scope   string `json:"scope" binding:"required,oneof=tenant app"`
+	OwnerID string `json:"ownerID" binding:"required"`
+	// limits, 0 falls back to the defaults in config.
+	SoftBytes int64 `json:"softBytes" binding:"gte=0"`
+	HardBytes int64 `json:"hardBytes" binding:"gte=0"`
+	SoftFiles int64 `json:"softFiles" binding:"gte=0"`
+	HardFiles int64 `json:"hardFiles" binding:"gte=0"`
+}
+
+// SetQuotaResp SetQuotaResp.
+type SetQuotaResp struct{}
+
+// SetQuota overrides the limits of a tenant or an app.
+func (f *fileserver) SetQuota(ctx context.Context, req *SetQuotaReq) (*SetQuotaResp, error) {
+	err := f.quotaRepo.SetLimit(f.db, &models.Quota{
+		ID:        id2.StringUUID(),
+		Scope:     req.Scope,
+		OwnerID:   req.OwnerID,
+		SoftBytes: req.SoftBytes,
+		HardBytes: req.HardBytes,
+		SoftFiles: req.SoftFiles,
+		HardFiles: req.HardFiles,
+		CreateAt:  time2.NowUnix(),
+		UpdateAt:  time2.NowUnix(),
+	})
+	if err != nil {
+		logger.Logger.WithName("set quota").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	return &SetQuotaResp{}, nil
+}
+
+// RecountQuotaReq RecountQuotaReq.
+type RecountQuotaReq struct{}
+
+// RecountQuotaResp RecountQuotaResp.
+type RecountQuotaResp struct{}
+
+// RecountQuota recomputes the usage of all tenants and apps,
+// e.g. after the metadata of existing files are filled.
+func (f *fileserver) RecountQuota(ctx context.Context, req *RecountQuotaReq) (*RecountQuotaResp, error) {
+	err := f.recount()
+	if err != nil {
+		logger.Logger.WithName("recount quota").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	return &RecountQuotaResp{}, nil
+}
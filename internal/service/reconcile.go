@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"path"
+	"time"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/storage"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+)
+
+const (
+	reconcileLock         = "reconcile"
+	reconcileBatch        = 500
+	defaultReconcileGrace = 24 * time.Hour
+)
+
+// ReconcileReq ReconcileReq.
+type ReconcileReq struct {
+	// Repair deletes the orphans in both directions.
+	Repair bool `json:"repair"`
+}
+
+// ReconcileResp ReconcileResp.
+type ReconcileResp struct {
+	// MissingObjects files whose objects do not exist.
+	MissingObjects []*MissingObject `json:"missingObjects"`
+	// OrphanObjects objects not referenced by any file.
+	OrphanObjects []*OrphanObject `json:"orphanObjects"`
+	Repaired      bool            `json:"repaired"`
+}
+
+// MissingObject file whose object does not exist.
+type MissingObject struct {
+	FileID string `json:"fileID"`
+	Path   string `json:"path"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key"`
+}
+
+// OrphanObject object not referenced by any file.
+type OrphanObject struct {
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	Size         int64  `json:"size"`
+	LastModified int64  `json:"lastModified"`
+}
+
+// references the keys referenced by the metadata tables.
+type references struct {
+	// files stored at their paths, path -> file.
+	files map[string]*models.FileServer
+	// files sharing blobs, blob id -> files.
+	blobFiles map[string][]*models.FileServer
+	// blobs, bucket -> key -> blob.
+	blobs map[string]map[string]*models.Blob
+	// roots of custom pages, the extracted assets have no files.
+	// Any directory holding an archive is taken as a root, which only hides orphans.
+	pageRoots map[string]struct{}
+}
+
+func (r *references) referenced(bucket, key string) bool {
+	if _, ok := r.files[key]; ok {
+		return true
+	}
+
+	if _, ok := r.blobs[bucket][key]; ok {
+		return true
+	}
+
+	for dir := path.Dir(key); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, ok := r.pageRoots[dir]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *fileserver) loadReferences() (*references, error) {
+	refs := &references{
+		files:     make(map[string]*models.FileServer),
+		blobFiles: make(map[string][]*models.FileServer),
+		blobs:     make(map[string]map[string]*models.Blob),
+		pageRoots: make(map[string]struct{}),
+	}
+
+	var afterID string
+	for {
+		files, err := f.fileServerRepo.List(f.db, afterID, reconcileBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		for _, file := range files {
+			afterID = file.ID
+			if file.Status == models.FileStatusBlocked {
+				// the objects of blocked files are in the quarantine bucket
+				continue
+			}
+			if file.BlobID != "" {
+				refs.blobFiles[file.BlobID] = append(refs.blobFiles[file.BlobID], file)
+
+				continue
+			}
+
+			refs.files[file.Path] = file
+			if _, err := f.extract.GetDecompress(utils.GetExt(file.Path)); err == nil {
+				refs.pageRoots[path.Dir(file.Path)] = struct{}{}
+			}
+		}
+	}
+
+	afterID = ""
+	for {
+		blobs, err := f.blobRepo.List(f.db, afterID, reconcileBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(blobs) == 0 {
+			break
+		}
+
+		for _, blob := range blobs {
+			afterID = blob.ID
+			if refs.blobs[blob.Bucket] == nil {
+				refs.blobs[blob.Bucket] = make(map[string]*models.Blob)
+			}
+			refs.blobs[blob.Bucket][blob.Path] = blob
+		}
+	}
+
+	return refs, nil
+}
+
+func (f *fileserver) Reconcile(ctx context.Context, req *ReconcileReq) (*ReconcileResp, error) {
+	token, err := f.lockRepo.Lock(ctx, reconcileLock, f.reconcileInterval())
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, error2.New(code.ErrJobRunning)
+	}
+	defer f.lockRepo.Unlock(ctx, reconcileLock, token)
+
+	refs, err := f.loadReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	grace := f.conf.Reconcile.Grace
+	if grace <= 0 {
+		grace = defaultReconcileGrace
+	}
+
+	resp := &ReconcileResp{
+		MissingObjects: make([]*MissingObject, 0),
+		OrphanObjects:  make([]*OrphanObject, 0),
+	}
+
+	seenKeys := make(map[string]struct{})
+	seenBlobs := make(map[string]struct{})
+	walked := make(map[string]struct{})
+	for _, bucket := range f.conf.Buckets {
+		if _, ok := walked[bucket]; ok || bucket == "" {
+			continue
+		}
+		walked[bucket] = struct{}{}
+
+		err = f.storages.WalkObjects(bucket, "", func(object *storage.Object) error {
+			seenKeys[object.Key] = struct{}{}
+			if blob, ok := refs.blobs[bucket][object.Key]; ok {
+				seenBlobs[blob.ID] = struct{}{}
+			}
+
+			if refs.referenced(bucket, object.Key) || time.Since(object.LastModified) < grace {
+				return nil
+			}
+
+			resp.OrphanObjects = append(resp.OrphanObjects, &OrphanObject{
+				Bucket:       bucket,
+				Key:          object.Key,
+				Size:         object.Size,
+				LastModified: object.LastModified.Unix(),
+			})
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	missingFiles := make([]*models.FileServer, 0)
+	for key, file := range refs.files {
+		if _, ok := seenKeys[key]; ok {
+			continue
+		}
+
+		missingFiles = append(missingFiles, file)
+		resp.MissingObjects = append(resp.MissingObjects, &MissingObject{
+			FileID: file.ID,
+			Path:   file.Path,
+			Key:    key,
+		})
+	}
+
+	missingBlobs := make([]string, 0)
+	for blobID, files := range refs.blobFiles {
+		if _, ok := seenBlobs[blobID]; ok {
+			continue
+		}
+
+		missingBlobs = append(missingBlobs, blobID)
+		missingFiles = append(missingFiles, files...)
+
+		var bucket, key string
+		if blob, err := f.blobRepo.Get(f.db, blobID); err == nil && blob != nil {
+			bucket, key = blob.Bucket, blob.Path
+		}
+		for _, file := range files {
+			resp.MissingObjects = append(resp.MissingObjects, &MissingObject{
+				FileID: file.ID,
+				Path:   file.Path,
+				Bucket: bucket,
+				Key:    key,
+			})
+		}
+	}
+
+	if req.Repair {
+		err = f.repair(missingFiles, missingBlobs, resp.OrphanObjects)
+		if err != nil {
+			return nil, err
+		}
+		resp.Repaired = true
+	}
+
+	return resp, nil
+}
+
+// repair deletes the files without objects and the objects without files.
+func (f *fileserver) repair(files []*models.FileServer, blobIDs []string, objects []*OrphanObject) error {
+	tx := f.db.Begin()
+	for _, file := range files {
+		err := f.deleteFile(tx, file)
+		if err != nil {
+			tx.Rollback()
+
+			return err
+		}
+	}
+
+	for _, id := range blobIDs {
+		err := f.blobRepo.Delete(tx, id)
+		if err != nil {
+			tx.Rollback()
+
+			return err
+		}
+	}
+	tx.Commit()
+
+	for _, object := range objects {
+		err := f.storages.DeleteObject(object.Bucket, object.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *fileserver) reconcileInterval() time.Duration {
+	if f.conf.Reconcile.Interval <= 0 {
+		return 7 * 24 * time.Hour
+	}
+
+	return f.conf.Reconcile.Interval
+}
+
+// reconcileLoop runs the reconciliation periodically.
+func (f *fileserver) reconcileLoop() {
+	ticker := time.NewTicker(f.reconcileInterval())
+	defer ticker.Stop()
+	for range ticker.C {
+		resp, err := f.Reconcile(context.Background(), &ReconcileReq{
+			Repair: f.conf.Reconcile.Repair,
+		})
+		if err != nil {
+			logger.Logger.WithName("reconcile").Errorw(err.Error())
+
+			continue
+		}
+
+		for _, m := range resp.MissingObjects {
+			logger.Logger.WithName("reconcile").Infow("missing object", "path", m.Path, "key", m.Key)
+		}
+		for _, o := range resp.OrphanObjects {
+			logger.Logger.WithName("reconcile").Infow("orphan object", "bucket", o.Bucket, "key", o.Key)
+		}
+		logger.Logger.WithName("reconcile").Infow("reconcile finished",
+			"missing", len(resp.MissingObjects),
+			"orphan", len(resp.OrphanObjects),
+			"repaired", resp.Repaired,
+		)
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/clamav"
+	"github.com/quanxiang-cloud/fileserver/pkg/mime"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+)
+
+var errInfected = errors.New("infected")
+
+// scanUpload scans the uploaded object of file, info is the recorded file at the same path.
+// An infected object is quarantined and code.ErrInfected is returned.
+func (f *fileserver) scanUpload(ctx context.Context, file, info *models.FileServer) error {
+	if f.scanner == nil {
+		return nil
+	}
+
+	reader, err := f.storages.GetObject(file.Bucket, file.Path)
+	if err != nil {
+		return f.scanFailed(ctx, err)
+	}
+	result, err := f.scanner.Scan(ctx, reader)
+	reader.Close()
+	if err != nil {
+		return f.scanFailed(ctx, err)
+	}
+
+	if !result.Infected {
+		return nil
+	}
+
+	logger.Logger.WithName("scan").Infow("infected file",
+		append(header.GetRequestIDKV(ctx).Fuzzy(), "path", file.Path, "signature", result.Signature)...)
+
+	err = f.quarantine(ctx, file, info)
+	if err != nil {
+		return err
+	}
+
+	return error2.New(code.ErrInfected)
+}
+
+// scanFailed rejects the upload which can not be scanned unless the scanning fails open.
+func (f *fileserver) scanFailed(ctx context.Context, err error) error {
+	logger.Logger.WithName("scan").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	if f.conf.Scan.FailOpen {
+		return nil
+	}
+
+	return error2.New(code.ErrScan)
+}
+
+// quarantine moves the object of file to the quarantine bucket under bucket/key,
+// and records the file as blocked in place of info.
+func (f *fileserver) quarantine(ctx context.Context, file, info *models.FileServer) error {
+	err := f.storages.CopyObjectTo(file.Bucket, file.Path, f.conf.Scan.Quarantine, joinPath(file.Bucket, file.Path))
+	if err != nil {
+		logger.Logger.WithName("quarantine").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return error2.New(code.ErrScan)
+	}
+
+	err = f.storages.DeleteObject(file.Bucket, file.Path)
+	if err != nil {
+		logger.Logger.WithName("quarantine").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return error2.New(code.ErrScan)
+	}
+
+	file.Status = models.FileStatusBlocked
+	file.BlobID = ""
+
+	tx := f.db.Begin()
+	if info == nil {
+		err = f.createFile(tx, file)
+		if err != nil {
+			tx.Rollback()
+			logger.Logger.WithName("quarantine").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return err
+		}
+		tx.Commit()
+
+		return nil
+	}
+
+	var released *models.Blob
+	if info.BlobID != "" {
+		released, err = f.unrefBlob(tx, info.BlobID)
+		if err != nil {
+			tx.Rollback()
+			logger.Logger.WithName("quarantine").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return err
+		}
+	}
+
+	derivatives, err := f.removeDerivatives(ctx, tx, info)
+	if err == nil {
+		err = f.replaceFile(tx, info, file)
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Logger.WithName("quarantine").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return err
+	}
+	tx.Commit()
+	f.purgeDerivatives(ctx, derivatives)
+
+	if released != nil {
+		err = f.storages.DeleteObject(released.Bucket, released.Path)
+		if err != nil {
+			logger.Logger.WithName("quarantine").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+	}
+
+	return nil
+}
+
+// scanAssets scans the extracted files of a custom page under dst before they are published,
+// the archive of an infected page is put to the quarantine bucket under bucket/key.
+func (f *fileserver) scanAssets(ctx context.Context, dst string, req *CompressReq, bucket, archivePath string) error {
+	if f.scanner == nil {
+		return nil
+	}
+
+	var result *clamav.Result
+	err := filepath.Walk(dst, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		result, err = f.scanner.Scan(ctx, file)
+		if err != nil {
+			return err
+		}
+		if result.Infected {
+			return errInfected
+		}
+
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, errInfected) {
+		return f.scanFailed(ctx, err)
+	}
+
+	logger.Logger.WithName("scan").Infow("infected page",
+		append(header.GetRequestIDKV(ctx).Fuzzy(), "path", archivePath, "signature", result.Signature)...)
+
+	archive, err := req.FileHeader.Open()
+	if err != nil {
+		logger.Logger.WithName("quarantine").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return error2.New(code.ErrInfected)
+	}
+	defer archive.Close()
+
+	err = f.storages.PutObject(f.conf.Scan.Quarantine, joinPath(bucket, archivePath), archive, mime.DetectFilePath(req.FileHeader.Filename))
+	if err != nil {
+		logger.Logger.WithName("quarantine").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+
+	return error2.New(code.ErrInfected)
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	id2 "github.com/quanxiang-cloud/cabin/id"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	time2 "github.com/quanxiang-cloud/cabin/time"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/storage"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+)
+
+const (
+	scrubLock         = "scrub"
+	defaultScrubBatch = 100
+)
+
+var errObjectNotFound = errors.New("object not found")
+
+// locate finds the bucket and key of the object holding the content of file.
+func (f *fileserver) locate(info *models.FileServer) (string, string, error) {
+	if info.BlobID != "" {
+		blob, err := f.blobRepo.Get(f.db, info.BlobID)
+		if err != nil {
+			return "", "", err
+		}
+		if blob == nil {
+			return "", "", errObjectNotFound
+		}
+
+		return blob.Bucket, blob.Path, nil
+	}
+
+	if info.Bucket != "" {
+		_, err := f.storages.HeadObject(info.Bucket, info.Path)
+		if storage.IsNotExist(err) {
+			return "", "", errObjectNotFound
+		}
+
+		return info.Bucket, info.Path, err
+	}
+
+	// paths of the files uploaded before buckets are recorded
+	// are not bound to buckets, look for the object in every bucket
+	for _, bucket := range f.conf.Buckets {
+		if bucket == "" {
+			continue
+		}
+
+		_, err := f.storages.HeadObject(bucket, info.Path)
+		if err == nil {
+			return bucket, info.Path, nil
+		}
+		if !storage.IsNotExist(err) {
+			return "", "", err
+		}
+	}
+
+	return "", "", errObjectNotFound
+}
+
+// scrubLoop runs the scrubber periodically.
+func (f *fileserver) scrubLoop() {
+	interval := f.conf.Scrub.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		f.scrub(context.Background())
+	}
+}
+
+// scrub verifies all the files with digest, only one instance runs at a time.
+func (f *fileserver) scrub(ctx context.Context) {
+	interval := f.conf.Scrub.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	token, err := f.lockRepo.Lock(ctx, scrubLock, interval)
+	if err != nil {
+		logger.Logger.WithName("scrub").Errorw(err.Error())
+
+		return
+	}
+	if token == "" {
+		logger.Logger.WithName("scrub").Infow("scrubber is running")
+
+		return
+	}
+	defer f.lockRepo.Unlock(ctx, scrubLock, token)
+
+	batch := f.conf.Scrub.Batch
+	if batch <= 0 {
+		batch = defaultScrubBatch
+	}
+
+	// shared objects are verified once per run
+	verified := make(map[string]struct{})
+
+	var afterID string
+	for {
+		files, err := f.fileServerRepo.List(f.db, afterID, batch)
+		if err != nil {
+			logger.Logger.WithName("scrub").Errorw(err.Error())
+
+			return
+		}
+
+		if len(files) == 0 {
+			break
+		}
+
+		for _, file := range files {
+			afterID = file.ID
+			if file.Digest == "" || file.Status == models.FileStatusBlocked {
+				continue
+			}
+
+			if file.BlobID != "" {
+				if _, ok := verified[file.BlobID]; ok {
+					continue
+				}
+				verified[file.BlobID] = struct{}{}
+			}
+
+			err = f.scrubFile(file)
+			if err != nil {
+				logger.Logger.WithName("scrub").Errorw(err.Error(), "path", file.Path)
+			}
+		}
+	}
+
+	logger.Logger.WithName("scrub").Infow("scrub finished")
+}
+
+func (f *fileserver) scrubFile(file *models.FileServer) error {
+	report := &models.ScrubReport{
+		ID:       id2.StringUUID(),
+		FileID:   file.ID,
+		Path:     file.Path,
+		Key:      file.Path,
+		Digest:   file.Digest,
+		CreateAt: time2.NowUnix(),
+	}
+
+	bucket, key, err := f.locate(file)
+	switch {
+	case errors.Is(err, errObjectNotFound):
+		report.Status = models.ScrubMissing
+
+		return f.saveScrubReport(report)
+	case err != nil:
+		return err
+	}
+	report.Bucket, report.Key = bucket, key
+
+	reader, err := f.storages.GetObject(bucket, key)
+	if storage.IsNotExist(err) {
+		report.Status = models.ScrubMissing
+
+		return f.saveScrubReport(report)
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	digest, _, err := utils.GetSHA256(utils.NewThrottleReader(reader, f.conf.Scrub.Rate))
+	if err != nil {
+		return err
+	}
+
+	if digest != file.Digest {
+		report.Status = models.ScrubCorrupt
+		report.Actual = digest
+
+		return f.saveScrubReport(report)
+	}
+
+	// the object may be repaired since the last run
+	return f.scrubReportRepo.DeleteByFileID(f.db, file.ID)
+}
+
+func (f *fileserver) saveScrubReport(report *models.ScrubReport) error {
+	logger.Logger.WithName("scrub").Infow("broken object", "path", report.Path, "status", report.Status)
+
+	tx := f.db.Begin()
+	err := f.scrubReportRepo.DeleteByFileID(tx, report.FileID)
+	if err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	err = f.scrubReportRepo.Create(tx, report)
+	if err != nil {
+		tx.Rollback()
+
+		return err
+	}
+	tx.Commit()
+
+	return nil
+}
+
+// ScrubReq ScrubReq.
+type ScrubReq struct{}
+
+// ScrubResp ScrubResp.
+type ScrubResp struct{}
+
+func (f *fileserver) Scrub(ctx context.Context, req *ScrubReq) (*ScrubResp, error) {
+	go f.scrub(context.Background())
+
+	return &ScrubResp{}, nil
+}
+
+// ListScrubReportsReq ListScrubReportsReq.
+type ListScrubReportsReq struct {
+	Page  int `json:"page" binding:"gte=0"`
+	Limit int `json:"limit" binding:"gte=0,lte=1000"`
+}
+
+// ListScrubReportsResp ListScrubReportsResp.
+type ListScrubReportsResp struct {
+	Total   int64          `json:"total"`
+	Reports []*ScrubReport `json:"reports"`
+}
+
+// ScrubReport ScrubReport.
+type ScrubReport struct {
+	FileID   string `json:"fileID"`
+	Path     string `json:"path"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	Digest   string `json:"digest"`
+	Actual   string `json:"actual"`
+	Status   string `json:"status"`
+	CreateAt int64  `json:"createAt"`
+}
+
+func (f *fileserver) ListScrubReports(ctx context.Context, req *ListScrubReportsReq) (*ListScrubReportsResp, error) {
+	page, limit := pagination(req.Page, req.Limit)
+
+	list, total, err := f.scrubReportRepo.List(f.db, page, limit)
+	if err != nil {
+		logger.Logger.WithName("list scrub reports").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrQuery)
+	}
+
+	reports := make([]*ScrubReport, 0, len(list))
+	for _, r := range list {
+		reports = append(reports, &ScrubReport{
+			FileID:   r.FileID,
+			Path:     r.Path,
+			Bucket:   r.Bucket,
+			Key:      r.Key,
+			Digest:   r.Digest,
+			Actual:   r.Actual,
+			Status:   r.Status,
+			CreateAt: r.CreateAt,
+		})
+	}
+
+	return &ListScrubReportsResp{
+		Total:   total,
+		Reports: reports,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/operator"
+)
+
+// SearchReq SearchReq.
+type SearchReq struct {
+	AppID      string `json:"appID"`
+	UploaderID string `json:"uploaderID"`
+	Bucket     string `json:"bucket"`
+	// ContentType prefix of the content type, such as "video/".
+	ContentType string `json:"contentType"`
+	// FileName substring of the original file name.
+	FileName string `json:"fileName"`
+	MinSize  int64  `json:"minSize" binding:"gte=0"`
+	MaxSize  int64  `json:"maxSize" binding:"gte=0"`
+	// CreateFrom and CreateTo unix timestamps, CreateTo is exclusive.
+	CreateFrom int64 `json:"createFrom" binding:"gte=0"`
+	CreateTo   int64 `json:"createTo" binding:"gte=0"`
+	// Sort one of createAt, updateAt, size and fileName, defaults to createAt.
+	Sort  string `json:"sort" binding:"omitempty,oneof=createAt updateAt size fileName"`
+	Desc  bool   `json:"desc"`
+	Page  int    `json:"page" binding:"gte=0"`
+	Limit int    `json:"limit" binding:"gte=0,lte=1000"`
+}
+
+// SearchResp SearchResp.
+type SearchResp struct {
+	Total int64   `json:"total"`
+	Files []*File `json:"files"`
+}
+
+// File metadata of file.
+type File struct {
+	ID          string `json:"id"`
+	Path        string `json:"path"`
+	FileName    string `json:"fileName"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+	Digest      string `json:"digest"`
+	UploaderID  string `json:"uploaderID"`
+	TenantID    string `json:"tenantID"`
+	AppID       string `json:"appID"`
+	CreateAt    int64  `json:"createAt"`
+	UpdateAt    int64  `json:"updateAt"`
+}
+
+var sortColumns = map[string]string{
+	"createAt": "create_at",
+	"updateAt": "update_at",
+	"size":     "size",
+	"fileName": "file_name",
+}
+
+// Search searches the files of the tenant of the operator,
+// the operator without tenant searches all tenants, which is allowed to admins only.
+func (f *fileserver) Search(ctx context.Context, req *SearchReq) (*SearchResp, error) {
+	page, limit := pagination(req.Page, req.Limit)
+
+	list, total, err := f.fileServerRepo.Search(f.db, &models.FileQuery{
+		TenantID:    operator.FromContext(ctx).TenantID,
+		AppID:       req.AppID,
+		UploaderID:  req.UploaderID,
+		Bucket:      req.Bucket,
+		ContentType: req.ContentType,
+		FileName:    req.FileName,
+		MinSize:     req.MinSize,
+		MaxSize:     req.MaxSize,
+		CreateFrom:  req.CreateFrom,
+		CreateTo:    req.CreateTo,
+		Sort:        sortColumns[req.Sort],
+		Desc:        req.Desc,
+	}, page, limit)
+	if err != nil {
+		logger.Logger.WithName("search").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrQuery)
+	}
+
+	files := make([]*File, 0, len(list))
+	for _, file := range list {
+		files = append(files, f.toFile(ctx, file))
+	}
+
+	return &SearchResp{
+		Total: total,
+		Files: files,
+	}, nil
+}
+
+// toFile returns the file seen by the apis.
+func (f *fileserver) toFile(ctx context.Context, file *models.FileServer) *File {
+	return &File{
+		ID:          file.ID,
+		Path:        f.externalPath(ctx, file.Bucket, file.Path),
+		FileName:    file.FileName,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+		Digest:      file.Digest,
+		UploaderID:  file.UploaderID,
+		TenantID:    file.TenantID,
+		AppID:       file.AppID,
+		CreateAt:    file.CreateAt,
+		UpdateAt:    file.UpdateAt,
+	}
+}
+
+// joinPath returns the path of the file used by the apis.
+func joinPath(bucket, path string) string {
+	if bucket == "" {
+		return path
+	}
+
+	return bucket + "/" + path
+}
@@ -2,21 +2,30 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 
 	error2 "github.com/quanxiang-cloud/cabin/error"
-	id2 "github.com/quanxiang-cloud/cabin/id"
 	"github.com/quanxiang-cloud/cabin/logger"
 	"github.com/quanxiang-cloud/cabin/tailormade/header"
-	time2 "github.com/quanxiang-cloud/cabin/time"
 	"github.com/quanxiang-cloud/fileserver/internal/models"
 	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/storage"
 	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+
+	"github.com/aws/aws-sdk-go/aws"
 )
 
 // PresignedUploadReq PresignedUploadReq.
 type PresignedUploadReq struct {
 	Path string `json:"path" binding:"required"`
+	// Size the declared size of the file, checked against the quota if set.
+	Size int64 `json:"size" binding:"gte=0"`
+	// AppID the app owning the file, defaults to the App-Id header.
+	AppID string `json:"appID"`
 }
 
 // PresignedUploadResp PresignedUploadResp.
@@ -25,11 +34,23 @@ type PresignedUploadResp struct {
 }
 
 func (f *fileserver) PresignedUpload(ctx context.Context, req *PresignedUploadReq) (*PresignedUploadResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("presigned upload").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("presigned upload").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+	if f.reservedKey(bucket, path) {
+		logger.Logger.WithName("presigned upload").Infow("reserved path", header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, error2.New(code.InvalidStorage)
+		return nil, error2.New(code.InvalidPath)
+	}
+
+	file := f.newFile(ctx, bucket, path, "", req.AppID)
+	file.Size = req.Size
+	err = f.checkQuota(ctx, file)
+	if err != nil {
+		return nil, err
 	}
 
 	expire := f.conf.Storage.URLExpire
@@ -57,11 +78,11 @@ type PresignedDownloadResp struct {
 }
 
 func (f *fileserver) PresignedDownload(ctx context.Context, req *PresignedDownloadReq) (*PresignedDownloadResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("presigned upload").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("presigned upload").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, error2.New(code.InvalidStorage)
+		return nil, err
 	}
 
 	info, err := f.fileServerRepo.GetByPath(f.db, path)
@@ -76,6 +97,11 @@ func (f *fileserver) PresignedDownload(ctx context.Context, req *PresignedDownlo
 
 		return nil, error2.New(code.InvalidExist)
 	}
+	if info.Status == models.FileStatusBlocked {
+		logger.Logger.WithName("presigned download").Infow("file blocked", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrFileBlocked)
+	}
 
 	var disposition string
 	if req.FileName != "" {
@@ -83,8 +109,15 @@ func (f *fileserver) PresignedDownload(ctx context.Context, req *PresignedDownlo
 		disposition = fmt.Sprintf("attachment; filename=\"%q\"; filename*=utf-8''%s", filename, filename)
 	}
 
+	key, err := f.objectKey(info)
+	if err != nil {
+		logger.Logger.WithName("presigned upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
 	expire := f.conf.Storage.URLExpire
-	url, err := f.storages.GetObjectRequest(bucket, path, disposition, expire)
+	url, err := f.storages.GetObjectRequest(bucket, key, disposition, expire)
 	if err != nil {
 		logger.Logger.WithName("presigned upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
@@ -100,19 +133,65 @@ func (f *fileserver) PresignedDownload(ctx context.Context, req *PresignedDownlo
 type InitMultipartUploadReq struct {
 	Path        string `json:"path" binding:"required"`
 	ContentType string `json:"contentType" binding:"required"`
+	// Size declared file size, used to recommend the part size
+	// and checked against the quota.
+	Size int64 `json:"size" binding:"gte=0"`
+	// PresignParts the number of part urls returned with the upload id.
+	PresignParts int64 `json:"presignParts" binding:"gte=0"`
+	// AppID the app owning the file, defaults to the App-Id header.
+	AppID string `json:"appID"`
 }
 
 // InitMultipartUploadResp InitMultipartUploadResp.
 type InitMultipartUploadResp struct {
-	UploadID string `json:"uploadID"`
+	UploadID  string           `json:"uploadID"`
+	PartSize  int64            `json:"partSize,omitempty"`
+	PartCount int64            `json:"partCount,omitempty"`
+	Parts     []*PresignedPart `json:"parts,omitempty"`
+}
+
+// multipart limits of the storage.
+const (
+	minPartSize     = 5 * 1024 * 1024
+	maxPartCount    = 10000
+	partSizeAlign   = 1024 * 1024
+	maxPresignParts = 1000
+)
+
+// recommendPartSize returns the smallest aligned part size
+// that uploads size bytes within the maximum part count.
+func recommendPartSize(size int64) (partSize, partCount int64) {
+	if size <= 0 {
+		return 0, 0
+	}
+
+	partSize = (size + maxPartCount - 1) / maxPartCount
+	partSize = (partSize + partSizeAlign - 1) / partSizeAlign * partSizeAlign
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	return partSize, (size + partSize - 1) / partSize
 }
 
 func (f *fileserver) InitMultipartUpload(ctx context.Context, req *InitMultipartUploadReq) (*InitMultipartUploadResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("init multipart upload").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("init multipart upload").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, error2.New(code.InvalidStorage)
+		return nil, err
+	}
+	if f.reservedKey(bucket, path) {
+		logger.Logger.WithName("init multipart upload").Infow("reserved path", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidPath)
+	}
+
+	file := f.newFile(ctx, bucket, path, "", req.AppID)
+	file.Size = req.Size
+	err = f.checkQuota(ctx, file)
+	if err != nil {
+		return nil, err
 	}
 
 	uploadID, err := f.multipartRepo.Get(ctx, path)
@@ -122,29 +201,48 @@ func (f *fileserver) InitMultipartUpload(ctx context.Context, req *InitMultipart
 		return nil, err
 	}
 
-	if uploadID != "" {
-		return &InitMultipartUploadResp{
-			UploadID: uploadID,
-		}, nil
+	if uploadID == "" {
+		uploadID, err = f.storages.CreateMultipartUpload(bucket, path, req.ContentType)
+		if err != nil {
+			logger.Logger.WithName("init multipart upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, error2.New(code.ErrSinger)
+		}
+
+		err = f.multipartRepo.Create(ctx, path, uploadID, f.conf.Storage.PartExpire)
+		if err != nil {
+			logger.Logger.WithName("init multipart upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, err
+		}
 	}
 
-	uploadID, err = f.storages.CreateMultipartUpload(bucket, path, req.ContentType)
-	if err != nil {
-		logger.Logger.WithName("init multipart upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	resp := &InitMultipartUploadResp{
+		UploadID: uploadID,
+	}
+	resp.PartSize, resp.PartCount = recommendPartSize(req.Size)
 
-		return nil, error2.New(code.ErrSinger)
+	presignParts := req.PresignParts
+	if resp.PartCount > 0 && presignParts > resp.PartCount {
+		presignParts = resp.PartCount
+	}
+	if presignParts > maxPresignParts {
+		presignParts = maxPresignParts
+	}
+
+	checksums := make([]*PartChecksum, 0, presignParts)
+	for i := int64(1); i <= presignParts; i++ {
+		checksums = append(checksums, &PartChecksum{PartNumber: i})
 	}
 
-	err = f.multipartRepo.Create(ctx, path, uploadID, f.conf.Storage.PartExpire)
+	resp.Parts, err = f.presignParts(bucket, path, uploadID, checksums)
 	if err != nil {
 		logger.Logger.WithName("init multipart upload").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, err
+		return nil, error2.New(code.ErrSinger)
 	}
 
-	return &InitMultipartUploadResp{
-		UploadID: uploadID,
-	}, nil
+	return resp, nil
 }
 
 // PresignedMultipartReq  PresignedMultipartReq.
@@ -152,23 +250,45 @@ type PresignedMultipartReq struct {
 	UploadID   string `json:"uploadID" binding:"required"`
 	PartNumber int64  `json:"partNumber" binding:"required"`
 	Path       string `json:"path" binding:"required"`
+	// ContentMD5 base64 encoded md5 of the part, optional.
+	ContentMD5 string `json:"contentMD5"`
+	// SHA256 hex encoded sha256 of the part, optional.
+	SHA256 string `json:"sha256"`
 }
 
 // PresignedMultipartResp PresignedMultipartResp.
 type PresignedMultipartResp struct {
 	URL string `json:"url"`
+	// Headers must be sent with the upload request.
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 func (f *fileserver) PresignedMultipart(ctx context.Context, req *PresignedMultipartReq) (*PresignedMultipartResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("presigned multipart").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("presigned multipart").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	if !validPartNumber(req.PartNumber) {
+		logger.Logger.WithName("presigned multipart").Infow("invalid part number", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidPartRange, maxPartCount)
+	}
+	if !validChecksum(req.ContentMD5, req.SHA256) {
+		logger.Logger.WithName("presigned multipart").Infow("invalid checksum", header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, error2.New(code.InvalidStorage)
+		return nil, error2.New(code.InvalidChecksum)
+	}
+
+	checksum := storage.Checksum{
+		ContentMD5: req.ContentMD5,
+		SHA256:     req.SHA256,
 	}
 
 	expire := f.conf.Storage.URLExpire
-	url, err := f.storages.UploadPartRequest(bucket, path, req.UploadID, req.PartNumber, expire)
+	url, headers, err := f.storages.UploadPartRequest(bucket, path, req.UploadID, req.PartNumber, checksum, expire)
 	if err != nil {
 		logger.Logger.WithName("presigned multipart").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
@@ -176,10 +296,134 @@ func (f *fileserver) PresignedMultipart(ctx context.Context, req *PresignedMulti
 	}
 
 	return &PresignedMultipartResp{
-		URL: url,
+		URL:     url,
+		Headers: headers,
 	}, nil
 }
 
+func validPartNumber(partNumber int64) bool {
+	return partNumber >= 1 && partNumber <= maxPartCount
+}
+
+func validChecksum(contentMD5, sha256 string) bool {
+	if contentMD5 != "" {
+		sum, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(sum) != 16 {
+			return false
+		}
+	}
+
+	if sha256 != "" {
+		sum, err := hex.DecodeString(sha256)
+		if err != nil || len(sum) != 32 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PresignedMultipartBatchReq PresignedMultipartBatchReq.
+// Part numbers are selected by the range [Start, End] or by Parts.
+type PresignedMultipartBatchReq struct {
+	UploadID string          `json:"uploadID" binding:"required"`
+	Path     string          `json:"path" binding:"required"`
+	Start    int64           `json:"start" binding:"gte=0"`
+	End      int64           `json:"end" binding:"gte=0"`
+	Parts    []*PartChecksum `json:"parts" binding:"omitempty,dive"`
+}
+
+// PartChecksum part number with optional checksums.
+type PartChecksum struct {
+	PartNumber int64  `json:"partNumber" binding:"required"`
+	ContentMD5 string `json:"contentMD5"`
+	SHA256     string `json:"sha256"`
+}
+
+// PresignedMultipartBatchResp PresignedMultipartBatchResp.
+type PresignedMultipartBatchResp struct {
+	Parts []*PresignedPart `json:"parts"`
+}
+
+// PresignedPart presigned url of part.
+type PresignedPart struct {
+	PartNumber int64             `json:"partNumber"`
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+func (f *fileserver) PresignedMultipartBatch(ctx context.Context, req *PresignedMultipartBatchReq) (*PresignedMultipartBatchResp, error) {
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("presigned multipart batch").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	checksums := req.Parts
+	if len(checksums) == 0 && req.Start > 0 && req.End >= req.Start && req.End-req.Start < maxPresignParts {
+		checksums = make([]*PartChecksum, 0, req.End-req.Start+1)
+		for i := req.Start; i <= req.End; i++ {
+			checksums = append(checksums, &PartChecksum{PartNumber: i})
+		}
+	}
+
+	if len(checksums) == 0 || len(checksums) > maxPresignParts {
+		logger.Logger.WithName("presigned multipart batch").Infow("invalid part numbers", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidPartNumber, maxPresignParts)
+	}
+
+	for _, c := range checksums {
+		if !validPartNumber(c.PartNumber) {
+			logger.Logger.WithName("presigned multipart batch").Infow("invalid part number", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, error2.New(code.InvalidPartRange, maxPartCount)
+		}
+		if !validChecksum(c.ContentMD5, c.SHA256) {
+			logger.Logger.WithName("presigned multipart batch").Infow("invalid checksum", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return nil, error2.New(code.InvalidChecksum)
+		}
+	}
+
+	parts, err := f.presignParts(bucket, path, req.UploadID, checksums)
+	if err != nil {
+		logger.Logger.WithName("presigned multipart batch").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrSinger)
+	}
+
+	return &PresignedMultipartBatchResp{
+		Parts: parts,
+	}, nil
+}
+
+func (f *fileserver) presignParts(bucket, path, uploadID string, checksums []*PartChecksum) ([]*PresignedPart, error) {
+	expire := f.conf.Storage.URLExpire
+
+	parts := make([]*PresignedPart, 0, len(checksums))
+	for _, c := range checksums {
+		checksum := storage.Checksum{
+			ContentMD5: c.ContentMD5,
+			SHA256:     c.SHA256,
+		}
+
+		url, headers, err := f.storages.UploadPartRequest(bucket, path, uploadID, c.PartNumber, checksum, expire)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, &PresignedPart{
+			PartNumber: c.PartNumber,
+			URL:        url,
+			Headers:    headers,
+		})
+	}
+
+	return parts, nil
+}
+
 // ListMultiPartsReq ListMultiPartsReq.
 type ListMultiPartsReq struct {
 	Path     string `json:"path" binding:"required"`
@@ -188,15 +432,23 @@ type ListMultiPartsReq struct {
 
 // ListMultiPartsResp ListMultiPartsResp.
 type ListMultiPartsResp struct {
-	Parts []int64 `json:"parts"`
+	Parts   []int64 `json:"parts"`
+	Details []*Part `json:"details"`
+}
+
+// Part uploaded part.
+type Part struct {
+	PartNumber int64  `json:"partNumber"`
+	Size       int64  `json:"size"`
+	ETag       string `json:"etag"`
 }
 
 func (f *fileserver) ListMultiParts(ctx context.Context, req *ListMultiPartsReq) (*ListMultiPartsResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("list multipart").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("list multipart").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, error2.New(code.InvalidStorage)
+		return nil, err
 	}
 
 	s3Parts, err := f.storages.ListParts(bucket, path, req.UploadID)
@@ -207,31 +459,64 @@ func (f *fileserver) ListMultiParts(ctx context.Context, req *ListMultiPartsReq)
 	}
 
 	parts := make([]int64, 0, len(s3Parts))
+	details := make([]*Part, 0, len(s3Parts))
 	for _, p := range s3Parts {
-		parts = append(parts, *p.PartNumber)
+		parts = append(parts, aws.Int64Value(p.PartNumber))
+		details = append(details, &Part{
+			PartNumber: aws.Int64Value(p.PartNumber),
+			Size:       aws.Int64Value(p.Size),
+			ETag:       aws.StringValue(p.ETag),
+		})
 	}
 
-	return &ListMultiPartsResp{Parts: parts}, nil
+	return &ListMultiPartsResp{
+		Parts:   parts,
+		Details: details,
+	}, nil
 }
 
 // CompleteMultiPartsReq CompleteMultiPartsReq.
 type CompleteMultiPartsReq struct {
 	Path     string `json:"path" binding:"required"`
 	UploadID string `json:"uploadID" binding:"required"`
+	// Parts expected by the client, optional.
+	// If set, it must start from 1 without gaps and match the uploaded etags.
+	Parts []*CompletedPart `json:"parts" binding:"omitempty,dive"`
+	// AppID the app owning the file, defaults to the App-Id header.
+	AppID string `json:"appID"`
+}
+
+// CompletedPart CompletedPart.
+type CompletedPart struct {
+	PartNumber int64  `json:"partNumber" binding:"required"`
+	ETag       string `json:"etag" binding:"required"`
 }
 
 // CompleteMultiPartsResp CompleteMultiPartsResp.
 type CompleteMultiPartsResp struct{}
 
 func (f *fileserver) CompleteMultiParts(ctx context.Context, req *CompleteMultiPartsReq) (*CompleteMultiPartsResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("complete multipart").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("complete multipart").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, error2.New(code.InvalidStorage)
+		return nil, err
+	}
+
+	expected := make([]*storage.CompletedPart, 0, len(req.Parts))
+	for _, p := range req.Parts {
+		expected = append(expected, &storage.CompletedPart{
+			PartNumber: p.PartNumber,
+			ETag:       p.ETag,
+		})
 	}
 
-	err := f.storages.CompleteMultipartUpload(bucket, path, req.UploadID)
+	err = f.storages.CompleteMultipartUpload(bucket, path, req.UploadID, expected)
+	if errors.Is(err, storage.ErrInvalidPart) {
+		logger.Logger.WithName("complete multipart").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidPart)
+	}
 	if err != nil {
 		logger.Logger.WithName("complete multipart").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
@@ -245,6 +530,35 @@ func (f *fileserver) CompleteMultiParts(ctx context.Context, req *CompleteMultiP
 		return nil, err
 	}
 
+	// the declared size may differ from the merged object
+	stat, err := f.storages.HeadObject(bucket, path)
+	if err != nil {
+		logger.Logger.WithName("complete multipart").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrCompleteMultiPart)
+	}
+
+	file := f.newFile(ctx, bucket, path, "", req.AppID)
+	file.Size = stat.Size
+	file.ContentType = stat.ContentType
+	err = f.checkQuota(ctx, file)
+	if err != nil {
+		f.discardUpload(ctx, bucket, path)
+
+		return nil, err
+	}
+
+	// the file is scanned and recorded by finish, the event is only a notification
+	err = f.emit(ctx, f.db, models.EventMultipartCompleted, &MultipartEvent{
+		Path:     req.Path,
+		UploadID: req.UploadID,
+		Size:     stat.Size,
+		AppID:    file.AppID,
+	})
+	if err != nil {
+		logger.Logger.WithName("complete multipart").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+	}
+
 	return &CompleteMultiPartsResp{}, nil
 }
 
@@ -258,14 +572,14 @@ type AbortMultipartUploadReq struct {
 type AbortMultipartUploadResp struct{}
 
 func (f *fileserver) AbortMultipartUpload(ctx context.Context, req *AbortMultipartUploadReq) (*AbortMultipartUploadResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("abort multipart").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("abort multipart").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, error2.New(code.InvalidStorage)
+		return nil, err
 	}
 
-	err := f.multipartRepo.Delete(ctx, path)
+	err = f.multipartRepo.Delete(ctx, path)
 	if err != nil {
 		logger.Logger.WithName("abort multipart").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
@@ -285,44 +599,274 @@ func (f *fileserver) AbortMultipartUpload(ctx context.Context, req *AbortMultipa
 // FinishReq FinishReq.
 type FinishReq struct {
 	Path string `json:"path" binding:"required"`
+	// FileName the original file name, defaults to the base of path.
+	FileName string `json:"fileName"`
+	// AppID the app owning the file, defaults to the App-Id header.
+	AppID string `json:"appID"`
 }
 
 // FinishResp FinishResp.
-type FinishResp struct{}
+type FinishResp struct {
+	// Digest hex encoded sha256 of the file, computed by the server.
+	Digest string `json:"digest"`
+}
 
 func (f *fileserver) Finish(ctx context.Context, req *FinishReq) (*FinishResp, error) {
-	bucket, path := utils.Split(req.Path, "/")
-	if !utils.ExistBucket(f.conf.Buckets, bucket) {
-		logger.Logger.WithName("finish").Infow("invalid storage", header.GetRequestIDKV(ctx).Fuzzy()...)
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("finish").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+	if f.reservedKey(bucket, path) {
+		logger.Logger.WithName("finish").Infow("reserved path", header.GetRequestIDKV(ctx).Fuzzy()...)
 
-		return nil, error2.New(code.InvalidStorage)
+		return nil, error2.New(code.InvalidPath)
 	}
+
+	return f.finish(ctx, bucket, path, req.FileName, req.AppID)
+}
+
+// finish verifies the object uploaded to the key of bucket and records the file.
+func (f *fileserver) finish(ctx context.Context, bucket, path, fileName, appID string) (*FinishResp, error) {
 	info, err := f.fileServerRepo.GetByPath(f.db, path)
 	if err != nil {
 		logger.Logger.WithName("finish").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
 		return nil, err
 	}
-	if info != nil {
-		return &FinishResp{}, nil
+
+	stat, err := f.storages.HeadObject(bucket, path)
+	if storage.IsNotExist(err) {
+		// shared objects are moved away from path once finished,
+		// and infected objects are moved to the quarantine bucket
+		if info != nil && info.Status == models.FileStatusBlocked {
+			return nil, error2.New(code.ErrInfected)
+		}
+		if info != nil {
+			return &FinishResp{Digest: info.Digest}, nil
+		}
+		logger.Logger.WithName("finish").Infow("file not found", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidExist)
+	}
+	if err != nil {
+		logger.Logger.WithName("finish").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrUploadFile)
+	}
+
+	digest, size, err := f.digestObject(bucket, path)
+	if err != nil {
+		logger.Logger.WithName("finish").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrUploadFile)
+	}
+
+	file := f.newFile(ctx, bucket, path, fileName, appID)
+	file.Digest = digest
+	file.Size = size
+	file.ContentType = stat.ContentType
+
+	err = f.checkQuota(ctx, file)
+	if err != nil {
+		f.discardUpload(ctx, bucket, path)
+
+		return nil, err
 	}
 
-	newInfo := &models.FileServer{
-		ID:       id2.StringUUID(),
-		Path:     path,
-		CreateAt: time2.NowUnix(),
-		UpdateAt: time2.NowUnix(),
+	err = f.verifyObject(ctx, bucket, path, file.FileName, stat.ContentType)
+	if err != nil {
+		f.discardUpload(ctx, bucket, path)
+
+		return nil, err
 	}
 
+	err = f.scanUpload(ctx, file, info)
+	if err != nil {
+		return nil, err
+	}
+
+	// the image may be rewritten without its private metadata
+	meta, err := f.processImage(ctx, file)
+	if err != nil {
+		f.discardUpload(ctx, bucket, path)
+
+		return nil, err
+	}
+	digest = file.Digest
+
+	if f.dedupBucket(bucket) {
+		err = f.finishDedup(ctx, file, info)
+		if quotaExceeded(err) {
+			f.discardUpload(ctx, bucket, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fileID := file.ID
+		if info != nil {
+			fileID = info.ID
+		}
+		err = f.recordImageMeta(f.db, fileID, meta)
+		if err != nil {
+			logger.Logger.WithName("finish").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+		}
+		f.queueDerivatives(ctx, file)
+
+		return &FinishResp{Digest: digest}, nil
+	}
+
+	var derivatives []*models.FileServer
 	tx := f.db.Begin()
-	err = f.fileServerRepo.Create(tx, newInfo)
+	if info != nil {
+		// the file may be uploaded again with a new content
+		if info.Digest == digest && info.Status != models.FileStatusUnknown {
+			tx.Rollback()
+
+			return &FinishResp{Digest: digest}, nil
+		}
+
+		// the derivatives of the old content are stale
+		derivatives, err = f.removeDerivatives(ctx, tx, info)
+		if err == nil {
+			err = f.replaceFile(tx, info, file)
+		}
+		file = info
+	} else {
+		err = f.createFile(tx, file)
+	}
+	if err == nil {
+		err = f.recordImageMeta(tx, file.ID, meta)
+	}
+	if err == nil {
+		err = f.emitFile(ctx, tx, models.EventFileUploaded, file)
+	}
 	if err != nil {
 		tx.Rollback()
+		if quotaExceeded(err) {
+			f.discardUpload(ctx, bucket, path)
+
+			return nil, err
+		}
 		logger.Logger.WithName("finish").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
 
 		return nil, err
 	}
 	tx.Commit()
+	f.purgeDerivatives(ctx, derivatives)
+	f.queueDerivatives(ctx, file)
+
+	return &FinishResp{Digest: digest}, nil
+}
+
+// PrecheckReq PrecheckReq.
+type PrecheckReq struct {
+	Path   string `json:"path" binding:"required"`
+	Size   int64  `json:"size" binding:"gte=0"`
+	SHA256 string `json:"sha256" binding:"required,len=64,hexadecimal"`
+	// FileName the original file name, defaults to the base of path.
+	FileName string `json:"fileName"`
+	// AppID the app owning the file, defaults to the App-Id header.
+	AppID string `json:"appID"`
+}
+
+// PrecheckResp PrecheckResp.
+type PrecheckResp struct {
+	// Done is true if the file is linked to an existing object,
+	// otherwise the file should be uploaded.
+	Done bool `json:"done"`
+}
+
+func (f *fileserver) Precheck(ctx context.Context, req *PrecheckReq) (*PrecheckResp, error) {
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("precheck").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+	if f.reservedKey(bucket, path) {
+		logger.Logger.WithName("precheck").Infow("reserved path", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidPath)
+	}
+
+	file := f.newFile(ctx, bucket, path, req.FileName, req.AppID)
+	file.Digest = strings.ToLower(req.SHA256)
+	file.Size = req.Size
+
+	err = f.checkQuota(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	precheck := f.precheckCopy
+	if f.dedupBucket(bucket) {
+		precheck = f.precheckDedup
+	}
+
+	done, err := precheck(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrecheckResp{
+		Done: done,
+	}, nil
+}
+
+// precheckSources returns the files with the digest of file which may be its source.
+// The content of the source is exposed to the caller, so only the files of the tenant of the caller,
+// or those uploaded by the caller without tenant, are matched.
+func (f *fileserver) precheckSources(file *models.FileServer) ([]*models.FileServer, error) {
+	if file.TenantID == "" && file.UploaderID == "" {
+		return nil, nil
+	}
+
+	return f.fileServerRepo.GetByDigest(f.db, file.Digest, file.TenantID, file.UploaderID)
+}
+
+// precheckCopy copies an existing object with the same digest in bucket to the file,
+// and reports whether such an object exists.
+func (f *fileserver) precheckCopy(ctx context.Context, file *models.FileServer) (bool, error) {
+	files, err := f.precheckSources(file)
+	if err != nil {
+		logger.Logger.WithName("precheck").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return false, err
+	}
+
+	for _, src := range files {
+		if src.BlobID != "" || (src.Bucket != "" && src.Bucket != file.Bucket) {
+			continue
+		}
+
+		if src.Path == file.Path {
+			return true, nil
+		}
+
+		// only the object in the same bucket can be copied
+		stat, err := f.storages.HeadObject(file.Bucket, src.Path)
+		if err != nil || stat.Size != file.Size {
+			continue
+		}
+
+		err = f.storages.CopyObject(file.Bucket, src.Path, file.Path)
+		if err != nil {
+			logger.Logger.WithName("precheck").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+			return false, nil
+		}
+
+		// the copy is verified as an upload
+		_, err = f.finish(ctx, file.Bucket, file.Path, file.FileName, file.AppID)
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
 
-	return &FinishResp{}, nil
+	return false, nil
 }
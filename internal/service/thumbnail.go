@@ -0,0 +1,295 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	error2 "github.com/quanxiang-cloud/cabin/error"
+	"github.com/quanxiang-cloud/cabin/logger"
+	"github.com/quanxiang-cloud/cabin/tailormade/header"
+	"github.com/quanxiang-cloud/fileserver/internal/models"
+	"github.com/quanxiang-cloud/fileserver/pkg/mime"
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/code"
+	"github.com/quanxiang-cloud/fileserver/pkg/utils"
+)
+
+// ThumbnailReq ThumbnailReq.
+// A zero width or hight is derived from the aspect ratio of the image.
+type ThumbnailReq struct {
+	Path  string `json:"path" binding:"required"`
+	Width int    `json:"width" binding:"gte=0"`
+	Hight int    `json:"hight" binding:"gte=0"`
+	// Fit contain, cover or fill, the configured fit by default.
+	Fit string `json:"fit"`
+	// Crop the anchor of cover, center by default.
+	Crop string `json:"crop"`
+	// Preset the name of a configured preset, the size and mode of request are ignored.
+	Preset string `json:"preset"`
+	// Poster keeps the first frame of animated images only.
+	Poster bool `json:"poster"`
+}
+
+// ThumbnailResp ThumbnailResp.
+type ThumbnailResp struct {
+	// Path the path of thumbnail.
+	Path string `json:"path"`
+	// URL the presigned download url of thumbnail, empty if it is queued.
+	URL string `json:"url,omitempty"`
+	// JobID the id of the job generating the thumbnail of a large image.
+	JobID string `json:"jobID,omitempty"`
+}
+
+func (f *fileserver) Thumbnail(ctx context.Context, req *ThumbnailReq) (*ThumbnailResp, error) {
+	bucket, path, err := f.resolve(ctx, req.Path)
+	if err != nil {
+		logger.Logger.WithName("thumbnail").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	return f.thumbnail(ctx, bucket, path, req, f.jobRepo != nil)
+}
+
+// thumbnail generates the thumbnail of the image at path of bucket,
+// the large images are queued if async is true.
+func (f *fileserver) thumbnail(ctx context.Context, bucket, path string, req *ThumbnailReq, async bool) (*ThumbnailResp, error) {
+	info, err := f.fileServerRepo.GetByPath(f.db, path)
+	if err != nil {
+		logger.Logger.WithName("thumbnail").Errorw("get file info failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	if info == nil {
+		logger.Logger.WithName("thumbnail").Infow("file not found", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidExist)
+	}
+	if info.Status == models.FileStatusBlocked {
+		logger.Logger.WithName("thumbnail").Infow("file blocked", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrFileBlocked)
+	}
+
+	opts, name, err := f.thumbnailOptions(req)
+	if err != nil {
+		logger.Logger.WithName("thumbnail").Infow(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.InvalidImageOption)
+	}
+
+	// the thumbnail is stored at dir/name/file, with the extension of its format,
+	// the sources that can not be encoded, such as webp, are stored as png
+	dir, file := filepath.Split(path)
+	if opts.Format == "" && !utils.Encodable(strings.TrimPrefix(filepath.Ext(file), ".")) {
+		opts.Format = utils.FormatPNG
+	}
+	if opts.Format != "" {
+		file = strings.TrimSuffix(file, filepath.Ext(file)) + "." + opts.Format
+	}
+	thumbnailPath := filepath.Join(dir, name, file)
+
+	thumbnailInfo, err := f.fileServerRepo.GetByPath(f.db, thumbnailPath)
+	if err != nil {
+		logger.Logger.WithName("thumbnail").Errorw("get thumbnail info failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, err
+	}
+
+	if thumbnailInfo != nil {
+		return f.thumbnailResp(ctx, bucket, thumbnailPath)
+	}
+
+	if async && f.conf.Jobs.AsyncSize > 0 && info.Size > f.conf.Jobs.AsyncSize {
+		job, err := f.pushJob(ctx, models.JobThumbnail, bucket, path, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ThumbnailResp{
+			Path:  f.externalPath(ctx, bucket, thumbnailPath),
+			JobID: job.ID,
+		}, nil
+	}
+
+	err = f.generateThumbnail(ctx, bucket, thumbnailPath, name, info, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.thumbnailResp(ctx, bucket, thumbnailPath)
+}
+
+// generateThumbnail scales the image of info and records the thumbnail at thumbnailPath as its derivative of variant.
+func (f *fileserver) generateThumbnail(ctx context.Context, bucket, thumbnailPath, variant string, info *models.FileServer, opts *utils.ImageOptions) error {
+	key, err := f.objectKey(info)
+	if err != nil {
+		logger.Logger.WithName("thumbnail").Errorw("get file key failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return err
+	}
+
+	reader, err := f.storages.GetObject(bucket, key)
+	if err != nil {
+		logger.Logger.WithName("thumbnail").Errorw("get file object failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return error2.New(code.InvalidExist)
+	}
+
+	f.sourceImageOptions(opts, info)
+	out := &bytes.Buffer{}
+	err = utils.Scale(reader, out, opts)
+	reader.Close()
+	if err != nil {
+		logger.Logger.WithName("thumbnail").Errorw("scale image failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return error2.New(code.ErrThumbnail)
+	}
+
+	tx := f.db.Begin()
+	contentType := mime.DetectFilePath(thumbnailPath)
+
+	err = f.storages.PutObject(bucket, thumbnailPath, bytes.NewReader(out.Bytes()), contentType)
+	if err != nil {
+		tx.Rollback()
+		logger.Logger.WithName("thumbnail").Errorw("upload thumbnail object failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return error2.New(code.ErrThumbnail)
+	}
+
+	digest, _, err := utils.GetSHA256(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		tx.Rollback()
+		logger.Logger.WithName("thumbnail").Errorw("digest thumbnail failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return error2.New(code.ErrThumbnail)
+	}
+
+	// the thumbnail belongs to the app of the original file
+	thumbnail := f.newFile(ctx, bucket, thumbnailPath, info.FileName, info.AppID)
+	thumbnail.Digest = digest
+	thumbnail.Size = int64(out.Len())
+	thumbnail.ContentType = contentType
+	thumbnail.ParentID = info.ID
+	thumbnail.Variant = variant
+	if thumbnail.TenantID == "" {
+		thumbnail.TenantID = info.TenantID
+	}
+
+	err = f.createFile(tx, thumbnail)
+	if err != nil {
+		tx.Rollback()
+		logger.Logger.WithName("thumbnail").Errorw("create thumbnail info failed", header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return err
+	}
+
+	err = f.emitFile(ctx, tx, models.EventThumbnailCreated, thumbnail)
+	if err != nil {
+		tx.Rollback()
+		logger.Logger.WithName("thumbnail").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return err
+	}
+
+	tx.Commit()
+
+	return nil
+}
+
+// thumbnailOptions returns the scaling options of the thumbnail and the name of its directory,
+// which is the preset, or WxH[-fit[-crop]][-poster] for the free-form sizes.
+func (f *fileserver) thumbnailOptions(req *ThumbnailReq) (*utils.ImageOptions, string, error) {
+	if req.Preset != "" {
+		preset, ok := f.conf.Thumbnail.Presets[req.Preset]
+		if !ok || !validSegment(req.Preset) {
+			return nil, "", utils.ErrImageOption
+		}
+
+		opts := &utils.ImageOptions{
+			Width:     preset.Width,
+			Height:    preset.Height,
+			Fit:       preset.Fit,
+			Crop:      preset.Crop,
+			Format:    preset.Format,
+			Quality:   preset.Quality,
+			MaxPixels: f.conf.Image.MaxPixels,
+			Poster:    preset.Poster,
+		}
+		if opts.Quality == 0 {
+			opts.Quality = f.conf.Thumbnail.Quality
+		}
+
+		return opts, req.Preset, f.validImageOptions(opts)
+	}
+
+	if req.Width == 0 && req.Hight == 0 {
+		return nil, "", utils.ErrImageOption
+	}
+
+	// free-form sizes are limited to the allowed ones
+	size := fmt.Sprintf("%dx%d", req.Width, req.Hight)
+	if !f.thumbnailSizeAllowed(size) {
+		return nil, "", utils.ErrImageOption
+	}
+
+	opts := &utils.ImageOptions{
+		Width:     req.Width,
+		Height:    req.Hight,
+		Fit:       req.Fit,
+		Crop:      req.Crop,
+		Quality:   f.conf.Thumbnail.Quality,
+		MaxPixels: f.conf.Image.MaxPixels,
+		Poster:    req.Poster,
+	}
+	if opts.Fit == "" {
+		opts.Fit = f.conf.Thumbnail.Fit
+	}
+	err := f.validImageOptions(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the default mode keeps the paths of the thumbnails generated before
+	name := size
+	if req.Fit != "" {
+		name += "-" + opts.Fit
+		if opts.Fit == utils.FitCover {
+			name += "-" + opts.Crop
+		}
+	}
+	if opts.Poster {
+		name += "-poster"
+	}
+
+	return opts, name, nil
+}
+
+// thumbnailSizeAllowed reports whether the free-form size WxH is allowed.
+func (f *fileserver) thumbnailSizeAllowed(size string) bool {
+	for _, allowed := range f.conf.Thumbnail.Sizes {
+		if allowed == "*" || allowed == size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// thumbnailResp returns the path and download url of the thumbnail.
+func (f *fileserver) thumbnailResp(ctx context.Context, bucket, thumbnailPath string) (*ThumbnailResp, error) {
+	url, err := f.storages.GetObjectRequest(bucket, thumbnailPath, "", f.conf.Storage.URLExpire)
+	if err != nil {
+		logger.Logger.WithName("thumbnail").Errorw(err.Error(), header.GetRequestIDKV(ctx).Fuzzy()...)
+
+		return nil, error2.New(code.ErrSinger)
+	}
+
+	return &ThumbnailResp{
+		Path: f.externalPath(ctx, bucket, thumbnailPath),
+		URL:  url,
+	}, nil
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwk json web key, only the public keys and the symmetric keys are supported.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+type jwks struct {
+	Keys []*jwk `json:"keys"`
+}
+
+// keySet keys loaded from a jwks file, reloaded when the file changes.
+type keySet struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	keys    map[string]crypto.PublicKey
+}
+
+func newKeySet(path string) (*keySet, error) {
+	s := &keySet{
+		path: path,
+	}
+
+	return s, s.load()
+}
+
+func (s *keySet) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	loaded := s.keys != nil && info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	set := &jwks{}
+	err = json.Unmarshal(data, set)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.key()
+		if err != nil {
+			return fmt.Errorf("jwk %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// get returns the key of kid, the file is reloaded if the key is unknown.
+func (s *keySet) get(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+	if ok {
+		return key, true
+	}
+
+	if err := s.load(); err != nil {
+		return nil, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok = s.keys[kid]
+
+	return key, ok
+}
+
+func (k *jwk) key() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	// hash functions of the algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// errors of token verification.
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token is expired")
+)
+
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+	"HS256": crypto.SHA256,
+	"HS384": crypto.SHA384,
+	"HS512": crypto.SHA512,
+}
+
+// Claims the payload of token.
+type Claims map[string]interface{}
+
+// String returns the string claim of name.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+
+	return s
+}
+
+// Strings returns the claim of name as strings,
+// a string claim is split by spaces, such as scope.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+
+		return list
+	default:
+		return nil
+	}
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(v), 0), true
+}
+
+// Verifier verifies the signed tokens by the keys of a jwks file.
+type Verifier struct {
+	keys        *keySet
+	issuer      string
+	audience    string
+	leeway      time.Duration
+	optionalExp bool
+}
+
+// NewVerifier returns a verifier with the keys of the jwks file,
+// the issuer and the audience are checked if they are not empty.
+// Tokens without exp never expire, they are rejected unless optionalExp is true.
+func NewVerifier(jwksPath, issuer, audience string, leeway time.Duration, optionalExp bool) (*Verifier, error) {
+	keys, err := newKeySet(jwksPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{
+		keys:        keys,
+		issuer:      issuer,
+		audience:    audience,
+		leeway:      leeway,
+		optionalExp: optionalExp,
+	}, nil
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify verifies the signature and the registered claims of token.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	header := &tokenHeader{}
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	hash, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidToken, header.Alg)
+	}
+
+	key, ok := v.keys.get(header.Kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %s", ErrInvalidToken, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = verifySignature(header.Alg, hash, key, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := Claims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, v.validate(claims)
+}
+
+func (v *Verifier) validate(claims Claims) error {
+	now := time.Now()
+	exp, ok := claims.time("exp")
+	if !ok && !v.optionalExp {
+		return fmt.Errorf("%w: token without expiration", ErrInvalidToken)
+	}
+	if ok && now.After(exp.Add(v.leeway)) {
+		return ErrExpiredToken
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(v.leeway).Before(nbf) {
+		return fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+
+	if v.issuer != "" && claims.String("iss") != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+
+	if v.audience != "" {
+		for _, aud := range claims.Strings("aud") {
+			if aud == v.audience {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, signed, signature []byte) error {
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		if rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			break
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if ecdsa.Verify(k, digest, r, s) {
+			return nil
+		}
+	case []byte:
+		if !strings.HasPrefix(alg, "HS") {
+			break
+		}
+		mac := hmac.New(hash.New, k)
+		mac.Write(signed)
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
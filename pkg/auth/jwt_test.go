@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestVerifier(t *testing.T, optionalExp bool) *Verifier {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "oct",
+			"kid": "k1",
+			"k":   base64.RawURLEncoding.EncodeToString(testSecret),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewVerifier(path, "issuer", "fileserver", time.Minute, optionalExp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	signed := encode(map[string]string{"alg": "HS256", "kid": kid}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write([]byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now().Unix()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub": "alice",
+			"iss": "issuer",
+			"aud": []string{"other", "fileserver"},
+			"exp": now + 3600,
+		}
+	}
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		optionalExp bool
+		err         error
+	}{
+		{name: "valid", token: sign(t, "k1", valid())},
+		{name: "expired", token: sign(t, "k1", with("exp", now-3600)), err: ErrExpiredToken},
+		{name: "expired within leeway", token: sign(t, "k1", with("exp", now-10))},
+		{name: "without exp", token: sign(t, "k1", with("exp", nil)), err: ErrInvalidToken},
+		{name: "without exp optional", token: sign(t, "k1", with("exp", nil)), optionalExp: true},
+		{name: "not valid yet", token: sign(t, "k1", with("nbf", now+3600)), err: ErrInvalidToken},
+		{name: "unexpected issuer", token: sign(t, "k1", with("iss", "other")), err: ErrInvalidToken},
+		{name: "unexpected audience", token: sign(t, "k1", with("aud", "other")), err: ErrInvalidToken},
+		{name: "unknown key", token: sign(t, "k2", valid()), err: ErrInvalidToken},
+		{name: "tampered", token: sign(t, "k1", valid()) + "x", err: ErrInvalidToken},
+		{name: "malformed", token: "a.b", err: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := newTestVerifier(t, tt.optionalExp).Verify(tt.token)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.String("sub") != "alice" {
+				t.Errorf("sub = %q", claims.String("sub"))
+			}
+		})
+	}
+}
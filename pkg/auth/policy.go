@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+)
+
+// actions
+const (
+	Read   = "read"
+	Write  = "write"
+	Delete = "delete"
+	Admin  = "admin"
+)
+
+// effects
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+const any = "*"
+
+// Principal the authenticated caller.
+type Principal struct {
+	UserID   string
+	UserName string
+	TenantID string
+	AppID    string
+	Roles    []string
+}
+
+// is reports whether the principal matches the principal pattern.
+func (p *Principal) is(pattern string) bool {
+	if pattern == any {
+		return true
+	}
+
+	kind, id := split(pattern, ":")
+	switch kind {
+	case "user":
+		return id != "" && id == p.UserID
+	case "tenant":
+		return id != "" && id == p.TenantID
+	case "app":
+		return id != "" && id == p.AppID
+	case "role":
+		for _, role := range p.Roles {
+			if role == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Policy evaluates the rules, an action is allowed if any rule allows it and no rule denies it.
+type Policy struct {
+	rules []config.Policy
+}
+
+// NewPolicy returns a policy of rules.
+func NewPolicy(rules []config.Policy) *Policy {
+	return &Policy{
+		rules: rules,
+	}
+}
+
+// Allowed reports whether the principal may perform action on resource, which is bucket type/key.
+func (p *Policy) Allowed(principal *Principal, action, resource string) bool {
+	allowed := false
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if !matches(rule, principal, action, resource) {
+			continue
+		}
+
+		if rule.Effect == Deny {
+			return false
+		}
+		allowed = true
+	}
+
+	return allowed
+}
+
+func matches(rule *config.Policy, principal *Principal, action, resource string) bool {
+	return matchAny(rule.Principals, principal.is) &&
+		matchAny(rule.Actions, func(a string) bool {
+			return a == any || a == action
+		}) &&
+		matchAny(rule.Resources, func(pattern string) bool {
+			return matchResource(expand(pattern, principal), resource)
+		})
+}
+
+func matchAny(patterns []string, match func(string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expand replaces the variables of pattern with the ids of principal,
+// it returns an empty pattern if any of the variables is empty.
+func expand(pattern string, principal *Principal) string {
+	vars := map[string]string{
+		"{user}":   principal.UserID,
+		"{tenant}": principal.TenantID,
+		"{app}":    principal.AppID,
+	}
+	for name, value := range vars {
+		if !strings.Contains(pattern, name) {
+			continue
+		}
+		if value == "" {
+			return ""
+		}
+		pattern = strings.ReplaceAll(pattern, name, value)
+	}
+
+	return pattern
+}
+
+func matchResource(pattern, resource string) bool {
+	switch {
+	case pattern == "":
+		return false
+	case pattern == any:
+		return true
+	case strings.HasSuffix(pattern, any):
+		return strings.HasPrefix(resource, strings.TrimSuffix(pattern, any))
+	default:
+		return pattern == resource
+	}
+}
+
+func split(s, sep string) (string, string) {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return s, ""
+	}
+
+	return s[:i], s[i+len(sep):]
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/quanxiang-cloud/fileserver/pkg/misc/config"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	policy := NewPolicy([]config.Policy{
+		{
+			Effect:     Allow,
+			Principals: []string{"role:admin"},
+			Actions:    []string{"*"},
+			Resources:  []string{"*"},
+		},
+		{
+			Effect:     Allow,
+			Principals: []string{"*"},
+			Actions:    []string{Read, Write, Delete},
+			Resources:  []string{"private/{tenant}/*", "readable/{tenant}/*"},
+		},
+		{
+			Effect:     Allow,
+			Principals: []string{"*"},
+			Actions:    []string{Read},
+			Resources:  []string{"readable/public/logo.png"},
+		},
+		{
+			Effect:     Deny,
+			Principals: []string{"user:blocked"},
+			Actions:    []string{Write},
+			Resources:  []string{"*"},
+		},
+		{
+			Effect:     Allow,
+			Principals: []string{"app:report"},
+			Actions:    []string{Write},
+			Resources:  []string{"private/{tenant}/{app}/*"},
+		},
+	})
+
+	admin := &Principal{UserID: "root", Roles: []string{"admin"}}
+	alice := &Principal{UserID: "alice", TenantID: "t1", AppID: "report"}
+	blocked := &Principal{UserID: "blocked", TenantID: "t1"}
+	anonymous := &Principal{UserID: "guest"}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		action    string
+		resource  string
+		want      bool
+	}{
+		{"admin any action", admin, Admin, "*", true},
+		{"admin any path", admin, Delete, "private/t2/a.png", true},
+		{"tenant reads own prefix", alice, Read, "private/t1/a.png", true},
+		{"tenant writes own prefix", alice, Write, "readable/t1/dir/a.png", true},
+		{"tenant prefix itself", alice, Read, "private/t1/", true},
+		{"other tenant", alice, Read, "private/t2/a.png", false},
+		{"tenant as a prefix of another", alice, Read, "private/t10/a.png", false},
+		{"no admin action", alice, Admin, "*", false},
+		{"exact resource", anonymous, Read, "readable/public/logo.png", true},
+		{"exact resource other action", anonymous, Write, "readable/public/logo.png", false},
+		{"exact resource is not a prefix", anonymous, Read, "readable/public/logo.png.bak", false},
+		{"empty variable matches nothing", anonymous, Read, "private//a.png", false},
+		{"deny takes precedence", blocked, Write, "private/t1/a.png", false},
+		{"deny other actions untouched", blocked, Read, "private/t1/a.png", true},
+		{"app variable", alice, Write, "private/t1/report/a.csv", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Allowed(tt.principal, tt.action, tt.resource); got != tt.want {
+				t.Errorf("Allowed(%s, %s, %s) = %v, want %v", tt.principal.UserID, tt.action, tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyWithoutRules(t *testing.T) {
+	if NewPolicy(nil).Allowed(&Principal{UserID: "alice"}, Read, "private/a.png") {
+		t.Error("empty policy allows")
+	}
+}
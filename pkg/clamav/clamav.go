@@ -0,0 +1,135 @@
+package clamav
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultChunkSize = 64 * 1024
+	defaultTimeout   = time.Minute
+)
+
+// ErrScan clamd failed to scan the stream, e.g. the stream exceeds its StreamMaxLength.
+var ErrScan = errors.New("clamd scan error")
+
+// Result result of a scan.
+type Result struct {
+	Infected bool
+	// Signature the name of the signature matched.
+	Signature string
+}
+
+// Client clamd client speaking the INSTREAM protocol.
+type Client struct {
+	network   string
+	address   string
+	timeout   time.Duration
+	chunkSize int
+}
+
+// New returns a client of the clamd at address, which is tcp://host:port, unix:///path or host:port.
+func New(address string, timeout time.Duration, chunkSize int) *Client {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		network, address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	}
+
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	return &Client{
+		network:   network,
+		address:   address,
+		timeout:   timeout,
+		chunkSize: chunkSize,
+	}
+}
+
+// Scan streams r to clamd by chunks and returns the verdict.
+func (c *Client) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4+c.chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			_, werr := conn.Write(buf[:4+n])
+			if werr != nil {
+				// clamd closes the connection once the stream exceeds its limit,
+				// the reply tells the reason
+				break
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// a zero length chunk terminates the stream
+	_, _ = conn.Write([]byte{0, 0, 0, 0})
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return parse(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parse parses the reply, which is "stream: OK", "stream: <signature> FOUND" or "<message> ERROR".
+func parse(reply string) (*Result, error) {
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(signature, ": "); i >= 0 {
+			signature = signature[i+2:]
+		}
+
+		return &Result{
+			Infected:  true,
+			Signature: signature,
+		}, nil
+	case strings.HasSuffix(reply, " OK"):
+		return &Result{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrScan, reply)
+	}
+}
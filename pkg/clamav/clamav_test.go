@@ -0,0 +1,174 @@
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd serves the INSTREAM command like clamd, the stream is found infected
+// if it contains "EICAR", and streams longer than limit are rejected.
+// A non-empty reply is returned for every stream instead.
+type fakeClamd struct {
+	listener net.Listener
+	limit    int
+	reply    string
+}
+
+func newFakeClamd(t *testing.T, limit int, reply string) *fakeClamd {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fakeClamd{
+		listener: listener,
+		limit:    limit,
+		reply:    reply,
+	}
+	go d.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return d
+}
+
+func (d *fakeClamd) address() string {
+	return "tcp://" + d.listener.Addr().String()
+}
+
+func (d *fakeClamd) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	stream := &bytes.Buffer{}
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, size); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if _, err := io.CopyN(stream, r, int64(n)); err != nil {
+			return
+		}
+		if stream.Len() > d.limit {
+			_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			// the rest is drained so that the reply is not lost by a reset
+			_, _ = io.Copy(io.Discard, r)
+			return
+		}
+	}
+
+	reply := d.reply
+	switch {
+	case reply != "":
+	case strings.Contains(stream.String(), "EICAR"):
+		reply = "stream: Eicar-Test-Signature FOUND"
+	default:
+		reply = "stream: OK"
+	}
+	_, _ = conn.Write([]byte(reply + "\x00"))
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		reply     string
+		infected  bool
+		signature string
+		err       error
+	}{
+		{name: "clean", stream: strings.Repeat("clean ", 100)},
+		{name: "empty", stream: ""},
+		{name: "infected", stream: strings.Repeat("x", 40) + "EICAR" + strings.Repeat("x", 40), infected: true, signature: "Eicar-Test-Signature"},
+		{name: "size limit", stream: strings.Repeat("x", 4096), err: ErrScan},
+		{name: "error reply", stream: "clean", reply: "Can't allocate memory ERROR", err: ErrScan},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newFakeClamd(t, 1024, tt.reply)
+			result, err := New(d.address(), time.Second, 16).Scan(context.Background(), strings.NewReader(tt.stream))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Scan() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if result.Infected != tt.infected || result.Signature != tt.signature {
+				t.Errorf("Scan() = %+v, want infected %v with %q", result, tt.infected, tt.signature)
+			}
+		})
+	}
+}
+
+func TestScanUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	_, err = New(address, time.Second, 0).Scan(context.Background(), strings.NewReader("clean"))
+	if err == nil {
+		t.Error("Scan() without clamd succeeds")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		reply     string
+		infected  bool
+		signature string
+		err       bool
+	}{
+		{reply: "stream: OK"},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND", infected: true, signature: "Win.Test.EICAR_HDB-1"},
+		{reply: "INSTREAM size limit exceeded. ERROR", err: true},
+		{reply: "", err: true},
+	}
+
+	for _, tt := range tests {
+		result, err := parse(tt.reply)
+		if tt.err {
+			if !errors.Is(err, ErrScan) {
+				t.Errorf("parse(%q) error = %v", tt.reply, err)
+			}
+			continue
+		}
+		if err != nil || result.Infected != tt.infected || result.Signature != tt.signature {
+			t.Errorf("parse(%q) = %+v, %v", tt.reply, result, err)
+		}
+	}
+}
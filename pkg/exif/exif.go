@@ -0,0 +1,735 @@
+// Package exif reads the exif of images and strips the private metadata of jpeg, png and webp images.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrFormat the image or its exif is malformed.
+	ErrFormat = errors.New("exif: malformed image")
+	// ErrUnsupported the metadata of the format can not be stripped.
+	ErrUnsupported = errors.New("exif: unsupported format")
+)
+
+// maxEntries the maximum entries of an ifd.
+const maxEntries = 512
+
+// jpeg markers.
+const (
+	markerSOS  = 0xDA
+	markerEOI  = 0xD9
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+	markerAPP2 = 0xE2
+	// markerAPP13 photoshop resources, including iptc.
+	markerAPP13 = 0xED
+	markerCOM   = 0xFE
+)
+
+const (
+	exifIFDPointer = 0x8769
+	gpsIFDPointer  = 0x8825
+	orientationTag = 0x0112
+
+	gpsLatitudeRef  = 0x0001
+	gpsLatitude     = 0x0002
+	gpsLongitudeRef = 0x0003
+	gpsLongitude    = 0x0004
+	gpsAltitudeRef  = 0x0005
+	gpsAltitude     = 0x0006
+)
+
+var (
+	jpegSOI      = []byte{0xFF, 0xD8}
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+	mpfHeader    = []byte("MPF\x00")
+	riffHeader   = []byte("RIFF")
+	webpHeader   = []byte("WEBP")
+)
+
+// flags of the webp VP8X chunk.
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+// names of the tags read, by ifd.
+var (
+	imageTags = map[uint16]string{
+		0x010F: "Make",
+		0x0110: "Model",
+		0x0112: "Orientation",
+		0x0131: "Software",
+		0x0132: "DateTime",
+		0x013B: "Artist",
+		0x8298: "Copyright",
+	}
+	exifTags = map[uint16]string{
+		0x829A: "ExposureTime",
+		0x829D: "FNumber",
+		0x8827: "ISOSpeedRatings",
+		0x9003: "DateTimeOriginal",
+		0x9004: "DateTimeDigitized",
+		0x9010: "OffsetTime",
+		0x920A: "FocalLength",
+		0xA002: "PixelXDimension",
+		0xA003: "PixelYDimension",
+		0xA431: "BodySerialNumber",
+		0xA433: "LensMake",
+		0xA434: "LensModel",
+	}
+	gpsTags = map[uint16]string{
+		0x0007: "GPSTimeStamp",
+		0x001D: "GPSDateStamp",
+	}
+)
+
+// sizes of the tiff field types.
+var typeSizes = map[uint16]int{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+// Private reports whether the tag locates or identifies the camera of a photo,
+// that is the gps tags and the serial number of the body.
+func Private(name string) bool {
+	return strings.HasPrefix(name, "GPS") || name == "BodySerialNumber"
+}
+
+// Tags returns the known exif tags of the jpeg, png, webp or tiff image by their names, nil if it has no exif.
+// The gps coordinates are in signed decimal degrees, and the altitude in meters.
+func Tags(data []byte) (map[string]string, error) {
+	raw, err := find(data)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	return parse(raw)
+}
+
+// Strip returns the jpeg, png or webp image without exif, xmp and other private metadata,
+// the orientation is kept so that the image is displayed as before.
+func Strip(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	case isWebP(data):
+		return stripWebP(data)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// find returns the tiff structure holding the exif of the image, nil if there is none.
+func find(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		segments, _, err := jpegSegments(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range segments {
+			if s.marker == markerAPP1 && bytes.HasPrefix(s.payload(), exifHeader) {
+				return s.payload()[len(exifHeader):], nil
+			}
+		}
+	case bytes.HasPrefix(data, pngSignature):
+		chunks, err := pngChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunks {
+			if c.typ == "eXIf" {
+				return c.data, nil
+			}
+		}
+	case isWebP(data):
+		chunks, err := webpChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunks {
+			// some encoders keep the header of jpeg
+			if c.typ == "EXIF" {
+				return bytes.TrimPrefix(c.data, exifHeader), nil
+			}
+		}
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return data, nil
+	}
+
+	return nil, nil
+}
+
+// orientation returns the exif orientation of the image, 0 if it has none.
+func orientation(data []byte) int {
+	tags, err := Tags(data)
+	if err != nil {
+		return 0
+	}
+
+	o, err := strconv.Atoi(tags["Orientation"])
+	if err != nil || o < 1 || o > 8 {
+		return 0
+	}
+
+	return o
+}
+
+// segment a jpeg segment.
+type segment struct {
+	marker byte
+	// raw the whole segment, including the marker and length.
+	raw []byte
+}
+
+func (s segment) payload() []byte {
+	if len(s.raw) < 4 {
+		return nil
+	}
+
+	return s.raw[4:]
+}
+
+// jpegSegments splits the jpeg before the first scan into segments, and returns the offset of the scan.
+func jpegSegments(data []byte) ([]segment, int, error) {
+	segments := make([]segment, 0)
+	i := len(jpegSOI)
+	for {
+		// markers may be preceded by fill bytes
+		for i+1 < len(data) && data[i] == 0xFF && data[i+1] == 0xFF {
+			i++
+		}
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, 0, ErrFormat
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == markerSOS:
+			return segments, i, nil
+		case marker == markerEOI:
+			return nil, 0, ErrFormat
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// standalone markers without length
+			segments = append(segments, segment{marker: marker, raw: data[i : i+2]})
+			i += 2
+
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil, 0, ErrFormat
+		}
+		segments = append(segments, segment{marker: marker, raw: data[i : i+2+length]})
+		i += 2 + length
+	}
+}
+
+// jpegEnd returns the end of the image whose first scan starts at i,
+// the data after it, such as the secondary images of mpf, is not a part of the image.
+func jpegEnd(data []byte, i int) int {
+	for i+1 < len(data) {
+		if data[i] != 0xFF {
+			i++
+
+			continue
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			i++
+		case marker == 0x00 || (marker >= 0xD0 && marker <= 0xD7):
+			// stuffed bytes and restart markers of the entropy coded data
+			i += 2
+		case marker == markerEOI:
+			return i + 2
+		default:
+			// the headers of scans and the tables between the scans of progressive images
+			if i+4 > len(data) {
+				return len(data)
+			}
+			i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		}
+	}
+
+	return len(data)
+}
+
+// private reports whether the jpeg segment carries private metadata,
+// that is exif, xmp, iptc, comments and the index of the secondary images.
+func (s segment) private() bool {
+	switch s.marker {
+	case markerAPP1, markerAPP13, markerCOM:
+		return true
+	case markerAPP2:
+		return bytes.HasPrefix(s.payload(), mpfHeader)
+	default:
+		return false
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	segments, sos, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	o := orientation(data)
+	written := o <= 1
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(jpegSOI)
+	for _, s := range segments {
+		// the exif follows the jfif header
+		if !written && s.marker != markerAPP0 {
+			writeJPEGOrientation(out, o)
+			written = true
+		}
+		if s.private() {
+			continue
+		}
+		out.Write(s.raw)
+	}
+	if !written {
+		writeJPEGOrientation(out, o)
+	}
+	out.Write(data[sos:jpegEnd(data, sos)])
+
+	return out.Bytes(), nil
+}
+
+func writeJPEGOrientation(out *bytes.Buffer, o int) {
+	tiff := orientationTIFF(o)
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(2+len(exifHeader)+len(tiff)))
+
+	out.Write([]byte{0xFF, markerAPP1})
+	out.Write(length)
+	out.Write(exifHeader)
+	out.Write(tiff)
+}
+
+// orientationTIFF returns the exif holding the orientation only.
+func orientationTIFF(o int) []byte {
+	return []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		// one entry of SHORT
+		0x00, 0x01,
+		byte(orientationTag >> 8), byte(orientationTag & 0xFF), 0x00, 0x03, 0x00, 0x00, 0x00, 0x01,
+		byte(o >> 8), byte(o), 0x00, 0x00,
+		// no next ifd
+		0x00, 0x00, 0x00, 0x00,
+	}
+}
+
+// chunk a png chunk.
+type chunk struct {
+	typ  string
+	data []byte
+	// raw the whole chunk, including the length, type and crc.
+	raw []byte
+}
+
+func pngChunks(data []byte) ([]chunk, error) {
+	chunks := make([]chunk, 0)
+	i := len(pngSignature)
+	for i+12 <= len(data) {
+		n := binary.BigEndian.Uint32(data[i:])
+		if uint64(n) > uint64(len(data)-i-12) {
+			return nil, ErrFormat
+		}
+
+		end := i + 12 + int(n)
+		c := chunk{
+			typ:  string(data[i+4 : i+8]),
+			data: data[i+8 : end-4],
+			raw:  data[i:end],
+		}
+		chunks = append(chunks, c)
+		i = end
+
+		if c.typ == "IEND" {
+			return chunks, nil
+		}
+	}
+
+	return nil, ErrFormat
+}
+
+// private reports whether the png chunk carries private metadata,
+// that is exif, xmp and the raw profiles of imagemagick.
+func (c chunk) private() bool {
+	switch c.typ {
+	case "eXIf":
+		return true
+	case "tEXt", "zTXt", "iTXt":
+		keyword := c.data
+		if i := bytes.IndexByte(keyword, 0); i >= 0 {
+			keyword = keyword[:i]
+		}
+
+		return string(keyword) == "XML:com.adobe.xmp" || strings.HasPrefix(string(keyword), "Raw profile type")
+	default:
+		return false
+	}
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	o := orientation(data)
+	written := o <= 1
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	for _, c := range chunks {
+		// exif must precede the image data
+		if !written && (c.typ == "IDAT" || c.typ == "IEND") {
+			writePNGChunk(out, "eXIf", orientationTIFF(o))
+			written = true
+		}
+		if c.private() {
+			continue
+		}
+		out.Write(c.raw)
+	}
+
+	return out.Bytes(), nil
+}
+
+func writePNGChunk(out *bytes.Buffer, typ string, data []byte) {
+	b := make([]byte, 12+len(data))
+	binary.BigEndian.PutUint32(b, uint32(len(data)))
+	copy(b[4:], typ)
+	copy(b[8:], data)
+	binary.BigEndian.PutUint32(b[8+len(data):], crc32.ChecksumIEEE(b[4:8+len(data)]))
+
+	out.Write(b)
+}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && bytes.HasPrefix(data, riffHeader) && bytes.Equal(data[8:12], webpHeader)
+}
+
+// webpChunks splits the webp into chunks, the raw chunk includes the padding.
+func webpChunks(data []byte) ([]chunk, error) {
+	chunks := make([]chunk, 0)
+	i := 12
+	for i+8 <= len(data) {
+		n := binary.LittleEndian.Uint32(data[i+4:])
+		if uint64(n) > uint64(len(data)-i-8) {
+			return nil, ErrFormat
+		}
+
+		end := i + 8 + int(n)
+		c := chunk{
+			typ:  string(data[i : i+4]),
+			data: data[i+8 : end],
+		}
+		if n%2 == 1 && end < len(data) {
+			end++
+		}
+		c.raw = data[i:end]
+		chunks = append(chunks, c)
+		i = end
+	}
+
+	return chunks, nil
+}
+
+func stripWebP(data []byte) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	o := orientation(data)
+	extended := false
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	for _, c := range chunks {
+		switch c.typ {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			if len(c.data) == 0 {
+				return nil, ErrFormat
+			}
+			extended = true
+
+			raw := append([]byte{}, c.raw...)
+			raw[8] &^= webpFlagXMP | webpFlagEXIF
+			if o > 1 {
+				raw[8] |= webpFlagEXIF
+			}
+			out.Write(raw)
+		default:
+			out.Write(c.raw)
+		}
+	}
+
+	// the exif follows the image data, it requires the extended format
+	if extended && o > 1 {
+		tiff := orientationTIFF(o)
+		header := make([]byte, 8)
+		copy(header, "EXIF")
+		binary.LittleEndian.PutUint32(header[4:], uint32(len(tiff)))
+		out.Write(header)
+		out.Write(tiff)
+	}
+
+	b := out.Bytes()
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+
+	return b, nil
+}
+
+// entry an ifd entry.
+type entry struct {
+	typ   uint16
+	count int
+	value []byte
+}
+
+type reader struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+// parse parses the tiff structure of exif.
+func parse(b []byte) (map[string]string, error) {
+	if len(b) < 8 {
+		return nil, ErrFormat
+	}
+
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, ErrFormat
+	}
+	if order.Uint16(b[2:]) != 42 {
+		return nil, ErrFormat
+	}
+
+	r := &reader{b: b, order: order}
+	ifd0, err := r.ifd(order.Uint32(b[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	r.read(tags, ifd0, imageTags)
+
+	// the sub ifds are optional, the broken ones are ignored
+	if e, ok := ifd0[exifIFDPointer]; ok {
+		if sub, err := r.ifd(r.pointer(e)); err == nil {
+			r.read(tags, sub, exifTags)
+		}
+	}
+	if e, ok := ifd0[gpsIFDPointer]; ok {
+		if sub, err := r.ifd(r.pointer(e)); err == nil {
+			r.read(tags, sub, gpsTags)
+			r.readGPS(tags, sub)
+		}
+	}
+
+	return tags, nil
+}
+
+// ifd reads the entries of the ifd at offset.
+func (r *reader) ifd(offset uint32) (map[uint16]entry, error) {
+	if uint64(offset)+2 > uint64(len(r.b)) {
+		return nil, ErrFormat
+	}
+
+	n := int(r.order.Uint16(r.b[offset:]))
+	if n > maxEntries || int(offset)+2+n*12 > len(r.b) {
+		return nil, ErrFormat
+	}
+
+	entries := make(map[uint16]entry, n)
+	for i := 0; i < n; i++ {
+		e := r.b[int(offset)+2+i*12:]
+		typ := r.order.Uint16(e[2:])
+		count := r.order.Uint32(e[4:])
+
+		size, ok := typeSizes[typ]
+		if !ok || uint64(count)*uint64(size) > uint64(len(r.b)) {
+			continue
+		}
+
+		// values longer than 4 bytes are stored at the offset
+		var value []byte
+		length := int(count) * size
+		if length > 4 {
+			off := r.order.Uint32(e[8:])
+			if uint64(off)+uint64(length) > uint64(len(r.b)) {
+				continue
+			}
+			value = r.b[off : int(off)+length]
+		} else {
+			value = e[8 : 8+length]
+		}
+
+		entries[r.order.Uint16(e)] = entry{typ: typ, count: int(count), value: value}
+	}
+
+	return entries, nil
+}
+
+func (r *reader) pointer(e entry) uint32 {
+	if e.typ != 4 || e.count != 1 {
+		return math.MaxUint32
+	}
+
+	return r.order.Uint32(e.value)
+}
+
+// read reads the entries of ifd named in names into tags.
+func (r *reader) read(tags map[string]string, ifd map[uint16]entry, names map[uint16]string) {
+	for id, e := range ifd {
+		name, ok := names[id]
+		if !ok {
+			continue
+		}
+
+		if value := r.format(e); value != "" {
+			tags[name] = value
+		}
+	}
+}
+
+// readGPS reads the coordinates and altitude of the gps ifd into tags.
+func (r *reader) readGPS(tags map[string]string, ifd map[uint16]entry) {
+	coordinate := func(id, refID uint16, negative string) (float64, bool) {
+		values := r.rationals(ifd[id])
+		if len(values) != 3 {
+			return 0, false
+		}
+
+		v := values[0] + values[1]/60 + values[2]/3600
+		if ref := ifd[refID]; strings.HasPrefix(string(ref.value), negative) {
+			v = -v
+		}
+
+		return v, true
+	}
+
+	if v, ok := coordinate(gpsLatitude, gpsLatitudeRef, "S"); ok {
+		tags["GPSLatitude"] = strconv.FormatFloat(v, 'f', 6, 64)
+	}
+	if v, ok := coordinate(gpsLongitude, gpsLongitudeRef, "W"); ok {
+		tags["GPSLongitude"] = strconv.FormatFloat(v, 'f', 6, 64)
+	}
+
+	if values := r.rationals(ifd[gpsAltitude]); len(values) == 1 {
+		v := values[0]
+		// 1 means below the sea level
+		if ref := ifd[gpsAltitudeRef]; len(ref.value) == 1 && ref.value[0] == 1 {
+			v = -v
+		}
+		tags["GPSAltitude"] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+func (r *reader) rationals(e entry) []float64 {
+	if e.typ != 5 && e.typ != 10 {
+		return nil
+	}
+
+	values := make([]float64, 0, e.count)
+	for i := 0; i < e.count; i++ {
+		var num, den float64
+		if e.typ == 5 {
+			num = float64(r.order.Uint32(e.value[i*8:]))
+			den = float64(r.order.Uint32(e.value[i*8+4:]))
+		} else {
+			num = float64(int32(r.order.Uint32(e.value[i*8:])))
+			den = float64(int32(r.order.Uint32(e.value[i*8+4:])))
+		}
+		if den == 0 {
+			return nil
+		}
+		values = append(values, num/den)
+	}
+
+	return values
+}
+
+// format returns the value of entry as a string, multiple values are separated by commas.
+func (r *reader) format(e entry) string {
+	switch e.typ {
+	case 2:
+		return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+	case 1, 7:
+		if printable(e.value) {
+			return strings.TrimSpace(string(e.value))
+		}
+	case 5, 10:
+		values := r.rationals(e)
+		s := make([]string, 0, len(values))
+		for _, v := range values {
+			s = append(s, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+
+		return strings.Join(s, ",")
+	}
+
+	s := make([]string, 0, e.count)
+	for i := 0; i < e.count; i++ {
+		switch e.typ {
+		case 1, 7:
+			s = append(s, strconv.Itoa(int(e.value[i])))
+		case 3:
+			s = append(s, strconv.Itoa(int(r.order.Uint16(e.value[i*2:]))))
+		case 4:
+			s = append(s, strconv.FormatUint(uint64(r.order.Uint32(e.value[i*4:])), 10))
+		case 9:
+			s = append(s, strconv.Itoa(int(int32(r.order.Uint32(e.value[i*4:])))))
+		}
+	}
+
+	return strings.Join(s, ",")
+}
+
+func printable(b []byte) bool {
+	b = bytes.TrimRight(b, "\x00")
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+//go:build go1.18
+// +build go1.18
+
+package exif
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// fuzzSeeds returns the valid test images and the tiff with broken offsets and counts.
+func fuzzSeeds(f *testing.F) [][]byte {
+	tiff := testTIFF()
+	corrupt := func(offset int, v uint32) []byte {
+		b := append([]byte{}, tiff...)
+		binary.BigEndian.PutUint32(b[offset:], v)
+
+		return b
+	}
+
+	return [][]byte{
+		testJPEG(f),
+		testPNG(f),
+		testWebP(),
+		tiff,
+		// ifd0 out of range
+		corrupt(4, 0xFFFFFFF0),
+		// ifd0 pointing to itself
+		corrupt(4, 0),
+		// the count of Make too large
+		corrupt(8+2+4, 0xFFFFFFFF),
+		// the value of Make out of range
+		corrupt(8+2+8, 0xFFFFFFF0),
+		// the gps ifd out of range
+		corrupt(8+2+2*12+8, 0xFFFFFFF0),
+		// the gps ifd pointing to ifd0
+		corrupt(8+2+2*12+8, 8),
+		testJPEG(f)[:40],
+		testPNG(f)[:50],
+		testWebP()[:30],
+	}
+}
+
+func FuzzTags(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = Tags(data)
+	})
+}
+
+func FuzzStrip(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		stripped, err := Strip(data)
+		if err != nil {
+			return
+		}
+
+		// the stripped image is parsed again without private tags
+		tags, err := Tags(stripped)
+		if err != nil {
+			return
+		}
+		for name := range tags {
+			if name != "Orientation" {
+				t.Errorf("Strip() keeps %s", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,317 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// field an ifd entry of the test images.
+type field struct {
+	id    uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func ascii(id uint16, s string) field {
+	return field{id: id, typ: 2, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func short(id uint16, v uint16) field {
+	return field{id: id, typ: 3, count: 1, value: []byte{byte(v >> 8), byte(v), 0, 0}}
+}
+
+func long(id uint16, v uint32) field {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+
+	return field{id: id, typ: 4, count: 1, value: b}
+}
+
+func rationals(id uint16, values ...uint32) field {
+	b := make([]byte, 0, len(values)*4)
+	for _, v := range values {
+		b = appendUint32(b, v)
+	}
+
+	return field{id: id, typ: 5, count: uint32(len(values) / 2), value: b}
+}
+
+// ifdBytes encodes the big-endian ifd at offset, followed by its values longer than 4 bytes.
+func ifdBytes(offset uint32, fields []field) []byte {
+	data := offset + 2 + uint32(len(fields))*12 + 4
+	b := appendUint16(nil, uint16(len(fields)))
+	values := make([]byte, 0)
+	for _, f := range fields {
+		b = appendUint16(b, f.id)
+		b = appendUint16(b, f.typ)
+		b = appendUint32(b, f.count)
+		if len(f.value) <= 4 {
+			b = append(b, f.value...)
+			b = append(b, make([]byte, 4-len(f.value))...)
+
+			continue
+		}
+		b = appendUint32(b, data+uint32(len(values)))
+		values = append(values, f.value...)
+	}
+	b = append(b, 0, 0, 0, 0)
+
+	return append(b, values...)
+}
+
+// testTIFF returns the exif of a photo taken by a Canon at 35°30'N 139°45'36"W, rotated by orientation 6.
+func testTIFF() []byte {
+	ifd0 := []field{
+		ascii(0x010F, "Canon"),
+		short(orientationTag, 6),
+		long(gpsIFDPointer, 0),
+	}
+	gps := []field{
+		ascii(gpsLatitudeRef, "N"),
+		rationals(gpsLatitude, 35, 1, 30, 1, 0, 1),
+		ascii(gpsLongitudeRef, "W"),
+		rationals(gpsLongitude, 139, 1, 45, 1, 36, 1),
+	}
+
+	b := []byte{'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08}
+	ifd0[2] = long(gpsIFDPointer, uint32(len(b)+len(ifdBytes(8, ifd0))))
+	b = append(b, ifdBytes(8, ifd0)...)
+
+	return append(b, ifdBytes(uint32(len(b)), gps)...)
+}
+
+func testImage() image.Image {
+	return image.NewGray(image.Rect(0, 0, 8, 8))
+}
+
+// testJPEG returns a jpeg with the exif, xmp and a comment after the start of image.
+func testJPEG(t testing.TB) []byte {
+	out := &bytes.Buffer{}
+	if err := jpeg.Encode(out, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := out.Bytes()
+
+	segment := func(marker byte, payload []byte) []byte {
+		b := []byte{0xFF, marker}
+		b = appendUint16(b, uint16(2+len(payload)))
+
+		return append(b, payload...)
+	}
+
+	b := append([]byte{}, jpegSOI...)
+	b = append(b, segment(markerAPP1, append(append([]byte{}, exifHeader...), testTIFF()...))...)
+	b = append(b, segment(markerAPP1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))...)
+	b = append(b, segment(markerCOM, []byte("taken at home"))...)
+
+	return append(b, encoded[len(jpegSOI):]...)
+}
+
+// testPNG returns a png with the exif, xmp and a title after the header.
+func testPNG(t testing.TB) []byte {
+	out := &bytes.Buffer{}
+	if err := png.Encode(out, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	encoded := out.Bytes()
+	// the signature and IHDR
+	header := len(pngSignature) + 25
+
+	chunks := &bytes.Buffer{}
+	writePNGChunk(chunks, "eXIf", testTIFF())
+	writePNGChunk(chunks, "iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))
+	writePNGChunk(chunks, "tEXt", []byte("Title\x00holiday"))
+
+	b := append([]byte{}, encoded[:header]...)
+	b = append(b, chunks.Bytes()...)
+
+	return append(b, encoded[header:]...)
+}
+
+// testWebP returns an extended webp with the exif and xmp, the image data is not valid.
+func testWebP() []byte {
+	chunk := func(typ string, data []byte) []byte {
+		b := append([]byte(typ), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+		b = append(b, data...)
+		if len(data)%2 == 1 {
+			b = append(b, 0)
+		}
+
+		return b
+	}
+
+	b := append([]byte("RIFF"), 0, 0, 0, 0)
+	b = append(b, webpHeader...)
+	b = append(b, chunk("VP8X", []byte{webpFlagEXIF | webpFlagXMP, 0, 0, 0, 7, 0, 0, 7, 0, 0})...)
+	b = append(b, chunk("VP8L", []byte{0x2F, 0x07, 0xC0, 0x01, 0x00})...)
+	b = append(b, chunk("EXIF", append(append([]byte{}, exifHeader...), testTIFF()...))...)
+	b = append(b, chunk("XMP ", []byte("<x:xmpmeta/>"))...)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+
+	return b
+}
+
+func TestTags(t *testing.T) {
+	want := map[string]string{
+		"Make":         "Canon",
+		"Orientation":  "6",
+		"GPSLatitude":  "35.500000",
+		"GPSLongitude": "-139.760000",
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want map[string]string
+		err  error
+	}{
+		{"jpeg", testJPEG(t), want, nil},
+		{"png", testPNG(t), want, nil},
+		{"webp", testWebP(), want, nil},
+		{"tiff", testTIFF(), want, nil},
+		{"no exif", []byte("GIF89a"), nil, nil},
+		{"truncated jpeg", testJPEG(t)[:20], nil, ErrFormat},
+		{"bad byte order", append([]byte("XX"), testTIFF()[2:]...), nil, nil},
+		{"ifd out of range", append(testTIFF()[:4], 0xFF, 0xFF, 0xFF, 0xF0), nil, ErrFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, err := Tags(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Tags() error = %v, want %v", err, tt.err)
+			}
+			if len(tags) != len(tt.want) {
+				t.Errorf("Tags() = %v, want %v", tags, tt.want)
+			}
+			for name, value := range tt.want {
+				if tags[name] != value {
+					t.Errorf("Tags()[%s] = %q, want %q", name, tags[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	decodeJPEG := func(b []byte) error {
+		_, err := jpeg.Decode(bytes.NewReader(b))
+		return err
+	}
+	decodePNG := func(b []byte) error {
+		_, err := png.Decode(bytes.NewReader(b))
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		decode func([]byte) error
+		kept   []string
+		err    error
+	}{
+		{"jpeg", testJPEG(t), decodeJPEG, nil, nil},
+		{"png", testPNG(t), decodePNG, []string{"holiday"}, nil},
+		{"webp", testWebP(), nil, nil, nil},
+		{"tiff", testTIFF(), nil, nil, ErrUnsupported},
+		{"truncated png", testPNG(t)[:60], nil, nil, ErrFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripped, err := Strip(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Strip() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			tags, err := Tags(stripped)
+			if err != nil {
+				t.Fatalf("Tags() error = %v", err)
+			}
+			if len(tags) != 1 || tags["Orientation"] != "6" {
+				t.Errorf("Tags() = %v, want the orientation only", tags)
+			}
+
+			for _, private := range []string{"Canon", "xmpmeta", "taken at home"} {
+				if bytes.Contains(stripped, []byte(private)) {
+					t.Errorf("Strip() keeps %q", private)
+				}
+			}
+			for _, kept := range tt.kept {
+				if !bytes.Contains(stripped, []byte(kept)) {
+					t.Errorf("Strip() removes %q", kept)
+				}
+			}
+
+			if tt.decode != nil {
+				if err := tt.decode(stripped); err != nil {
+					t.Errorf("decode stripped image: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStripIdempotent(t *testing.T) {
+	data := testJPEG(t)
+	stripped, err := Strip(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the orientation written by Strip is kept as is
+	again, err := Strip(stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, stripped) {
+		t.Error("Strip() is not idempotent")
+	}
+
+	out := &bytes.Buffer{}
+	if err := png.Encode(out, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	stripped, err = Strip(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, out.Bytes()) {
+		t.Error("Strip() changes the png without metadata")
+	}
+}
+
+func TestPrivate(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"GPSLatitude", true},
+		{"GPSDateStamp", true},
+		{"BodySerialNumber", true},
+		{"Orientation", false},
+		{"Make", false},
+		{"DateTimeOriginal", false},
+	}
+	for _, tt := range tests {
+		if got := Private(tt.name); got != tt.want {
+			t.Errorf("Private(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,11 @@ package guide
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -22,16 +27,22 @@ const (
 	uploadPath        = "%s/api/v1/fileserver/sign/upload"
 	downloadPath      = "%s/api/v1/fileserver/sign/download"
 	initMultipartPath = "%s/api/v1/fileserver/sign/initMultipart"
-	uploadPartPath    = "%s/api/v1/fileserver/sign/uploadMultipart"
+	uploadPartsPath   = "%s/api/v1/fileserver/sign/uploadMultipartBatch"
 	completePath      = "%s/api/v1/fileserver/sign/completeMultipart"
 	deletePath        = "%s/api/v1/fileserver/del"
 	finishPath        = "%s/api/v1/fileserver/sign/finish"
+	precheckPath      = "%s/api/v1/fileserver/sign/precheck"
 )
 
 const (
 	// the maximum upload limit of a single file. If the limit is exceeded, it will be uploaded by fragment.
 	defaultLimit = 5 * 1024 * 1024 // 30MB
 	byteSize     = 5 * 1024 * 1024 // 5MB
+	// the number of part urls presigned in one request.
+	presignWindow = 100
+	// the number of parts buffered and presigned in one request if the reader can not be rewound,
+	// which bounds the memory used to bufferedWindow * part size.
+	bufferedWindow = 16
 )
 
 // Guide Guide.
@@ -63,14 +74,43 @@ func NewGuide() (*Guide, error) {
 
 // Resp get return parameters.
 type Resp struct {
-	Private  string `json:"private"`
-	URL      string `json:"url"`
-	UploadID string `json:"uploadID"`
+	Private  string            `json:"private"`
+	URL      string            `json:"url"`
+	UploadID string            `json:"uploadID"`
+	Headers  map[string]string `json:"headers"`
+	PartSize int64             `json:"partSize"`
+	Parts    []*presignedPart  `json:"parts"`
+	Done     bool              `json:"done"`
+}
+
+// presignedPart presigned url of part.
+type presignedPart struct {
+	PartNumber int               `json:"partNumber"`
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers"`
+}
+
+// completedPart part uploaded by the guide.
+type completedPart struct {
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"etag"`
 }
 
 // UploadFile upload file.
+// If r is an io.ReadSeeker, the content is hashed first and
+// nothing is uploaded when the server already holds the same content.
 func (g *Guide) UploadFile(ctx context.Context, path string, r io.Reader, size int64) error {
 	path = filepath.Join(g.bucket, path)
+	if rs, ok := r.(io.ReadSeeker); ok {
+		done, err := g.precheck(ctx, path, rs, size)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+
 	if size > defaultLimit {
 		err := g.multipartUpload(ctx, path, r, size)
 		if err != nil {
@@ -80,7 +120,7 @@ func (g *Guide) UploadFile(ctx context.Context, path string, r io.Reader, size i
 		return g.finish(ctx, path)
 	}
 
-	resp, err := g.getUploadURL(ctx, path)
+	resp, err := g.getUploadURL(ctx, path, size)
 	if err != nil {
 		return err
 	}
@@ -102,41 +142,171 @@ func (g *Guide) UploadFile(ctx context.Context, path string, r io.Reader, size i
 }
 
 func (g *Guide) multipartUpload(ctx context.Context, path string, r io.Reader, size int64) error {
-	partNums := getPartNums(size)
-
-	// get uploadid
-	resp, err := g.getUploadID(ctx, path)
+	// get uploadid and part size, the part urls are presigned with the md5 of parts below
+	resp, err := g.getUploadID(ctx, path, size)
 	if err != nil {
 		return err
 	}
 
-	byteArr := make([]byte, byteSize)
-	for i := 1; i <= partNums; i++ {
-		partSize, err := r.Read(byteArr)
-		if err != nil {
-			return err
+	partSize := resp.PartSize
+	if partSize <= 0 {
+		partSize = byteSize
+	}
+	partNums := getPartNums(size, partSize)
+
+	// the parts of a reader which can not be rewound are buffered to be hashed before they are uploaded
+	rs, seekable := r.(io.ReadSeeker)
+	buffers := make([][]byte, 0, bufferedWindow)
+	byteArr := make([]byte, partSize)
+	parts := make([]*completedPart, 0, partNums)
+	for first := 1; first <= partNums; {
+		var (
+			checksums []*partChecksum
+			buffered  [][]byte
+		)
+		if seekable {
+			checksums, err = readAheadChecksums(rs, first, partNums-first+1, partSize)
+		} else {
+			buffered, buffers, err = readParts(r, buffers, partNums-first+1, partSize)
+			for i, part := range buffered {
+				checksums = append(checksums, newPartChecksum(first+i, part))
+			}
 		}
-		// get block upload link
-		partResp, err := g.getPartUploadURL(ctx, i, int64(partSize), path, resp.UploadID)
 		if err != nil {
 			return err
 		}
-		// upload block
-		request, err := http.NewRequest(http.MethodPut, partResp.URL, bytes.NewReader(byteArr[:partSize]))
+
+		// get block upload links pinned by the md5 of blocks in batch
+		batch, err := g.getPartUploadURLs(ctx, path, resp.UploadID, checksums)
 		if err != nil {
 			return err
 		}
-		request.ContentLength = int64(partSize)
-		request.Header.Set(contentTypeKey, contentType)
+		presigned := make(map[int]*presignedPart, len(batch.Parts))
+		for _, p := range batch.Parts {
+			presigned[p.PartNumber] = p
+		}
 
-		_, err = g.client.Do(request)
-		if err != nil {
-			return err
+		for i := range checksums {
+			number := first + i
+			partResp, ok := presigned[number]
+			if !ok {
+				return fmt.Errorf("part %d is not presigned", number)
+			}
+
+			var part []byte
+			if seekable {
+				n, err := io.ReadFull(r, byteArr)
+				if err != nil && err != io.ErrUnexpectedEOF {
+					return err
+				}
+				part = byteArr[:n]
+			} else {
+				part = buffered[i]
+			}
+
+			etag, err := g.uploadPart(partResp, part)
+			if err != nil {
+				return fmt.Errorf("upload part %d failed: %w", number, err)
+			}
+			parts = append(parts, &completedPart{
+				PartNumber: number,
+				ETag:       etag,
+			})
 		}
+		first += len(checksums)
 	}
 
 	// merge block
-	return g.completeMultipart(ctx, path, resp.UploadID)
+	return g.completeMultipart(ctx, path, resp.UploadID, parts)
+}
+
+// uploadPart uploads the block to the presigned url, and returns its etag.
+func (g *Guide) uploadPart(partResp *presignedPart, part []byte) (string, error) {
+	request, err := http.NewRequest(http.MethodPut, partResp.URL, bytes.NewReader(part))
+	if err != nil {
+		return "", err
+	}
+	for k, v := range partResp.Headers {
+		request.Header.Set(k, v)
+	}
+	request.ContentLength = int64(len(part))
+	request.Header.Set(contentTypeKey, contentType)
+
+	response, err := g.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", errors.New(response.Status)
+	}
+
+	return response.Header.Get("ETag"), nil
+}
+
+// partChecksum part number with its base64 encoded md5.
+type partChecksum struct {
+	PartNumber int    `json:"partNumber"`
+	ContentMD5 string `json:"contentMD5"`
+}
+
+func newPartChecksum(number int, part []byte) *partChecksum {
+	sum := md5.Sum(part) // nolint:gosec
+	return &partChecksum{
+		PartNumber: number,
+		ContentMD5: base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+// readAheadChecksums returns the checksums of the window of parts from part first on,
+// at most remaining, and rewinds rs to the first part.
+func readAheadChecksums(rs io.ReadSeeker, first, remaining int, partSize int64) ([]*partChecksum, error) {
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining > presignWindow {
+		remaining = presignWindow
+	}
+	checksums := make([]*partChecksum, 0, remaining)
+	for i := 0; i < remaining; i++ {
+		h := md5.New() // nolint:gosec
+		_, err = io.CopyN(h, rs, partSize)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		checksums = append(checksums, &partChecksum{
+			PartNumber: first + i,
+			ContentMD5: base64.StdEncoding.EncodeToString(h.Sum(nil)),
+		})
+	}
+
+	_, err = rs.Seek(offset, io.SeekStart)
+	return checksums, err
+}
+
+// readParts reads the window of parts, at most remaining, into the buffers, which are allocated as needed.
+// It returns the parts read and the buffers to be reused.
+func readParts(r io.Reader, buffers [][]byte, remaining int, partSize int64) ([][]byte, [][]byte, error) {
+	if remaining > bufferedWindow {
+		remaining = bufferedWindow
+	}
+
+	parts := make([][]byte, 0, remaining)
+	for i := 0; i < remaining; i++ {
+		if i == len(buffers) {
+			buffers = append(buffers, make([]byte, partSize))
+		}
+
+		n, err := io.ReadFull(r, buffers[i])
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, buffers, err
+		}
+		parts = append(parts, buffers[i][:n])
+	}
+
+	return parts, buffers, nil
 }
 
 // DownloadFile download file.
@@ -196,7 +366,7 @@ func (g *Guide) getBucket() (*Resp, error) {
 	return resp, err
 }
 
-func (g *Guide) getUploadURL(ctx context.Context, path string) (*Resp, error) {
+func (g *Guide) getUploadURL(ctx context.Context, path string, size int64) (*Resp, error) {
 	resp := &Resp{}
 
 	url := g.getRequestURL(uploadPath)
@@ -204,8 +374,10 @@ func (g *Guide) getUploadURL(ctx context.Context, path string) (*Resp, error) {
 		ctx, g.client, url,
 		struct {
 			Path string `json:"path"`
+			Size int64  `json:"size"`
 		}{
 			Path: path,
+			Size: size,
 		},
 		resp,
 	)
@@ -216,7 +388,7 @@ func (g *Guide) getUploadURL(ctx context.Context, path string) (*Resp, error) {
 	return resp, nil
 }
 
-func (g *Guide) getUploadID(ctx context.Context, path string) (*Resp, error) {
+func (g *Guide) getUploadID(ctx context.Context, path string, size int64) (*Resp, error) {
 	resp := &Resp{}
 
 	url := g.getRequestURL(initMultipartPath)
@@ -225,9 +397,11 @@ func (g *Guide) getUploadID(ctx context.Context, path string) (*Resp, error) {
 		struct {
 			Path        string `json:"path"`
 			ContentType string `json:"contentType"`
+			Size        int64  `json:"size"`
 		}{
 			Path:        path,
 			ContentType: contentType,
+			Size:        size,
 		},
 		resp,
 	)
@@ -235,30 +409,30 @@ func (g *Guide) getUploadID(ctx context.Context, path string) (*Resp, error) {
 	return resp, err
 }
 
-func getPartNums(size int64) int {
-	partNum := int(size / byteSize)
+func getPartNums(size, partSize int64) int {
+	partNum := int(size / partSize)
 
-	if (size % byteSize) == 0 {
+	if (size % partSize) == 0 {
 		return partNum
 	}
 
 	return partNum + 1
 }
 
-func (g *Guide) getPartUploadURL(ctx context.Context, partNumber int, partSize int64, path, uploadID string) (*Resp, error) {
+func (g *Guide) getPartUploadURLs(ctx context.Context, path, uploadID string, checksums []*partChecksum) (*Resp, error) {
 	resp := &Resp{}
 
-	url := g.getRequestURL(uploadPartPath)
+	url := g.getRequestURL(uploadPartsPath)
 	err := client.POST(
 		ctx, g.client, url,
 		struct {
-			UploadID   string `json:"uploadID"`
-			PartNumber int    `json:"partNumber"`
-			Path       string `json:"path"`
+			UploadID string          `json:"uploadID"`
+			Path     string          `json:"path"`
+			Parts    []*partChecksum `json:"parts"`
 		}{
-			UploadID:   uploadID,
-			PartNumber: partNumber,
-			Path:       path,
+			UploadID: uploadID,
+			Path:     path,
+			Parts:    checksums,
 		},
 		resp,
 	)
@@ -266,18 +440,20 @@ func (g *Guide) getPartUploadURL(ctx context.Context, partNumber int, partSize i
 	return resp, err
 }
 
-func (g *Guide) completeMultipart(ctx context.Context, path, uploadID string) error {
+func (g *Guide) completeMultipart(ctx context.Context, path, uploadID string, parts []*completedPart) error {
 	resp := &Resp{}
 
 	url := g.getRequestURL(completePath)
 	err := client.POST(
 		ctx, g.client, url,
 		struct {
-			UploadID string `json:"uploadID"`
-			Path     string `json:"path"`
+			UploadID string           `json:"uploadID"`
+			Path     string           `json:"path"`
+			Parts    []*completedPart `json:"parts"`
 		}{
 			UploadID: uploadID,
 			Path:     path,
+			Parts:    parts,
 		},
 		resp,
 	)
@@ -301,6 +477,40 @@ func (g *Guide) finish(ctx context.Context, path string) error {
 	return err
 }
 
+// precheck hashes the size bytes of rs from its current offset, and rewinds it to the offset.
+func (g *Guide) precheck(ctx context.Context, path string, rs io.ReadSeeker, size int64) (bool, error) {
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, rs, size); err != nil {
+		return false, err
+	}
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	resp := &Resp{}
+	url := g.getRequestURL(precheckPath)
+	err = client.POST(
+		ctx, g.client, url,
+		struct {
+			Path   string `json:"path"`
+			Size   int64  `json:"size"`
+			SHA256 string `json:"sha256"`
+		}{
+			Path:   path,
+			Size:   size,
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		},
+		resp,
+	)
+
+	return resp.Done, err
+}
+
 func (g *Guide) getRequestURL(format string) string {
 	return fmt.Sprintf(format, g.endpoint)
 }
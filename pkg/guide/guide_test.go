@@ -0,0 +1,183 @@
+package guide
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer serves the multipart apis of fileserver and the presigned part urls,
+// the parts are accepted only with the md5 they are presigned by.
+type fakeServer struct {
+	*httptest.Server
+	partSize int64
+
+	mu        sync.Mutex
+	batches   int
+	parts     map[int][]byte
+	completed []*completedPart
+	precheck  map[string]interface{}
+}
+
+func newFakeServer(t *testing.T, partSize int64) *fakeServer {
+	s := &fakeServer{
+		partSize: partSize,
+		parts:    make(map[int][]byte),
+	}
+
+	reply := func(w http.ResponseWriter, data interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "data": data})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/fileserver/sign/initMultipart", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, &Resp{UploadID: "upload", PartSize: s.partSize})
+	})
+	mux.HandleFunc("/api/v1/fileserver/sign/uploadMultipartBatch", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Parts []*partChecksum `json:"parts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		s.mu.Lock()
+		s.batches++
+		s.mu.Unlock()
+
+		resp := &Resp{}
+		for _, p := range req.Parts {
+			resp.Parts = append(resp.Parts, &presignedPart{
+				PartNumber: p.PartNumber,
+				URL:        s.URL + "/part/" + strconv.Itoa(p.PartNumber),
+				Headers:    map[string]string{"Content-MD5": p.ContentMD5},
+			})
+		}
+		reply(w, resp)
+	})
+	mux.HandleFunc("/part/", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/part/"))
+		body, _ := io.ReadAll(r.Body)
+		sum := md5.Sum(body) // nolint:gosec
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		s.mu.Lock()
+		s.parts[number] = body
+		s.mu.Unlock()
+		w.Header().Set("ETag", fmt.Sprintf("%q", strconv.Itoa(number)))
+	})
+	mux.HandleFunc("/api/v1/fileserver/sign/completeMultipart", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Parts []*completedPart `json:"parts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		s.completed = req.Parts
+		reply(w, &Resp{})
+	})
+
+	mux.HandleFunc("/api/v1/fileserver/sign/precheck", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&s.precheck); err != nil {
+			t.Error(err)
+		}
+		reply(w, &Resp{})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// content returns the parts uploaded, in the order they are completed.
+func (s *fakeServer) content() []byte {
+	b := make([]byte, 0)
+	for _, p := range s.completed {
+		b = append(b, s.parts[p.PartNumber]...)
+	}
+
+	return b
+}
+
+// reader hides the Seek method of the underlying reader.
+type reader struct {
+	io.Reader
+}
+
+func TestMultipartUpload(t *testing.T) {
+	const partSize = 4
+	data := []byte(strings.Repeat("0123456789", 10))
+	partNums := getPartNums(int64(len(data)), partSize)
+
+	tests := []struct {
+		name    string
+		r       io.Reader
+		batches int
+	}{
+		{"seeker", bytes.NewReader(data), 1},
+		{"stream", reader{bytes.NewReader(data)}, (partNums + bufferedWindow - 1) / bufferedWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeServer(t, partSize)
+			g := &Guide{endpoint: s.URL, client: s.Client()}
+
+			err := g.multipartUpload(context.Background(), "private/a.bin", tt.r, int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.batches != tt.batches {
+				t.Errorf("presign batches = %d, want %d", s.batches, tt.batches)
+			}
+			if len(s.completed) != partNums {
+				t.Errorf("completed parts = %d, want %d", len(s.completed), partNums)
+			}
+			if !bytes.Equal(s.content(), data) {
+				t.Errorf("uploaded content = %q, want %q", s.content(), data)
+			}
+		})
+	}
+}
+
+func TestPrecheck(t *testing.T) {
+	data := []byte("headerpayload-trailer")
+	s := newFakeServer(t, 4)
+	g := &Guide{endpoint: s.URL, client: s.Client()}
+
+	// the reader is positioned after the header, the payload is followed by a trailer
+	r := bytes.NewReader(data)
+	if _, err := r.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := g.precheck(context.Background(), "private/a.bin", r, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("payload"))
+	if got := s.precheck["sha256"]; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("precheck sha256 = %v, want the digest of the payload", got)
+	}
+	if offset, _ := r.Seek(0, io.SeekCurrent); offset != 6 {
+		t.Errorf("offset after precheck = %d, want 6", offset)
+	}
+}
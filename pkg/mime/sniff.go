@@ -0,0 +1,208 @@
+package mime
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// SniffLen the number of leading bytes used to detect the content type.
+const SniffLen = 512
+
+type signature struct {
+	offset int
+	magic  string
+	mime   string
+}
+
+// signatures the magic bytes of the types not detected by net/http, or detected with other names.
+var signatures = []signature{
+	{0, "\x7fELF", "application/x-elf"},
+	{0, "MZ", "application/x-msdownload"},
+	{0, "\xfe\xed\xfa\xce", "application/x-mach-binary"},
+	{0, "\xfe\xed\xfa\xcf", "application/x-mach-binary"},
+	{0, "\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\xca\xfe\xba\xbe", "application/java-vm"},
+	{0, "\x00asm", "application/wasm"},
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage"},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+	{0, "Rar!\x1a\x07", "application/vnd.rar"},
+	{0, "PK\x03\x04", "application/zip"},
+	{0, "PK\x05\x06", "application/zip"},
+	{0, "\x1f\x8b", "application/gzip"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "%PDF-", "application/pdf"},
+	{0, "\xff\xd8\xff", "image/jpeg"},
+	{0, "\x89PNG\r\n\x1a\n", "image/png"},
+	{0, "GIF87a", "image/gif"},
+	{0, "GIF89a", "image/gif"},
+	{8, "WEBP", "image/webp"},
+	{0, "BM", "image/bmp"},
+	{0, "II*\x00", "image/tiff"},
+	{0, "MM\x00*", "image/tiff"},
+	{0, "\x00\x00\x01\x00", "image/vnd.microsoft.icon"},
+	{8, "WAVE", "audio/x-wav"},
+	{8, "AVI ", "video/x-msvideo"},
+	{0, "ID3", "audio/mpeg"},
+	{0, "OggS", "audio/ogg"},
+	{0, "fLaC", "audio/x-flac"},
+	{0, "\x1aE\xdf\xa3", "video/webm"},
+	{4, "ftyp", "video/mp4"},
+	{0, "wOFF", "font/woff"},
+	{0, "wOF2", "font/woff2"},
+	{0, "OTTO", "font/otf"},
+	{0, "\x00\x01\x00\x00\x00", "font/ttf"},
+}
+
+// compatibleTypes the declared types compatible with a detected type other than itself,
+// such as the office documents which are zip archives. The patterns are matched by Match.
+var compatibleTypes = map[string][]string{
+	"application/zip": {
+		"application/x-zip-compressed",
+		"application/vnd.openxmlformats-officedocument.*",
+		"application/vnd.oasis.opendocument.*",
+		"application/vnd.ms-*",
+		"application/x-java-archive",
+		"application/java-archive",
+		"application/vnd.android.package-archive",
+		"application/epub+zip",
+	},
+	"application/x-ole-storage": {
+		"application/msword",
+		"application/vnd.ms-*",
+		"application/x-msi",
+	},
+	"application/x-msdownload": {
+		"application/vnd.microsoft.portable-executable",
+		"application/x-msdos-program",
+	},
+	"application/gzip": {
+		"application/x-gzip",
+		"application/x-compressed-tar",
+	},
+	"image/vnd.microsoft.icon": {
+		"image/x-icon",
+	},
+	"audio/x-wav": {
+		"audio/wav",
+		"audio/wave",
+	},
+	"audio/x-flac": {
+		"audio/flac",
+	},
+	"audio/mpeg": {
+		"audio/mp3",
+	},
+	"audio/ogg": {
+		"video/ogg",
+		"application/ogg",
+		"audio/opus",
+	},
+	"video/webm": {
+		"audio/webm",
+		"video/x-matroska",
+		"audio/x-matroska",
+	},
+	// iso base media files, told by the brands
+	"video/mp4": {
+		"audio/mp4",
+		"audio/x-m4a",
+		"video/quicktime",
+		"video/3gpp",
+		"video/3gpp2",
+		"image/heic",
+		"image/heif",
+		"image/avif",
+	},
+	// text without markup may be any textual type
+	"text/plain": {
+		"text/*",
+		"application/json",
+		"application/*+json",
+		"application/xml",
+		"application/*+xml",
+		"application/javascript",
+		"application/ecmascript",
+		"application/x-javascript",
+		"application/x-sh",
+		"application/x-yaml",
+		"application/yaml",
+		"application/x-subrip",
+		"image/svg+xml",
+	},
+	"text/xml": {
+		"text/*",
+		"application/xml",
+		"application/*+xml",
+		"image/svg+xml",
+	},
+	"text/html": {
+		"application/xhtml+xml",
+	},
+}
+
+// DetectContent detects the content type by the leading bytes of content, at most SniffLen are considered.
+// It returns application/octet-stream if the type can not be determined.
+func DetectContent(data []byte) string {
+	if len(data) > SniffLen {
+		data = data[:SniffLen]
+	}
+
+	for _, sig := range signatures {
+		if len(data) >= sig.offset+len(sig.magic) &&
+			bytes.Equal(data[sig.offset:sig.offset+len(sig.magic)], []byte(sig.magic)) {
+			return sig.mime
+		}
+	}
+
+	return essence(http.DetectContentType(data))
+}
+
+// Compatible reports whether the content detected as detected may be declared as declared.
+// The generic application/octet-stream is compatible with any type.
+func Compatible(declared, detected string) bool {
+	declared, detected = essence(declared), essence(detected)
+	if declared == "" || IsDefault(declared) || IsDefault(detected) || declared == detected {
+		return true
+	}
+
+	for _, pattern := range compatibleTypes[detected] {
+		if Match(pattern, declared) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match reports whether the content type matches pattern, which is * for any type,
+// or a shell pattern of path.Match such as image/* and application/*+json.
+func Match(pattern, contentType string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	ok, _ := path.Match(strings.ToLower(pattern), essence(contentType))
+
+	return ok
+}
+
+// IsDefault reports whether the content type is the generic application/octet-stream,
+// or binary/octet-stream given by s3 to the objects uploaded without content type.
+func IsDefault(contentType string) bool {
+	contentType = essence(contentType)
+
+	return contentType == defaultMIMEType || contentType == "binary/octet-stream"
+}
+
+// essence returns the content type without parameters in lower case.
+func essence(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
@@ -23,6 +23,25 @@ const (
 	ErrSinger            = 100014020011
 	ErrListMultiPart     = 100014020012
 	ErrCompleteMultiPart = 100014020013
+	InvalidChecksum      = 100014020014
+	InvalidPart          = 100014020015
+	InvalidPartNumber    = 100014020016
+	InvalidPath          = 100014020017
+	ErrQuery             = 100014020018
+	ErrJobRunning        = 100014020019
+	ErrQuotaExceeded     = 100014020020
+	ErrTooManyRequests   = 100014020021
+	ErrUnauthorized      = 100014020022
+	ErrForbidden         = 100014020023
+	ErrInfected          = 100014020024
+	ErrScan              = 100014020025
+	ErrFileBlocked       = 100014020026
+	InvalidContentType   = 100014020027
+	ErrContentTypeDenied = 100014020028
+	InvalidImageOption   = 100014020029
+	ErrImageTooLarge     = 100014020030
+	ErrStripImage        = 100014020031
+	InvalidPartRange     = 100014020032
 )
 
 // CodeTable code table.
@@ -40,4 +59,23 @@ var CodeTable = map[int64]string{
 	ErrSinger:            "签名失败",
 	ErrListMultiPart:     "查找分块失败",
 	ErrCompleteMultiPart: "合并分块失败",
+	InvalidChecksum:      "无效的校验值",
+	InvalidPart:          "分块缺失或校验不一致",
+	InvalidPartNumber:    "分块编号无效，单次最多签名%d个分块",
+	InvalidPath:          "无效的文件路径",
+	ErrQuery:             "查询失败",
+	ErrJobRunning:        "任务正在执行",
+	ErrQuotaExceeded:     "存储配额不足",
+	ErrTooManyRequests:   "请求过于频繁，请稍后再试",
+	ErrUnauthorized:      "未认证或认证已失效",
+	ErrForbidden:         "没有权限访问该路径",
+	ErrInfected:          "文件包含病毒，已被隔离",
+	ErrScan:              "文件病毒扫描失败",
+	ErrFileBlocked:       "文件已被隔离，禁止下载",
+	InvalidContentType:   "文件内容与文件类型不符",
+	ErrContentTypeDenied: "不允许上传该类型的文件",
+	InvalidImageOption:   "无效的图片处理参数",
+	ErrImageTooLarge:     "图片尺寸超出限制",
+	ErrStripImage:        "图片元数据清除失败",
+	InvalidPartRange:     "分块编号无效，应在1到%d之间",
 }
@@ -19,19 +19,36 @@ var DefaultPath = "./configs/config.yml"
 
 // Config configuration file.
 type Config struct {
-	Port    string            `yaml:"port"`
-	Model   string            `yaml:"model"`
-	MaxSize int64             `yaml:"maxSize"`
-	Log     logger.Config     `yaml:"log"`
-	Mysql   mysql2.Config     `yaml:"mysql"`
-	Redis   redis2.Config     `yaml:"redis"`
-	Storage Storage           `yaml:"storage"`
-	Blob    Blob              `yaml:"blob"`
-	Buckets map[string]string `yaml:"buckets"`
+	Port      string            `yaml:"port"`
+	Model     string            `yaml:"model"`
+	MaxSize   int64             `yaml:"maxSize"`
+	Log       logger.Config     `yaml:"log"`
+	Mysql     mysql2.Config     `yaml:"mysql"`
+	Redis     redis2.Config     `yaml:"redis"`
+	Storage   Storage           `yaml:"storage"`
+	Blob      Blob              `yaml:"blob"`
+	Buckets   map[string]string `yaml:"buckets"`
+	Dedup     Dedup             `yaml:"dedup"`
+	Scrub     Scrub             `yaml:"scrub"`
+	Reconcile Reconcile         `yaml:"reconcile"`
+	Quota     Quota             `yaml:"quota"`
+	RateLimit RateLimit         `yaml:"rateLimit"`
+	Auth      Auth              `yaml:"auth"`
+	Namespace Namespace         `yaml:"namespace"`
+	Audit     Audit             `yaml:"audit"`
+	Events    Events            `yaml:"events"`
+	Scan      Scan              `yaml:"scan"`
+	Content   Content           `yaml:"content"`
+	Image     Image             `yaml:"image"`
+	Thumbnail Thumbnail         `yaml:"thumbnail"`
+	Jobs      Jobs              `yaml:"jobs"`
+	Metadata  Metadata          `yaml:"metadata"`
 }
 
 // Storage Storage.
 type Storage struct {
+	// Name the name of storage profile, recorded with files.
+	Name            string
 	AccessKeyID     string
 	SecretAccessKey string
 	Endpoint        string
@@ -46,6 +63,286 @@ type Blob struct {
 	TempPath string `yaml:"tempPath"`
 }
 
+// Dedup content addressed storage configuration.
+type Dedup struct {
+	// Buckets the bucket types whose objects are stored once by digest, e.g. private.
+	Buckets []string `yaml:"buckets"`
+	// Prefix the key prefix of shared objects.
+	Prefix string `yaml:"prefix"`
+}
+
+// Scrub integrity scrubber configuration.
+type Scrub struct {
+	Enable bool `yaml:"enable"`
+	// Interval the interval between two runs.
+	Interval time.Duration `yaml:"interval"`
+	// Rate the maximum bytes read from storage per second.
+	Rate int64 `yaml:"rate"`
+	// Batch the number of files loaded at a time.
+	Batch int `yaml:"batch"`
+}
+
+// Reconcile reconciliation between the metadata table and storage.
+type Reconcile struct {
+	Enable bool `yaml:"enable"`
+	// Interval the interval between two runs.
+	Interval time.Duration `yaml:"interval"`
+	// Grace objects modified within grace are skipped, they may be uploading.
+	Grace time.Duration `yaml:"grace"`
+	// Repair deletes the orphans in both directions.
+	Repair bool `yaml:"repair"`
+}
+
+// Quota storage quota configuration.
+type Quota struct {
+	// Enable enforces the limits, the usage is always accounted.
+	Enable bool `yaml:"enable"`
+	// Tenant the default limits of tenants.
+	Tenant Limit `yaml:"tenant"`
+	// App the default limits of apps.
+	App Limit `yaml:"app"`
+}
+
+// Limit quota limits, 0 means unlimited.
+// Exceeding a soft limit is reported, exceeding a hard limit rejects the upload.
+type Limit struct {
+	SoftBytes int64 `yaml:"softBytes"`
+	HardBytes int64 `yaml:"hardBytes"`
+	SoftFiles int64 `yaml:"softFiles"`
+	HardFiles int64 `yaml:"hardFiles"`
+}
+
+// RateLimit token bucket rate limiting configuration.
+type RateLimit struct {
+	Enable bool `yaml:"enable"`
+	// Keys the request headers identifying the caller, any of tenant, app and user.
+	// The client ip is used if none of them is present.
+	Keys []string `yaml:"keys"`
+	// Default the limit of the routes not listed in routes, zero rate means unlimited.
+	Default Rate `yaml:"default"`
+	// Routes the limits by route, such as /api/v1/fileserver/sign/upload.
+	Routes map[string]Rate `yaml:"routes"`
+}
+
+// Rate token bucket, refilled by rate tokens per second up to burst.
+type Rate struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int64   `yaml:"burst"`
+}
+
+// Auth authentication and authorization configuration.
+type Auth struct {
+	Enable bool `yaml:"enable"`
+	// Mode how the callers are authenticated, jwt or header.
+	// In header mode the identity headers set by a trusted gateway are used.
+	Mode string `yaml:"mode"`
+	JWT  JWT    `yaml:"jwt"`
+	// RolesHeader the header of comma separated roles in header mode.
+	RolesHeader string `yaml:"rolesHeader"`
+	// Public the routes served without authentication, such as the custom pages.
+	Public []string `yaml:"public"`
+	// Policies the rules of which bucket and path prefixes a principal may access.
+	Policies []Policy `yaml:"policies"`
+}
+
+// JWT bearer token verification configuration.
+type JWT struct {
+	// JWKS the path of json web key set file, reloaded when it changes.
+	JWKS     string        `yaml:"jwks"`
+	Issuer   string        `yaml:"issuer"`
+	Audience string        `yaml:"audience"`
+	Leeway   time.Duration `yaml:"leeway"`
+	// OptionalExp accepts the tokens without exp, which never expire.
+	OptionalExp bool `yaml:"optionalExp"`
+	// Claims the names of the claims carrying the identity.
+	Claims Claims `yaml:"claims"`
+}
+
+// Claims names of the identity claims.
+type Claims struct {
+	User     string `yaml:"user"`
+	UserName string `yaml:"userName"`
+	Tenant   string `yaml:"tenant"`
+	App      string `yaml:"app"`
+	Roles    string `yaml:"roles"`
+}
+
+// Policy a rule allowing or denying the actions of principals on resources.
+type Policy struct {
+	// Effect allow or deny, deny takes precedence.
+	Effect string `yaml:"effect"`
+	// Principals *, user:<id>, tenant:<id>, app:<id> or role:<name>.
+	Principals []string `yaml:"principals"`
+	// Actions read, write, delete, admin or *.
+	Actions []string `yaml:"actions"`
+	// Resources bucket type/key patterns, a trailing * matches any suffix, the keys are the ones stored,
+	// prefixed with the tenant if they are namespaced. {user}, {tenant} and {app} are replaced by the ids of the principal.
+	Resources []string `yaml:"resources"`
+}
+
+// Namespace key namespacing configuration.
+type Namespace struct {
+	// Tenant prefixes every key with the tenant id of the caller.
+	Tenant bool `yaml:"tenant"`
+}
+
+// Audit audit log configuration.
+type Audit struct {
+	// Enable records the file operations in the audit_log table.
+	Enable bool `yaml:"enable"`
+	// File the json lines file the audits are appended to as well, optional.
+	File string `yaml:"file"`
+}
+
+// Events event delivery configuration.
+type Events struct {
+	// Enable records the events in the outbox and delivers them to the sinks.
+	Enable bool `yaml:"enable"`
+	// Interval the interval the outbox is polled.
+	Interval time.Duration `yaml:"interval"`
+	// Batch the number of events delivered at a time.
+	Batch int `yaml:"batch"`
+	// MaxAttempts the deliveries of an event before it is marked failed.
+	MaxAttempts int `yaml:"maxAttempts"`
+	// Backoff the delay before the first retry, doubled on each retry up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	Webhooks   []Webhook     `yaml:"webhooks"`
+	Brokers    []Broker      `yaml:"brokers"`
+}
+
+// Webhook an endpoint the events are posted to.
+type Webhook struct {
+	// Name identifies the webhook in the outbox, it should not be changed once events are recorded.
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Secret the key the events are signed with by hmac-sha256, optional.
+	Secret string `yaml:"secret"`
+	// Events the subscribed event types, all events if empty.
+	Events  []string      `yaml:"events"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Broker a message broker the events are published to.
+type Broker struct {
+	// Name identifies the broker in the outbox, it should not be changed once events are recorded.
+	Name string `yaml:"name"`
+	// Kind the type of broker, redis publishes to a stream of the redis of the service.
+	Kind string `yaml:"kind"`
+	// Topic the stream or topic the events are published to.
+	Topic string `yaml:"topic"`
+	// MaxLen the approximate length the stream is trimmed to, 0 means unlimited.
+	MaxLen int64 `yaml:"maxLen"`
+	// Events the published event types, all events if empty.
+	Events []string `yaml:"events"`
+}
+
+// Scan antivirus scanning configuration.
+type Scan struct {
+	Enable bool `yaml:"enable"`
+	// Address the address of clamd, tcp://host:port or unix:///path.
+	Address string        `yaml:"address"`
+	Timeout time.Duration `yaml:"timeout"`
+	// ChunkSize the size of the chunks streamed to clamd.
+	ChunkSize int `yaml:"chunkSize"`
+	// Quarantine the bucket the infected objects are moved to.
+	Quarantine string `yaml:"quarantine"`
+	// FailOpen accepts the uploads if they can not be scanned, otherwise they are rejected.
+	FailOpen bool `yaml:"failOpen"`
+}
+
+// Content content type verification configuration.
+type Content struct {
+	// Verify rejects the files whose content does not match their extension or declared content type.
+	Verify bool `yaml:"verify"`
+	// Policies the content types allowed by bucket and key prefix, the policy of the longest prefix applies.
+	Policies []ContentPolicy `yaml:"policies"`
+}
+
+// ContentPolicy the content types allowed under a key prefix of a bucket.
+type ContentPolicy struct {
+	// Bucket the bucket type, such as readable, or * for all buckets.
+	Bucket string `yaml:"bucket"`
+	// Prefix the key prefix, empty for the whole bucket.
+	Prefix string `yaml:"prefix"`
+	// Allow the allowed types, such as image/* or application/pdf, all types if empty.
+	Allow []string `yaml:"allow"`
+	// Deny the denied types, deny takes precedence.
+	Deny []string `yaml:"deny"`
+}
+
+// Image on-the-fly image transformation configuration.
+type Image struct {
+	// CacheBucket the bucket the derivatives are cached in, they are not cached if empty.
+	CacheBucket string `yaml:"cacheBucket"`
+	// MaxWidth and MaxHeight the maximum size of derivatives.
+	MaxWidth  int `yaml:"maxWidth"`
+	MaxHeight int `yaml:"maxHeight"`
+	// MaxPixels the maximum pixels of source images, 0 means unlimited.
+	MaxPixels int64 `yaml:"maxPixels"`
+	// MaxFrames the maximum frames of animated gifs, the larger ones are reduced to the poster frame.
+	MaxFrames int `yaml:"maxFrames"`
+	// MaxSVGSize the maximum size of svg sources in bytes, which are read in memory to be scaled.
+	MaxSVGSize int64 `yaml:"maxSVGSize"`
+	// MaxAge the max-age of Cache-Control.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// Thumbnail thumbnail configuration.
+type Thumbnail struct {
+	// Fit the default fit mode, contain, cover or fill.
+	Fit string `yaml:"fit"`
+	// Quality the quality of jpeg thumbnails, 1-100.
+	Quality int `yaml:"quality"`
+	// Presets the named thumbnail specifications.
+	Presets map[string]Preset `yaml:"presets"`
+	// Sizes the allowed free-form sizes WxH, such as 200x200 or 200x0, * allows any size.
+	// Only presets are allowed if it is empty.
+	Sizes []string `yaml:"sizes"`
+}
+
+// Preset a named thumbnail specification.
+type Preset struct {
+	Width  int    `yaml:"width"`
+	Height int    `yaml:"height"`
+	Fit    string `yaml:"fit"`
+	Crop   string `yaml:"crop"`
+	// Format the format of thumbnail, the format of source image by default.
+	Format string `yaml:"format"`
+	// Quality the quality of jpeg, the quality of thumbnail by default.
+	Quality int `yaml:"quality"`
+	// Poster keeps the first frame of animated images only.
+	Poster bool `yaml:"poster"`
+}
+
+// Jobs background job queue configuration.
+type Jobs struct {
+	Enable bool `yaml:"enable"`
+	// Workers the number of jobs run at a time by an instance.
+	Workers int `yaml:"workers"`
+	// MaxAttempts the runs of a job before it is marked failed.
+	MaxAttempts int `yaml:"maxAttempts"`
+	// TTL how long the status of a job is kept.
+	TTL time.Duration `yaml:"ttl"`
+	// AsyncSize the thumbnails of images larger than it in bytes are queued, 0 means never.
+	AsyncSize int64 `yaml:"asyncSize"`
+	// Presets the thumbnail presets generated after images are finished.
+	Presets []string `yaml:"presets"`
+}
+
+// Metadata image metadata configuration.
+type Metadata struct {
+	// Extract records the dimensions, format, color model and exif of the images on finish.
+	Extract bool `yaml:"extract"`
+	// MaxSize the images larger than it in bytes are not read, 0 means unlimited.
+	MaxSize int64 `yaml:"maxSize"`
+	// Strip the bucket types whose images are rewritten without exif gps and device data on finish.
+	Strip []string `yaml:"strip"`
+	// PrivateTags records and returns the gps and serial number tags of exif,
+	// which are dropped by default since they locate and identify the camera.
+	PrivateTags bool `yaml:"privateTags"`
+}
+
 // NewConfig get configuration.
 func NewConfig(path string) (*Config, error) {
 	if path == "" {
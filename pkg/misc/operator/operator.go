@@ -0,0 +1,55 @@
+package operator
+
+import (
+	"context"
+)
+
+// request headers set by the gateway.
+const (
+	UserID   = "User-Id"
+	UserName = "User-Name"
+	TenantID = "Tenant-Id"
+	AppID    = "App-Id"
+)
+
+// Operator the caller of a request.
+type Operator struct {
+	UserID   string
+	UserName string
+	TenantID string
+	AppID    string
+	IP       string
+}
+
+// CTX request context.
+type CTX interface {
+	GetHeader(key string) string
+	ClientIP() string
+}
+
+// FromRequest reads the operator from the request headers.
+func FromRequest(c CTX) *Operator {
+	return &Operator{
+		UserID:   c.GetHeader(UserID),
+		UserName: c.GetHeader(UserName),
+		TenantID: c.GetHeader(TenantID),
+		AppID:    c.GetHeader(AppID),
+		IP:       c.ClientIP(),
+	}
+}
+
+type operatorKey struct{}
+
+// WithContext returns a copy of ctx carrying the operator.
+func WithContext(ctx context.Context, op *Operator) context.Context {
+	return context.WithValue(ctx, operatorKey{}, op)
+}
+
+// FromContext returns the operator carried by ctx, never nil.
+func FromContext(ctx context.Context) *Operator {
+	if op, ok := ctx.Value(operatorKey{}).(*Operator); ok && op != nil {
+		return op
+	}
+
+	return &Operator{}
+}
@@ -1,10 +1,18 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	s3 "github.com/aws/aws-sdk-go/service/s3"
@@ -108,50 +116,93 @@ func (s *Storage) CreateMultipartUpload(bucket, key, contentType string) (string
 	return *output.UploadId, nil
 }
 
-// UploadPartRequest UploadPartRequest
-func (s *Storage) UploadPartRequest(bucket, key, uploadID string, partNumber int64, expire time.Duration) (string, error) {
-	req, _ := s.client.UploadPartRequest(&s3.UploadPartInput{
+// Checksum pins the content of a presigned part, empty fields are ignored.
+type Checksum struct {
+	// ContentMD5 base64 encoded md5 of the part.
+	ContentMD5 string
+	// SHA256 hex encoded sha256 of the part.
+	SHA256 string
+}
+
+// UploadPartRequest returns a presigned url of the part and the headers that must be sent with it.
+func (s *Storage) UploadPartRequest(bucket, key, uploadID string, partNumber int64, checksum Checksum, expire time.Duration) (string, map[string]string, error) {
+	input := &s3.UploadPartInput{
 		Bucket:     aws.String(bucket),
 		Key:        aws.String(key),
 		UploadId:   aws.String(uploadID),
 		PartNumber: aws.Int64(partNumber),
-	})
+	}
+	if checksum.ContentMD5 != "" {
+		input.ContentMD5 = aws.String(checksum.ContentMD5)
+	}
 
-	url, err := req.Presign(expire)
+	req, _ := s.client.UploadPartRequest(input)
+	if checksum.SHA256 != "" {
+		// the signer uses this header as payload hash, so the storage rejects any other content.
+		req.HTTPRequest.Header.Set(contentSHA256, checksum.SHA256)
+	}
+
+	url, signed, err := req.PresignRequest(expire)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return url, nil
+	headers := make(map[string]string, len(signed))
+	for k := range signed {
+		if strings.EqualFold(k, "Host") {
+			continue
+		}
+		headers[k] = signed.Get(k)
+	}
+
+	return url, headers, nil
 }
 
-// ListParts ListParts
+const contentSHA256 = "X-Amz-Content-Sha256"
+
+// ListParts lists all uploaded parts ordered by part number.
 func (s *Storage) ListParts(bucket, key, uploadID string) ([]*s3.Part, error) {
-	output, err := s.client.ListParts(&s3.ListPartsInput{
+	parts := make([]*s3.Part, 0)
+	err := s.client.ListPartsPages(&s3.ListPartsInput{
 		Bucket:   aws.String(bucket),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadID),
+	}, func(output *s3.ListPartsOutput, lastPage bool) bool {
+		parts = append(parts, output.Parts...)
+		return true
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return output.Parts, nil
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.Int64Value(parts[i].PartNumber) < aws.Int64Value(parts[j].PartNumber)
+	})
+
+	return parts, nil
+}
+
+// ErrInvalidPart is returned when the uploaded parts can not be stitched safely.
+var ErrInvalidPart = errors.New("invalid part")
+
+// CompletedPart part expected by the client.
+type CompletedPart struct {
+	PartNumber int64
+	ETag       string
 }
 
-// CompleteMultipartUpload CompleteMultipartUpload
-func (s *Storage) CompleteMultipartUpload(bucket, key, uploadID string) error {
+// CompleteMultipartUpload stitches the uploaded parts.
+// If expected is not empty, the uploaded parts must match it exactly,
+// otherwise the uploaded parts must be continuous from 1.
+func (s *Storage) CompleteMultipartUpload(bucket, key, uploadID string, expected []*CompletedPart) error {
 	parts, err := s.ListParts(bucket, key, uploadID)
 	if err != nil {
 		return err
 	}
 
-	completedParts := make([]*s3.CompletedPart, 0, len(parts))
-	for _, part := range parts {
-		completedParts = append(completedParts, &s3.CompletedPart{
-			ETag:       part.ETag,
-			PartNumber: part.PartNumber,
-		})
+	completedParts, err := checkParts(parts, expected)
+	if err != nil {
+		return err
 	}
 
 	_, err = s.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
@@ -166,6 +217,51 @@ func (s *Storage) CompleteMultipartUpload(bucket, key, uploadID string) error {
 	return err
 }
 
+func checkParts(parts []*s3.Part, expected []*CompletedPart) ([]*s3.CompletedPart, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: no part uploaded", ErrInvalidPart)
+	}
+
+	uploaded := make(map[int64]*s3.Part, len(parts))
+	for _, part := range parts {
+		uploaded[aws.Int64Value(part.PartNumber)] = part
+	}
+
+	if len(expected) == 0 {
+		expected = make([]*CompletedPart, 0, len(parts))
+		for i := range parts {
+			expected = append(expected, &CompletedPart{PartNumber: int64(i + 1)})
+		}
+	}
+
+	completedParts := make([]*s3.CompletedPart, 0, len(expected))
+	for i, want := range expected {
+		if want.PartNumber != int64(i+1) {
+			return nil, fmt.Errorf("%w: part %d is missing", ErrInvalidPart, i+1)
+		}
+
+		part, ok := uploaded[want.PartNumber]
+		if !ok {
+			return nil, fmt.Errorf("%w: part %d is not uploaded", ErrInvalidPart, want.PartNumber)
+		}
+
+		if want.ETag != "" && trimETag(want.ETag) != trimETag(aws.StringValue(part.ETag)) {
+			return nil, fmt.Errorf("%w: etag of part %d mismatch", ErrInvalidPart, want.PartNumber)
+		}
+
+		completedParts = append(completedParts, &s3.CompletedPart{
+			ETag:       part.ETag,
+			PartNumber: part.PartNumber,
+		})
+	}
+
+	return completedParts, nil
+}
+
+func trimETag(etag string) string {
+	return strings.Trim(etag, "\"")
+}
+
 // AbortMultipartUpload AbortMultipartUpload
 func (s *Storage) AbortMultipartUpload(bucket, key, uploadID string) error {
 	_, err := s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
@@ -186,3 +282,95 @@ func (s *Storage) DeleteObject(bucket, key string) error {
 
 	return err
 }
+
+// ObjectInfo ObjectInfo
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	ETag        string
+}
+
+// HeadObject returns the information of object.
+func (s *Storage) HeadObject(bucket, key string) (*ObjectInfo, error) {
+	output, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Size:        aws.Int64Value(output.ContentLength),
+		ContentType: aws.StringValue(output.ContentType),
+		ETag:        aws.StringValue(output.ETag),
+	}, nil
+}
+
+// CopyObject copies an object inside the bucket.
+func (s *Storage) CopyObject(bucket, srcKey, dstKey string) error {
+	return s.CopyObjectTo(bucket, srcKey, bucket, dstKey)
+}
+
+// CopyObjectTo copies an object to the key of another bucket.
+func (s *Storage) CopyObjectTo(srcBucket, srcKey, dstBucket, dstKey string) error {
+	_, err := s.client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(escapePath(path.Join(srcBucket, srcKey))),
+	})
+
+	return err
+}
+
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// Object object listed in bucket.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// WalkObjects calls fn for every object under prefix in bucket.
+func (s *Storage) WalkObjects(bucket, prefix string, fn func(*Object) error) error {
+	var walkErr error
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range output.Contents {
+			walkErr = fn(&Object{
+				Key:          aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+			if walkErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return walkErr
+}
+
+// IsNotExist reports whether the error means the object does not exist.
+func IsNotExist(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode() == http.StatusNotFound
+	}
+
+	return false
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	s3 "github.com/aws/aws-sdk-go/service/s3"
+)
+
+func uploadedParts(etags ...string) []*s3.Part {
+	parts := make([]*s3.Part, 0, len(etags))
+	for i, etag := range etags {
+		parts = append(parts, &s3.Part{
+			PartNumber: aws.Int64(int64(i + 1)),
+			ETag:       aws.String(etag),
+		})
+	}
+	return parts
+}
+
+func TestCheckParts(t *testing.T) {
+	tests := []struct {
+		name     string
+		parts    []*s3.Part
+		expected []*CompletedPart
+		want     int
+		invalid  bool
+	}{
+		{
+			name:    "no part uploaded",
+			invalid: true,
+		},
+		{
+			name:  "continuous parts without expected",
+			parts: uploadedParts(`"a"`, `"b"`, `"c"`),
+			want:  3,
+		},
+		{
+			name:    "gap without expected",
+			parts:   append(uploadedParts(`"a"`), &s3.Part{PartNumber: aws.Int64(3), ETag: aws.String(`"c"`)}),
+			invalid: true,
+		},
+		{
+			name:  "expected parts match with quoted etags",
+			parts: uploadedParts(`"a"`, `"b"`),
+			expected: []*CompletedPart{
+				{PartNumber: 1, ETag: "a"},
+				{PartNumber: 2, ETag: `"b"`},
+			},
+			want: 2,
+		},
+		{
+			name:  "expected prefix of the uploaded parts",
+			parts: uploadedParts(`"a"`, `"b"`, `"c"`),
+			expected: []*CompletedPart{
+				{PartNumber: 1, ETag: "a"},
+			},
+			want: 1,
+		},
+		{
+			name:  "etag mismatch",
+			parts: uploadedParts(`"a"`, `"b"`),
+			expected: []*CompletedPart{
+				{PartNumber: 1, ETag: "a"},
+				{PartNumber: 2, ETag: "x"},
+			},
+			invalid: true,
+		},
+		{
+			name:  "expected part not uploaded",
+			parts: uploadedParts(`"a"`),
+			expected: []*CompletedPart{
+				{PartNumber: 1, ETag: "a"},
+				{PartNumber: 2, ETag: "b"},
+			},
+			invalid: true,
+		},
+		{
+			name:  "expected parts out of order",
+			parts: uploadedParts(`"a"`, `"b"`),
+			expected: []*CompletedPart{
+				{PartNumber: 2, ETag: "b"},
+				{PartNumber: 1, ETag: "a"},
+			},
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkParts(tt.parts, tt.expected)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidPart) {
+					t.Fatalf("checkParts() error = %v, want ErrInvalidPart", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkParts() error = %v", err)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("checkParts() = %d parts, want %d", len(got), tt.want)
+			}
+			for i, part := range got {
+				if aws.Int64Value(part.PartNumber) != int64(i+1) {
+					t.Errorf("part %d has number %d", i, aws.Int64Value(part.PartNumber))
+				}
+				if aws.StringValue(part.ETag) != aws.StringValue(tt.parts[i].ETag) {
+					t.Errorf("part %d has etag %s, want the uploaded one", i, aws.StringValue(part.ETag))
+				}
+			}
+		})
+	}
+}
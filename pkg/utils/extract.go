@@ -18,7 +18,9 @@ var (
 
 // Blob parsing structure.
 type Blob struct {
-	AppID    string
+	AppID  string
+	Digest string
+	// Deprecated: MD5 is kept for the templates written before sha256, it has the same value as Digest.
 	MD5      string
 	FileName string
 }
@@ -98,6 +100,8 @@ func skipPrefix(val string) bool {
 
 // ExecuteURL ExecuteURL.
 func ExecuteURL(blob Blob, url string) string {
+	blob.MD5 = blob.Digest
+
 	var buf bytes.Buffer
 	t, _ := template.New("").Parse(url)
 	_ = t.Execute(&buf, blob)
@@ -1,67 +1,77 @@
 package utils
 
 import (
-	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
-	"errors"
-	"image"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
 	"io"
 	"mime/multipart"
 	"net/url"
 	"path/filepath"
 	"strings"
-
-	"github.com/disintegration/imaging"
-	"golang.org/x/image/bmp"
-	"golang.org/x/image/tiff"
+	"time"
 )
 
-// GetMD5ByMultipart get file digest value through file stream
-// TODO: change it to sha256
-func GetMD5ByMultipart(file *multipart.FileHeader) (string, error) {
+// GetSHA256ByMultipart get the hex encoded sha256 of file through file stream.
+func GetSHA256ByMultipart(file *multipart.FileHeader) (string, error) {
 	f, err := file.Open()
 	if err != nil {
 		return "", err
 	}
 	defer f.Close() //nolint: errcheck
 
-	md5h := md5.New() // nolint:gosec
-	_, err = io.Copy(md5h, f)
+	digest, _, err := GetSHA256(f)
+
+	return digest, err
+}
+
+// GetSHA256 get the hex encoded sha256 and size of the stream.
+func GetSHA256(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, r)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	return hex.EncodeToString(md5h.Sum(nil)), nil
+	return hex.EncodeToString(h.Sum(nil)), size, nil
 }
 
-// Scale Scale
-func Scale(in io.Reader, out io.Writer, width, height, quality int) error {
-	origin, fm, err := image.Decode(in)
-	if err != nil {
-		return err
+// throttleReader limits the read rate of the underlying reader.
+type throttleReader struct {
+	r     io.Reader
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+// NewThrottleReader returns a reader reading at most rate bytes per second.
+func NewThrottleReader(r io.Reader, rate int64) io.Reader {
+	if rate <= 0 {
+		return r
 	}
 
-	canvas := imaging.Resize(origin, width, height, imaging.Lanczos)
-
-	switch fm {
-	case "jpeg":
-		return jpeg.Encode(out, canvas, &jpeg.Options{Quality: quality})
-	case "png":
-		return png.Encode(out, canvas)
-	case "gif":
-		return gif.Encode(out, canvas, &gif.Options{})
-	case "bmp":
-		return bmp.Encode(out, canvas)
-	case "tiff":
-		return tiff.Encode(out, canvas, &tiff.Options{})
-	default:
-		return errors.New("ERROR FORMAT")
+	return &throttleReader{
+		r:     r,
+		rate:  rate,
+		start: time.Now(),
 	}
 }
 
+func (t *throttleReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > t.rate {
+		p = p[:t.rate]
+	}
+
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	expect := time.Duration(t.read * int64(time.Second) / t.rate)
+	if elapsed := time.Since(t.start); elapsed < expect {
+		time.Sleep(expect - elapsed)
+	}
+
+	return n, err
+}
+
 // ExistBucket ExistBucket
 func ExistBucket(buckets map[string]string, target string) bool {
 	for _, bucket := range buckets {
@@ -91,5 +101,8 @@ func URLQueryEscape(origin string) string {
 // Split Split
 func Split(str string, sep string) (string, string) {
 	arr := strings.SplitN(str, sep, 2)
+	if len(arr) < 2 {
+		return arr[0], ""
+	}
 	return arr[0], arr[1]
 }
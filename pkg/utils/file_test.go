@@ -0,0 +1,24 @@
+package utils
+
+import "testing"
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		str, sep    string
+		first, rest string
+	}{
+		{"bucket/a/b.png", "/", "bucket", "a/b.png"},
+		{"bucket/", "/", "bucket", ""},
+		{"bucket", "/", "bucket", ""},
+		{"/a.png", "/", "", "a.png"},
+		{"", "/", "", ""},
+		{"user:alice:x", ":", "user", "alice:x"},
+	}
+
+	for _, tt := range tests {
+		first, rest := Split(tt.str, tt.sep)
+		if first != tt.first || rest != tt.rest {
+			t.Errorf("Split(%q, %q) = %q, %q, want %q, %q", tt.str, tt.sep, first, rest, tt.first, tt.rest)
+		}
+	}
+}
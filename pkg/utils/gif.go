@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"github.com/disintegration/imaging"
+)
+
+// transformGIF resizes every frame of the gif keeping the delays and loops,
+// the animations with more frames than opts.MaxFrames are reduced to the poster frame.
+func transformGIF(in io.Reader, out io.Writer, opts *ImageOptions) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	// the frames are counted before they are decoded, so that the larger animations are not allocated
+	var g *gif.GIF
+	if opts.MaxFrames > 0 && gifFrames(data, opts.MaxFrames) > opts.MaxFrames {
+		g, err = gifPoster(data)
+	} else {
+		g, err = gif.DecodeAll(bytes.NewReader(data))
+	}
+	if err != nil || len(g.Image) == 0 {
+		return ErrImageFormat
+	}
+
+	frames := len(g.Image)
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	for _, frame := range g.Image {
+		bounds = bounds.Union(frame.Bounds())
+	}
+
+	// the frames may cover a part of the canvas only, they are composed
+	// by their disposal before resizing, and resized frames replace the whole canvas
+	canvas := image.NewNRGBA(bounds)
+	animation := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, frames),
+		Delay:     make([]int, 0, frames),
+		Disposal:  make([]byte, 0, frames),
+		LoopCount: g.LoopCount,
+	}
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = imaging.Clone(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		scaled := resize(canvas, opts)
+		paletted := image.NewPaletted(scaled.Bounds(), framePalette(frame.Palette))
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), scaled, scaled.Bounds().Min)
+
+		var delay int
+		if i < len(g.Delay) {
+			delay = g.Delay[i]
+		}
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, delay)
+		animation.Disposal = append(animation.Disposal, gif.DisposalBackground)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return gif.EncodeAll(out, animation)
+}
+
+// gifFrames counts the image descriptors of the gif by skipping the blocks without decoding them,
+// it stops counting beyond max. The frames of malformed data are left to the decoder.
+func gifFrames(data []byte, max int) int {
+	// the header and logical screen descriptor
+	if len(data) < 13 {
+		return 0
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skip skips the data sub-blocks, which end with an empty one
+	skip := func() bool {
+		for i < len(data) {
+			n := int(data[i])
+			i++
+			if n == 0 {
+				return true
+			}
+			i += n
+		}
+
+		return false
+	}
+
+	frames := 0
+	for i < len(data) && frames <= max {
+		switch data[i] {
+		case 0x21:
+			// extension introducer and label
+			i += 2
+			if !skip() {
+				return frames
+			}
+		case 0x2C:
+			// image descriptor, local color table, lzw minimum code size and image data
+			if i+10 > len(data) {
+				return frames
+			}
+			packed := data[i+9]
+			i += 10
+			if packed&0x80 != 0 {
+				i += 3 << (packed&0x07 + 1)
+			}
+			i++
+			if !skip() {
+				return frames
+			}
+			frames++
+		default:
+			// trailer
+			return frames
+		}
+	}
+
+	return frames
+}
+
+// gifPoster decodes the first frame of the gif only.
+func gifPoster(data []byte) (*gif.GIF, error) {
+	config, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	frame, ok := img.(*image.Paletted)
+	if !ok {
+		return nil, ErrImageFormat
+	}
+
+	return &gif.GIF{
+		Image:  []*image.Paletted{frame},
+		Delay:  []int{0},
+		Config: config,
+	}, nil
+}
+
+// framePalette returns the palette of frame with a transparent color,
+// the composed canvas may be transparent where the frame is not.
+func framePalette(p color.Palette) color.Palette {
+	palette := make(color.Palette, len(p), len(p)+1)
+	copy(palette, p)
+	for _, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return palette
+		}
+	}
+
+	if len(palette) < 256 {
+		return append(palette, color.Transparent)
+	}
+	palette[len(palette)-1] = color.Transparent
+
+	return palette
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// testGIF returns an animation of width x height whose frames are filled with the colors in turn,
+// the delay of frame i is 10*(i+1).
+func testGIF(t *testing.T, width, height, frames int) []byte {
+	palette := color.Palette{color.Black, color.White, color.RGBA{R: 0xFF, A: 0xFF}}
+	g := &gif.GIF{LoopCount: 2}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(i % len(palette))
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10*(i+1))
+	}
+
+	out := &bytes.Buffer{}
+	if err := gif.EncodeAll(out, g); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Bytes()
+}
+
+func TestTransformGIF(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames int
+		opts   ImageOptions
+		// want the frames and size of the result
+		want          int
+		width, height int
+		err           error
+	}{
+		{"animation", 3, ImageOptions{Width: 20}, 3, 20, 10, nil},
+		{"within max frames", 3, ImageOptions{Width: 20, MaxFrames: 3}, 3, 20, 10, nil},
+		{"beyond max frames", 4, ImageOptions{Width: 20, MaxFrames: 3}, 1, 20, 10, nil},
+		{"poster", 3, ImageOptions{Width: 20, Poster: true}, 1, 20, 10, nil},
+		{"original size", 2, ImageOptions{}, 2, 40, 20, nil},
+		{"beyond max pixels", 3, ImageOptions{Width: 20, MaxPixels: 40*20 - 1}, 0, 0, 0, ErrImageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			opts := tt.opts
+			format, err := Transform(bytes.NewReader(testGIF(t, 40, 20, tt.frames)), out, &opts)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Transform() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if format != "gif" {
+				t.Errorf("Transform() format = %s, want gif", format)
+			}
+
+			g, err := gif.DecodeAll(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(g.Image) != tt.want {
+				t.Fatalf("Transform() frames = %d, want %d", len(g.Image), tt.want)
+			}
+			if g.Config.Width != tt.width || g.Config.Height != tt.height {
+				t.Errorf("Transform() size = %dx%d, want %dx%d", g.Config.Width, g.Config.Height, tt.width, tt.height)
+			}
+
+			if tt.want == 1 {
+				return
+			}
+			if g.LoopCount != 2 {
+				t.Errorf("Transform() loop count = %d, want 2", g.LoopCount)
+			}
+			for i, delay := range g.Delay {
+				if delay != 10*(i+1) {
+					t.Errorf("Transform() delay of frame %d = %d, want %d", i, delay, 10*(i+1))
+				}
+			}
+		})
+	}
+}
+
+func TestGIFFrames(t *testing.T) {
+	data := testGIF(t, 8, 8, 5)
+
+	tests := []struct {
+		name string
+		data []byte
+		max  int
+		want int
+	}{
+		{"all", data, 10, 5},
+		{"stops beyond max", data, 2, 3},
+		{"truncated", data[:len(data)-20], 10, 4},
+		{"header only", data[:13], 10, 0},
+		{"empty", nil, 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gifFrames(tt.data, tt.max); got != tt.want {
+				t.Errorf("gifFrames() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	// webp sources are decoded, and encoded to png
+	_ "golang.org/x/image/webp"
+)
+
+// fit modes of Transform.
+const (
+	// FitContain scales the image to fit inside the box, keeping the aspect ratio.
+	FitContain = "contain"
+	// FitCover scales the image to cover the box, keeping the aspect ratio, the overflow is cropped by the anchor.
+	FitCover = "cover"
+	// FitFill stretches the image to the box.
+	FitFill = "fill"
+)
+
+const defaultImageQuality = 85
+
+// formats of Transform besides the ones of imaging.
+const (
+	// FormatSVG svg sources are scaled as vector, they can not be converted to or from the other formats.
+	FormatSVG = "svg"
+	// FormatPNG the format of the sources that can not be encoded, such as webp.
+	FormatPNG = "png"
+)
+
+var (
+	// ErrImageFormat the format can not be decoded or encoded.
+	ErrImageFormat = errors.New("unsupported image format")
+	// ErrImageOption the options of transformation are invalid.
+	ErrImageOption = errors.New("invalid image option")
+	// ErrImageTooLarge the source image has more pixels than allowed.
+	ErrImageTooLarge = errors.New("image too large")
+)
+
+var anchors = map[string]imaging.Anchor{
+	"":             imaging.Center,
+	"center":       imaging.Center,
+	"top":          imaging.Top,
+	"bottom":       imaging.Bottom,
+	"left":         imaging.Left,
+	"right":        imaging.Right,
+	"top-left":     imaging.TopLeft,
+	"top-right":    imaging.TopRight,
+	"bottom-left":  imaging.BottomLeft,
+	"bottom-right": imaging.BottomRight,
+}
+
+var formats = map[string]imaging.Format{
+	"jpeg": imaging.JPEG,
+	"jpg":  imaging.JPEG,
+	"png":  imaging.PNG,
+	"gif":  imaging.GIF,
+	"bmp":  imaging.BMP,
+	"tiff": imaging.TIFF,
+	"tif":  imaging.TIFF,
+}
+
+// Encodable reports whether Transform encodes to the format, such as jpeg or svg.
+func Encodable(format string) bool {
+	_, ok := formats[strings.ToLower(format)]
+
+	return ok || strings.EqualFold(format, FormatSVG)
+}
+
+// ImageInfo the header of an image.
+type ImageInfo struct {
+	Width  int
+	Height int
+	// Format the format decoded, such as jpeg or png.
+	Format string
+	// ColorModel the color model, such as ycbcr, rgba or paletted.
+	ColorModel string
+}
+
+// DecodeInfo decodes the dimensions, format and color model of the image without decoding its pixels.
+func DecodeInfo(r io.Reader) (*ImageInfo, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, ErrImageFormat
+	}
+
+	return &ImageInfo{
+		Width:      config.Width,
+		Height:     config.Height,
+		Format:     format,
+		ColorModel: colorModelName(config.ColorModel),
+	}, nil
+}
+
+func colorModelName(m color.Model) string {
+	if _, ok := m.(color.Palette); ok {
+		return "paletted"
+	}
+
+	switch m {
+	case color.RGBAModel:
+		return "rgba"
+	case color.RGBA64Model:
+		return "rgba64"
+	case color.NRGBAModel:
+		return "nrgba"
+	case color.NRGBA64Model:
+		return "nrgba64"
+	case color.AlphaModel:
+		return "alpha"
+	case color.Alpha16Model:
+		return "alpha16"
+	case color.GrayModel:
+		return "gray"
+	case color.Gray16Model:
+		return "gray16"
+	case color.CMYKModel:
+		return "cmyk"
+	case color.YCbCrModel:
+		return "ycbcr"
+	case color.NYCbCrAModel:
+		return "nycbcra"
+	default:
+		return "unknown"
+	}
+}
+
+// ImageOptions options of Transform, a zero width or height is derived from the aspect ratio.
+type ImageOptions struct {
+	Width  int
+	Height int
+	// Fit contain, cover or fill, contain by default.
+	Fit string
+	// Crop the anchor of cover, center, top, bottom, left, right, top-left, top-right, bottom-left or bottom-right.
+	Crop string
+	// Format the output format, jpeg, png, gif, bmp, tiff or svg, the format of source by default.
+	Format string
+	// Quality the quality of jpeg, 1-100.
+	Quality int
+	// MaxPixels the maximum pixels of source image, and of the size svg is scaled to, 0 means unlimited.
+	MaxPixels int64
+	// Poster outputs the first frame of animated sources only.
+	Poster bool
+	// MaxFrames the maximum frames of animated gif, the larger ones are reduced to the poster frame,
+	// 0 means unlimited.
+	MaxFrames int
+	// SVG the source is declared as svg, the sources that are not raster images are scaled as svg only if it is set.
+	SVG bool
+	// MaxSVGSize the maximum size of svg sources in bytes, 0 means unlimited.
+	MaxSVGSize int64
+}
+
+// Validate checks the options and fills the defaults.
+func (o *ImageOptions) Validate() error {
+	if o.Width < 0 || o.Height < 0 || o.Quality < 0 || o.Quality > 100 {
+		return ErrImageOption
+	}
+
+	o.Fit = strings.ToLower(o.Fit)
+	switch o.Fit {
+	case "":
+		o.Fit = FitContain
+	case FitContain, FitCover, FitFill:
+	default:
+		return ErrImageOption
+	}
+
+	o.Crop = strings.ToLower(o.Crop)
+	if _, ok := anchors[o.Crop]; !ok {
+		return ErrImageOption
+	}
+	if o.Crop == "" {
+		o.Crop = "center"
+	}
+
+	o.Format = strings.ToLower(o.Format)
+	if o.Format != "" && !Encodable(o.Format) {
+		return ErrImageFormat
+	}
+	if o.Format == "jpg" {
+		o.Format = "jpeg"
+	}
+	if o.Format == "tif" {
+		o.Format = "tiff"
+	}
+
+	if o.Quality == 0 {
+		o.Quality = defaultImageQuality
+	}
+
+	return nil
+}
+
+// Transform decodes the image of in, orients it by exif, resizes it by the options and encodes it to out.
+// The frames of animated gif are resized unless a poster or another format is requested,
+// and the sources declared as svg are scaled by their viewBox. It returns the format encoded.
+func Transform(in io.Reader, out io.Writer, opts *ImageOptions) (string, error) {
+	err := opts.Validate()
+	if err != nil {
+		return "", err
+	}
+
+	// the dimensions are checked before the pixels are allocated
+	head := &bytes.Buffer{}
+	config, format, err := image.DecodeConfig(io.TeeReader(in, head))
+	if err != nil {
+		// the source declared as svg is not a raster format
+		if !opts.SVG || (opts.Format != "" && opts.Format != FormatSVG) {
+			return "", ErrImageFormat
+		}
+		data, err := readSVG(io.MultiReader(head, in), opts.MaxSVGSize)
+		if err != nil {
+			return "", err
+		}
+
+		return FormatSVG, scaleSVG(data, out, opts)
+	}
+	if opts.Format == FormatSVG {
+		return "", ErrImageFormat
+	}
+	if opts.MaxPixels > 0 && int64(config.Width)*int64(config.Height) > opts.MaxPixels {
+		return "", ErrImageTooLarge
+	}
+
+	if format == "gif" && !opts.Poster && (opts.Format == "" || opts.Format == "gif") {
+		return format, transformGIF(io.MultiReader(head, in), out, opts)
+	}
+
+	// photos are rotated by their exif orientation
+	origin, err := imaging.Decode(io.MultiReader(head, in), imaging.AutoOrientation(true))
+	if err != nil {
+		return "", err
+	}
+
+	canvas := resize(origin, opts)
+
+	if opts.Format != "" {
+		format = opts.Format
+	}
+	f, ok := formats[format]
+	if !ok {
+		// the sources without encoder, such as webp, are encoded to png keeping the transparency
+		format = FormatPNG
+		f = imaging.PNG
+	}
+
+	return format, imaging.Encode(out, canvas, f, imaging.JPEGQuality(opts.Quality))
+}
+
+// Scale scales the image of in by the options and encodes it to out in the format of source unless specified.
+func Scale(in io.Reader, out io.Writer, opts *ImageOptions) error {
+	_, err := Transform(in, out, opts)
+
+	return err
+}
+
+func resize(img image.Image, opts *ImageOptions) image.Image {
+	width, height := opts.Width, opts.Height
+	if width == 0 && height == 0 {
+		return img
+	}
+	if width == 0 || height == 0 {
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	}
+
+	switch opts.Fit {
+	case FitCover:
+		return imaging.Fill(img, width, height, anchors[opts.Crop], imaging.Lanczos)
+	case FitFill:
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	default:
+		return imaging.Fit(img, width, height, imaging.Lanczos)
+	}
+}
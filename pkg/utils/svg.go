@@ -0,0 +1,371 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// svgAligns the preserveAspectRatio alignments of the anchors of cover.
+var svgAligns = map[string]string{
+	"center":       "xMidYMid",
+	"top":          "xMidYMin",
+	"bottom":       "xMidYMax",
+	"left":         "xMinYMid",
+	"right":        "xMaxYMid",
+	"top-left":     "xMinYMin",
+	"top-right":    "xMaxYMin",
+	"bottom-left":  "xMinYMax",
+	"bottom-right": "xMaxYMax",
+}
+
+// svgElements the elements kept in svg, the others are removed with their content,
+// such as script, foreignObject, a and the animations.
+var svgElements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "symbol": true, "use": true, "title": true, "desc": true,
+	"path": true, "rect": true, "circle": true, "ellipse": true, "line": true, "polyline": true, "polygon": true,
+	"text": true, "tspan": true, "textPath": true, "style": true, "image": true,
+	"linearGradient": true, "radialGradient": true, "stop": true, "pattern": true,
+	"clipPath": true, "mask": true, "marker": true, "filter": true,
+	"feBlend": true, "feColorMatrix": true, "feComponentTransfer": true, "feComposite": true,
+	"feConvolveMatrix": true, "feDiffuseLighting": true, "feDisplacementMap": true, "feDistantLight": true,
+	"feDropShadow": true, "feFlood": true, "feFuncA": true, "feFuncB": true, "feFuncG": true, "feFuncR": true,
+	"feGaussianBlur": true, "feMerge": true, "feMergeNode": true, "feMorphology": true, "feOffset": true,
+	"fePointLight": true, "feSpecularLighting": true, "feSpotLight": true, "feTile": true, "feTurbulence": true,
+}
+
+// svgAttrs the attributes without namespace kept in svg, the others are removed,
+// such as the event handlers. href is checked by svgHref.
+var svgAttrs = map[string]bool{
+	"id": true, "class": true, "style": true, "lang": true, "version": true, "transform": true,
+	"viewBox": true, "preserveAspectRatio": true, "width": true, "height": true,
+	"x": true, "y": true, "x1": true, "y1": true, "x2": true, "y2": true,
+	"cx": true, "cy": true, "r": true, "rx": true, "ry": true, "d": true, "points": true, "pathLength": true,
+	"fill": true, "fill-opacity": true, "fill-rule": true, "stroke": true, "stroke-width": true,
+	"stroke-opacity": true, "stroke-linecap": true, "stroke-linejoin": true, "stroke-miterlimit": true,
+	"stroke-dasharray": true, "stroke-dashoffset": true, "opacity": true, "color": true,
+	"display": true, "visibility": true, "overflow": true, "clip": true, "clip-path": true, "clip-rule": true,
+	"mask": true, "filter": true, "marker-start": true, "marker-mid": true, "marker-end": true,
+	"markerWidth": true, "markerHeight": true, "markerUnits": true, "refX": true, "refY": true, "orient": true,
+	"font-family": true, "font-size": true, "font-weight": true, "font-style": true, "font-variant": true,
+	"font-stretch": true, "text-anchor": true, "dominant-baseline": true, "alignment-baseline": true,
+	"baseline-shift": true, "letter-spacing": true, "word-spacing": true, "text-decoration": true,
+	"writing-mode": true, "dx": true, "dy": true, "rotate": true, "textLength": true, "lengthAdjust": true,
+	"startOffset": true, "gradientUnits": true, "gradientTransform": true, "spreadMethod": true,
+	"fx": true, "fy": true, "fr": true, "offset": true, "stop-color": true, "stop-opacity": true,
+	"patternUnits": true, "patternContentUnits": true, "patternTransform": true, "clipPathUnits": true,
+	"maskUnits": true, "maskContentUnits": true, "filterUnits": true, "primitiveUnits": true,
+	"in": true, "in2": true, "result": true, "stdDeviation": true, "type": true, "values": true,
+	"operator": true, "k1": true, "k2": true, "k3": true, "k4": true, "mode": true, "scale": true,
+	"xChannelSelector": true, "yChannelSelector": true, "flood-color": true, "flood-opacity": true,
+	"lighting-color": true, "surfaceScale": true, "diffuseConstant": true, "specularConstant": true,
+	"specularExponent": true, "kernelMatrix": true, "order": true, "divisor": true, "bias": true,
+	"targetX": true, "targetY": true, "edgeMode": true, "kernelUnitLength": true, "azimuth": true,
+	"elevation": true, "z": true, "pointsAtX": true, "pointsAtY": true, "pointsAtZ": true,
+	"limitingConeAngle": true, "baseFrequency": true, "numOctaves": true, "seed": true, "stitchTiles": true,
+	"radius": true, "tableValues": true, "slope": true, "intercept": true, "amplitude": true, "exponent": true,
+	"color-interpolation": true, "color-interpolation-filters": true, "shape-rendering": true,
+	"text-rendering": true, "image-rendering": true, "vector-effect": true, "mix-blend-mode": true,
+	"isolation": true, "media": true,
+}
+
+// svgNamespace the namespace of svg, which the root element is bound to.
+const svgNamespace = "http://www.w3.org/2000/svg"
+
+// scaleSVG rewrites the size of the root element of svg by the options, the content is scaled by its viewBox.
+// The document is rewritten by the allow-lists of elements and attributes, so that it can not run scripts
+// or load external resources when it is opened from the origin of the api.
+func scaleSVG(data []byte, out io.Writer, opts *ImageOptions) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	buf := &bytes.Buffer{}
+	// elements the open elements kept, skip the depth in a removed element
+	var (
+		elements []string
+		skip     int
+		root     bool
+	)
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ErrImageFormat
+		}
+
+		switch t := token.(type) {
+		case xml.ProcInst:
+			if t.Target == "xml" && !root {
+				buf.WriteString("<?xml " + string(t.Inst) + "?>")
+			}
+		case xml.StartElement:
+			if skip > 0 || (root && len(elements) == 0) {
+				skip++
+
+				continue
+			}
+			if !root {
+				if t.Name.Space != "" || t.Name.Local != "svg" {
+					return ErrImageFormat
+				}
+				root = true
+				tag, err := svgTag(t, opts)
+				if err != nil {
+					return err
+				}
+				buf.Write(tag)
+				elements = append(elements, t.Name.Local)
+
+				continue
+			}
+			if t.Name.Space != "" || !svgElements[t.Name.Local] {
+				skip++
+
+				continue
+			}
+
+			buf.WriteString("<" + t.Name.Local)
+			for _, attr := range t.Attr {
+				if svgAttr(t.Name.Local, attr) {
+					writeSVGAttr(buf, svgName(attr.Name), attr.Value)
+				}
+			}
+			buf.WriteString(">")
+			elements = append(elements, t.Name.Local)
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+
+				continue
+			}
+			if len(elements) == 0 {
+				continue
+			}
+			buf.WriteString("</" + elements[len(elements)-1] + ">")
+			elements = elements[:len(elements)-1]
+		case xml.CharData:
+			if skip > 0 || len(elements) == 0 {
+				continue
+			}
+			// the style sheets are kept if they do not load resources
+			if elements[len(elements)-1] == "style" && !safeSVGValue(string(t)) {
+				continue
+			}
+			_ = xml.EscapeText(buf, t)
+		}
+		// comments and directives are removed
+	}
+	if !root || len(elements) != 0 {
+		return ErrImageFormat
+	}
+
+	_, err := out.Write(buf.Bytes())
+
+	return err
+}
+
+// readSVG reads the svg source of at most max bytes, which is parsed as a whole.
+func readSVG(r io.Reader, max int64) ([]byte, error) {
+	if max > 0 {
+		r = io.LimitReader(r, max+1)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, ErrImageFormat
+	}
+	if max > 0 && int64(len(data)) > max {
+		return nil, ErrImageTooLarge
+	}
+
+	return data, nil
+}
+
+// svgTag returns the start tag of the root element with the size of the options.
+func svgTag(element xml.StartElement, opts *ImageOptions) ([]byte, error) {
+	var (
+		viewBox       string
+		width, height string
+	)
+	attrs := make([]xml.Attr, 0, len(element.Attr))
+	for _, attr := range element.Attr {
+		if attr.Name.Space != "" {
+			if svgAttr(element.Name.Local, attr) {
+				attrs = append(attrs, attr)
+			}
+
+			continue
+		}
+
+		switch attr.Name.Local {
+		case "viewBox":
+			viewBox = attr.Value
+		case "width":
+			width = attr.Value
+		case "height":
+			height = attr.Value
+		case "preserveAspectRatio":
+		default:
+			if svgAttr(element.Name.Local, attr) {
+				attrs = append(attrs, attr)
+			}
+		}
+	}
+
+	// the viewBox is derived from the size without units
+	var box []float64
+	if viewBox != "" {
+		box = svgNumbers(viewBox)
+	} else if w, h := svgLength(width), svgLength(height); w > 0 && h > 0 {
+		box = []float64{0, 0, w, h}
+		viewBox = "0 0 " + strconv.FormatFloat(w, 'f', -1, 64) + " " + strconv.FormatFloat(h, 'f', -1, 64)
+	}
+	if len(box) != 4 || box[2] <= 0 || box[3] <= 0 || math.IsInf(box[2], 0) || math.IsInf(box[3], 0) {
+		return nil, ErrImageFormat
+	}
+
+	w, h := float64(opts.Width), float64(opts.Height)
+	aspect := "none"
+	switch {
+	case w == 0 && h == 0:
+		w, h = box[2], box[3]
+	case w == 0:
+		w = h * box[2] / box[3]
+	case h == 0:
+		h = w * box[3] / box[2]
+	case opts.Fit == FitContain:
+		scale := math.Min(w/box[2], h/box[3])
+		w, h = box[2]*scale, box[3]*scale
+	case opts.Fit == FitCover:
+		aspect = svgAligns[opts.Crop] + " slice"
+	}
+
+	// the clients rasterize svg at the size, which is limited as the pixels of raster sources
+	if w > math.MaxInt32 || h > math.MaxInt32 || (opts.MaxPixels > 0 && w*h > float64(opts.MaxPixels)) {
+		return nil, ErrImageTooLarge
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("<svg")
+	writeSVGAttr(buf, "xmlns", svgNamespace)
+	for _, attr := range attrs {
+		writeSVGAttr(buf, svgName(attr.Name), attr.Value)
+	}
+	writeSVGAttr(buf, "viewBox", viewBox)
+	writeSVGAttr(buf, "width", strconv.Itoa(int(math.Max(1, math.Round(w)))))
+	writeSVGAttr(buf, "height", strconv.Itoa(int(math.Max(1, math.Round(h)))))
+	writeSVGAttr(buf, "preserveAspectRatio", aspect)
+	buf.WriteString(">")
+
+	return buf.Bytes(), nil
+}
+
+// svgAttr reports whether the attribute of element is kept. The default namespace is always svg,
+// the prefixed attributes are kept for the declarations, xml:space, xml:lang and xlink:href.
+func svgAttr(element string, attr xml.Attr) bool {
+	switch attr.Name.Space {
+	case "":
+		if attr.Name.Local == "href" {
+			return svgHref(element, attr.Value)
+		}
+
+		return svgAttrs[attr.Name.Local] && safeSVGValue(attr.Value)
+	case "xmlns":
+		return true
+	case "xml":
+		return attr.Name.Local == "space" || attr.Name.Local == "lang"
+	case "xlink":
+		return attr.Name.Local == "href" && svgHref(element, attr.Value)
+	default:
+		return false
+	}
+}
+
+// svgHref reports whether the reference is kept, the fragments of the document,
+// and the raster images embedded as data urls of image elements.
+func svgHref(element, value string) bool {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "#") {
+		return true
+	}
+	if element != "image" {
+		return false
+	}
+
+	value = strings.ToLower(value)
+	for _, prefix := range []string{"data:image/png", "data:image/jpeg", "data:image/gif", "data:image/webp"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// safeSVGValue reports whether the value of an attribute or a style sheet refers to
+// the fragments of the document only. The css escapes are rejected as they may hide a url.
+func safeSVGValue(value string) bool {
+	value = strings.ToLower(value)
+	if strings.ContainsAny(value, "\\\x00") {
+		return false
+	}
+	for _, word := range []string{"javascript:", "@import", "expression(", "behavior:", "-moz-binding"} {
+		if strings.Contains(value, word) {
+			return false
+		}
+	}
+
+	for i := strings.Index(value, "url("); i >= 0; i = strings.Index(value, "url(") {
+		value = strings.TrimLeft(value[i+len("url("):], " \t\n\r\f'\"")
+		if !strings.HasPrefix(value, "#") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func svgName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
+
+func writeSVGAttr(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(" " + name + `="`)
+	_ = xml.EscapeText(buf, []byte(value))
+	buf.WriteString(`"`)
+}
+
+// svgLength returns the length in user units, 0 if it has other units, such as % or cm.
+func svgLength(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "px"), 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+
+	return v
+}
+
+// svgNumbers parses a list of numbers separated by spaces or commas.
+func svgNumbers(s string) []float64 {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t' || r == '\n' || r == '\r'
+	})
+
+	numbers := make([]float64, 0, len(fields))
+	for _, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, v)
+	}
+
+	return numbers
+}
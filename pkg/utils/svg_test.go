@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTransformSVG(t *testing.T) {
+	tests := []struct {
+		name string
+		svg  string
+		opts ImageOptions
+		// want the attributes of the root element
+		want []string
+		err  error
+	}{
+		{
+			name: "width",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 50"><rect/></svg>`,
+			opts: ImageOptions{Width: 20},
+			want: []string{`viewBox="0 0 100 50"`, `width="20"`, `height="10"`, `preserveAspectRatio="none"`},
+		},
+		{
+			name: "contain",
+			svg:  `<?xml version="1.0"?><svg width="100px" height="50px"/>`,
+			opts: ImageOptions{Width: 40, Height: 40},
+			want: []string{`viewBox="0 0 100 50"`, `width="40"`, `height="20"`},
+		},
+		{
+			name: "cover",
+			svg:  `<svg viewBox="0 0 100 50"></svg>`,
+			opts: ImageOptions{Width: 40, Height: 40, Fit: FitCover, Crop: "top"},
+			want: []string{`width="40"`, `height="40"`, `preserveAspectRatio="xMidYMin slice"`},
+		},
+		{
+			name: "huge viewBox",
+			svg:  `<svg viewBox="0 0 100000 100000"></svg>`,
+			opts: ImageOptions{MaxPixels: 50000000},
+			err:  ErrImageTooLarge,
+		},
+		{
+			name: "huge height of width",
+			svg:  `<svg viewBox="0 0 1 100000"></svg>`,
+			opts: ImageOptions{Width: 1000, MaxPixels: 50000000},
+			err:  ErrImageTooLarge,
+		},
+		{
+			name: "huge size",
+			svg:  `<svg viewBox="0 0 100 100"></svg>`,
+			opts: ImageOptions{Width: 10000, Height: 10000, Fit: FitFill, MaxPixels: 50000000},
+			err:  ErrImageTooLarge,
+		},
+		{
+			name: "overflow without limit",
+			svg:  `<svg viewBox="0 0 1e300 1e300"></svg>`,
+			err:  ErrImageTooLarge,
+		},
+		{
+			name: "infinite size",
+			svg:  `<svg width="Inf" height="Inf"></svg>`,
+			err:  ErrImageFormat,
+		},
+		{
+			name: "no size",
+			svg:  `<svg></svg>`,
+			err:  ErrImageFormat,
+		},
+		{
+			name: "not svg",
+			svg:  `<html></html>`,
+			err:  ErrImageFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			opts := tt.opts
+			opts.SVG = true
+			format, err := Transform(strings.NewReader(tt.svg), out, &opts)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Transform() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if format != FormatSVG {
+				t.Errorf("Transform() format = %s, want %s", format, FormatSVG)
+			}
+			for _, attr := range tt.want {
+				if !strings.Contains(out.String(), attr) {
+					t.Errorf("Transform() = %s, want %s", out.String(), attr)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name string
+		svg  string
+		// removed the content removed, kept the content kept
+		removed []string
+		kept    []string
+	}{
+		{
+			name:    "script",
+			svg:     `<svg viewBox="0 0 10 10"><script>alert(1)</script><rect width="1"/></svg>`,
+			removed: []string{"script", "alert"},
+			kept:    []string{`<rect width="1"></rect>`},
+		},
+		{
+			name:    "handlers",
+			svg:     `<svg viewBox="0 0 10 10" onload="alert(1)"><g onclick="alert(2)" fill="red"></g></svg>`,
+			removed: []string{"onload", "onclick", "alert"},
+			kept:    []string{`<g fill="red"></g>`},
+		},
+		{
+			name:    "foreignObject",
+			svg:     `<svg viewBox="0 0 10 10"><foreignObject><body xmlns="http://www.w3.org/1999/xhtml"><iframe src="x"/></body></foreignObject></svg>`,
+			removed: []string{"foreignObject", "iframe", "body"},
+		},
+		{
+			name:    "links",
+			svg:     `<svg xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10"><a href="javascript:alert(1)"><text>x</text></a><use xlink:href="#a"/><use href="http://example.com/a.svg#b"/><image href="http://example.com/a.png"/></svg>`,
+			removed: []string{"javascript", "<a", "example.com"},
+			kept:    []string{`<use xlink:href="#a"></use>`},
+		},
+		{
+			name:    "styles",
+			svg:     `<svg viewBox="0 0 10 10"><style>@import url(http://example.com/a.css);</style><rect style="fill:url( 'http://example.com/a')"/><rect fill="url(#g)"/></svg>`,
+			removed: []string{"example.com", "@import"},
+			kept:    []string{`<rect fill="url(#g)"></rect>`},
+		},
+		{
+			name:    "namespace",
+			svg:     `<svg xmlns="http://www.w3.org/1999/xhtml" viewBox="0 0 10 10"><rect xmlns="http://www.w3.org/1999/xhtml"/></svg>`,
+			removed: []string{"xhtml"},
+			kept:    []string{`<svg xmlns="http://www.w3.org/2000/svg"`},
+		},
+		{
+			name:    "doctype",
+			svg:     `<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY a "b">]><!-- c --><svg viewBox="0 0 10 10"/><script/>`,
+			removed: []string{"DOCTYPE", "ENTITY", "<!--", "script"},
+			kept:    []string{`<?xml version="1.0"?>`, `></svg>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			_, err := Transform(strings.NewReader(tt.svg), out, &ImageOptions{SVG: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range tt.removed {
+				if strings.Contains(out.String(), s) {
+					t.Errorf("Transform() = %s, want %s removed", out.String(), s)
+				}
+			}
+			for _, s := range tt.kept {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("Transform() = %s, want %s kept", out.String(), s)
+				}
+			}
+		})
+	}
+}
+
+func TestTransformSVGSource(t *testing.T) {
+	svg := `<svg viewBox="0 0 10 10"><rect width="1"/></svg>`
+	tests := []struct {
+		name string
+		opts ImageOptions
+		err  error
+	}{
+		{"declared", ImageOptions{SVG: true, MaxSVGSize: int64(len(svg))}, nil},
+		{"not declared", ImageOptions{MaxSVGSize: int64(len(svg))}, ErrImageFormat},
+		{"too large", ImageOptions{SVG: true, MaxSVGSize: int64(len(svg)) - 1}, ErrImageTooLarge},
+		{"converted", ImageOptions{SVG: true, Format: "png"}, ErrImageFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			_, err := Transform(strings.NewReader(svg), &bytes.Buffer{}, &opts)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Transform() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// headers of the webhook request.
+const (
+	EventHeader     = "X-Fileserver-Event"
+	DeliveryHeader  = "X-Fileserver-Delivery"
+	TimestampHeader = "X-Fileserver-Timestamp"
+	SignatureHeader = "X-Fileserver-Signature"
+)
+
+// Client delivers the events to webhooks.
+type Client struct {
+	client *http.Client
+}
+
+// New returns a client with the timeout of a delivery.
+func New(timeout time.Duration) *Client {
+	return &Client{
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// Sign returns the signature of body sent at timestamp,
+// which is sha256=hex(hmac-sha256(secret, timestamp.body)).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts the event to url, any response other than 2xx is an error.
+// The body is signed if secret is not empty.
+func (c *Client) Send(ctx context.Context, url, secret, id, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, id)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responds %s", resp.Status)
+	}
+
+	return nil
+}
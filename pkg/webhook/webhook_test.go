@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	want := "sha256=086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54"
+
+	if got := Sign("secret", 1700000000, body); got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+	if Sign("other", 1700000000, body) == want {
+		t.Error("signature does not depend on secret")
+	}
+	if Sign("secret", 1700000001, body) == want {
+		t.Error("signature does not depend on timestamp")
+	}
+}
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"type":"file.uploaded"}`)
+
+	var header http.Header
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		received, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := New(time.Second)
+	err := c.Send(context.Background(), server.URL, "secret", "event-1", "file.uploaded", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(received) != string(body) {
+		t.Errorf("body = %s", received)
+	}
+	if header.Get(EventHeader) != "file.uploaded" || header.Get(DeliveryHeader) != "event-1" {
+		t.Errorf("headers = %v", header)
+	}
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get(SignatureHeader); got != Sign("secret", timestamp, body) {
+		t.Errorf("signature = %s", got)
+	}
+
+	err = c.Send(context.Background(), server.URL, "", "event-2", "file.uploaded", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get(SignatureHeader); got != "" {
+		t.Errorf("unsigned delivery has signature %s", got)
+	}
+
+	err = c.Send(context.Background(), server.URL+"/fail", "secret", "event-3", "file.uploaded", body)
+	if err == nil {
+		t.Error("non-2xx response is not an error")
+	}
+}
@@ -0,0 +1,17 @@
+--- ADD COLUMN
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `digest` VARCHAR(128) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '文件内容sha256值' AFTER `path`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `blob_id` VARCHAR(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '共享对象ID，为空时对象存储在path' AFTER `digest`;
+
+--- CREATE TABLE
+CREATE TABLE `fileserver`.`blob`  (
+  `id` varchar(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'ID',
+  `digest` varchar(128) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '文件内容sha256值',
+  `bucket` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '存储桶',
+  `path` varchar(300) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '存储服务中的路径',
+  `size` bigint(20) NOT NULL DEFAULT 0 COMMENT '文件大小 单位B',
+  `number` int(11) NOT NULL DEFAULT 1 COMMENT '引用该对象的文件个数',
+  `create_at` bigint(20) NOT NULL COMMENT '创建时间',
+  `update_at` bigint(20) NOT NULL COMMENT '修改时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE KEY `UQE_BUCKET_DIGEST` (`bucket`, `digest`)
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '内容寻址对象表' ROW_FORMAT = DYNAMIC;
@@ -0,0 +1,6 @@
+--- ADD COLUMN
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `parent_id` VARCHAR(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '源文件ID，为空时不是衍生文件' AFTER `path`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `variant` VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '衍生文件的规格，如缩略图的预设名称或WxH' AFTER `parent_id`;
+
+--- ADD INDEX
+ALTER TABLE `fileserver`.`fileserver` ADD INDEX `IDX_PARENT_ID` (`parent_id`);
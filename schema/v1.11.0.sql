@@ -0,0 +1,12 @@
+--- CREATE TABLE
+CREATE TABLE `fileserver`.`image_meta`  (
+  `file_id` varchar(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '文件ID',
+  `width` int(11) NOT NULL DEFAULT 0 COMMENT '宽度 单位像素',
+  `height` int(11) NOT NULL DEFAULT 0 COMMENT '高度 单位像素',
+  `format` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '图片格式，如jpeg、png',
+  `color_model` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '颜色模型，如ycbcr、rgba',
+  `exif` text CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL COMMENT 'EXIF字段，json对象',
+  `create_at` bigint(20) NOT NULL COMMENT '创建时间',
+  `update_at` bigint(20) NOT NULL COMMENT '修改时间',
+  PRIMARY KEY (`file_id`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '图片元数据表' ROW_FORMAT = DYNAMIC;
@@ -0,0 +1,2 @@
+--- ADD INDEX
+ALTER TABLE `fileserver`.`fileserver` ADD INDEX IDX_DIGEST (`digest`);
@@ -0,0 +1,13 @@
+--- ADD COLUMN
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `bucket` VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '存储桶' AFTER `id`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `size` BIGINT(20) NOT NULL DEFAULT 0 COMMENT '文件大小 单位B' AFTER `blob_id`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `content_type` VARCHAR(128) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '文件类型' AFTER `size`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `file_name` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '原始文件名' AFTER `content_type`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `uploader_id` VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '上传者ID' AFTER `file_name`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `tenant_id` VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '租户ID' AFTER `uploader_id`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `app_id` VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '应用ID' AFTER `tenant_id`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `store_name` VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '存储配置名称' AFTER `app_id`;
+ALTER TABLE `fileserver`.`fileserver` ADD COLUMN `status` INT(11) NOT NULL DEFAULT 0 COMMENT '状态，0：元数据待补全，1：正常' AFTER `store_name`;
+
+--- ADD INDEX
+ALTER TABLE `fileserver`.`fileserver` ADD INDEX `IDX_STATUS` (`status`);
@@ -0,0 +1,4 @@
+--- ADD INDEX
+ALTER TABLE `fileserver`.`fileserver` ADD INDEX `IDX_TENANT_APP_CREATE` (`tenant_id`, `app_id`, `create_at`);
+ALTER TABLE `fileserver`.`fileserver` ADD INDEX `IDX_TENANT_UPLOADER_CREATE` (`tenant_id`, `uploader_id`, `create_at`);
+ALTER TABLE `fileserver`.`fileserver` ADD INDEX `IDX_CREATE_AT` (`create_at`);
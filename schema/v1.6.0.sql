@@ -0,0 +1,16 @@
+--- CREATE TABLE
+CREATE TABLE `fileserver`.`quota`  (
+  `id` varchar(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'ID',
+  `scope` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '范围，tenant：租户，app：应用',
+  `owner_id` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '租户ID或应用ID',
+  `soft_bytes` bigint(20) NOT NULL DEFAULT 0 COMMENT '容量软限制 单位B，0使用默认值',
+  `hard_bytes` bigint(20) NOT NULL DEFAULT 0 COMMENT '容量硬限制 单位B，0使用默认值',
+  `soft_files` bigint(20) NOT NULL DEFAULT 0 COMMENT '文件数软限制，0使用默认值',
+  `hard_files` bigint(20) NOT NULL DEFAULT 0 COMMENT '文件数硬限制，0使用默认值',
+  `used_bytes` bigint(20) NOT NULL DEFAULT 0 COMMENT '已用容量 单位B',
+  `used_files` bigint(20) NOT NULL DEFAULT 0 COMMENT '已用文件数',
+  `create_at` bigint(20) NOT NULL COMMENT '创建时间',
+  `update_at` bigint(20) NOT NULL COMMENT '修改时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE KEY `UQE_SCOPE_OWNER` (`scope`, `owner_id`)
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '存储配额表' ROW_FORMAT = DYNAMIC;
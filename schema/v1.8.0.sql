@@ -0,0 +1,16 @@
+--- CREATE TABLE
+CREATE TABLE `fileserver`.`event_outbox`  (
+  `id` varchar(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'ID',
+  `event_id` varchar(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '事件ID，同一事件投递到多个目标时相同',
+  `sink` varchar(128) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '投递目标',
+  `type` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '事件类型',
+  `payload` text CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '事件内容',
+  `status` int(11) NOT NULL DEFAULT 0 COMMENT '状态，0：待投递，1：投递失败',
+  `attempts` int(11) NOT NULL DEFAULT 0 COMMENT '已投递次数',
+  `next_at` bigint(20) NOT NULL DEFAULT 0 COMMENT '下次投递时间',
+  `error` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '最近一次投递失败原因',
+  `create_at` bigint(20) NOT NULL COMMENT '创建时间',
+  `update_at` bigint(20) NOT NULL COMMENT '修改时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  KEY `IDX_STATUS_NEXT` (`status`, `next_at`)
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '事件发件箱' ROW_FORMAT = DYNAMIC;
@@ -0,0 +1,2 @@
+--- ALTER TABLE
+ALTER TABLE `fileserver`.`fileserver` MODIFY COLUMN `status` INT(11) NOT NULL DEFAULT 0 COMMENT '状态，0：元数据待补全，1：正常，2：已隔离';